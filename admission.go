@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Admission policies applied to expensive requests while their model is busy
+const (
+	AdmissionReject    = "reject"    // Fail the request with ErrAdmissionRejected
+	AdmissionQueue     = "queue"     // Hold the request until the model is no longer busy
+	AdmissionDowngrade = "downgrade" // Lower predict until the estimated cost fits AdmissionMaxCost
+)
+
+// admissionPollInterval is how often a held request re-checks its model's load
+const admissionPollInterval = 250 * time.Millisecond
+
+// estimateRequestCost estimates what a request will cost as prompt tokens × predict.
+// The prompt is counted with the model's tokenizer, falling back to the
+// four-characters-per-token heuristic if the tokenizer fails. An unbounded predict
+// budget is counted as the full context size.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the tokenizer pre-pass
+//   - arguments: The transformed completion request
+//
+// Returns:
+//   - int: The prompt token count
+//   - int: The predict budget used for the estimate
+func estimateRequestCost(ctx context.Context, arguments CompletionArguments) (int, int) {
+	text := arguments.Prompt + arguments.AssistantPrefix
+	promptTokens := estimateTokens(text)
+	if tokens, err := tokenize(ctx, CountTokensArguments{Prompt: text, Model: arguments.Model}); err == nil {
+		promptTokens = len(tokens)
+	} else {
+		logger.Printf("Admission: tokenizer pre-pass failed, estimating prompt tokens: %v", err)
+	}
+
+	resolved := resolveArguments(arguments)
+	predict := resolved.Predict
+	if predict <= 0 {
+		predict = resolved.CtxSize
+	}
+	return promptTokens, predict
+}
+
+// admitRequest applies the admission policy to a request before it is queued for a
+// model slot. Requests are always accepted while the model's load is below
+// AdmissionBusyLoad; once it is busy, a request whose estimated cost exceeds
+// AdmissionMaxCost is rejected, held, or downgraded according to AdmissionPolicy.
+//
+// Parameters:
+//   - ctx: Context whose cancellation abandons a held request
+//   - arguments: The transformed completion request
+//
+// Returns:
+//   - CompletionArguments: The request to run, with Predict lowered when downgraded
+//   - string: A warning to report to the client, or "" when the request was not changed
+//   - error: ErrAdmissionRejected when the request is not admitted, or the context error
+func admitRequest(ctx context.Context, arguments CompletionArguments) (CompletionArguments, string, error) {
+	if appArgs.AdmissionMaxCost <= 0 {
+		return arguments, "", nil
+	}
+	model := effectiveModel(arguments)
+	busy := func() bool { return modelLoad(model) >= appArgs.AdmissionBusyLoad }
+	if !busy() {
+		return arguments, "", nil
+	}
+
+	promptTokens, predict := estimateRequestCost(ctx, arguments)
+	cost := promptTokens * predict
+	if cost <= appArgs.AdmissionMaxCost {
+		return arguments, "", nil
+	}
+	requestLogf(ctx, "Admission: estimated cost %d (%d prompt tokens × %d predict) exceeds %d while %s is busy, policy %s",
+		cost, promptTokens, predict, appArgs.AdmissionMaxCost, filepath.Base(model), appArgs.AdmissionPolicy)
+
+	switch appArgs.AdmissionPolicy {
+	case AdmissionQueue:
+		deadline := time.Now().Add(time.Duration(appArgs.AdmissionQueueSeconds) * time.Second)
+		ticker := time.NewTicker(admissionPollInterval)
+		defer ticker.Stop()
+		for busy() {
+			if !time.Now().Before(deadline) {
+				return arguments, "", fmt.Errorf("%w: estimated cost %d exceeds %d and the server stayed busy for %d seconds; retry later or lower predict",
+					ErrAdmissionRejected, cost, appArgs.AdmissionMaxCost, appArgs.AdmissionQueueSeconds)
+			}
+			select {
+			case <-ctx.Done():
+				return arguments, "", ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		return arguments, "", nil
+
+	case AdmissionDowngrade:
+		allowed := appArgs.AdmissionMaxCost / max(promptTokens, 1)
+		if allowed < 1 {
+			return arguments, "", fmt.Errorf("%w: the prompt alone (%d tokens) exceeds the cost limit %d while the server is busy; retry later or shorten the prompt",
+				ErrAdmissionRejected, promptTokens, appArgs.AdmissionMaxCost)
+		}
+		arguments.Predict = allowed
+		return arguments, fmt.Sprintf("predict lowered from %d to %d because the server is busy", predict, allowed), nil
+
+	default:
+		return arguments, "", fmt.Errorf("%w: estimated cost %d (%d prompt tokens × %d predict) exceeds %d while the server is busy; retry later or lower predict",
+			ErrAdmissionRejected, cost, promptTokens, predict, appArgs.AdmissionMaxCost)
+	}
+}
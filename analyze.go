@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// TokenPiece is one token of an analyzed prompt
+type TokenPiece struct {
+	ID      int    `json:"id"`                // Token id in the model vocabulary
+	Piece   string `json:"piece"`             // Text the token decodes to
+	Special bool   `json:"special,omitempty"` // Whether the piece looks like a special/control token
+}
+
+// PromptAnalysis is the JSON document returned by the analyze_prompt tool
+type PromptAnalysis struct {
+	TokenCount        int          `json:"token_count"`         // Number of tokens in the prompt
+	SpecialTokenCount int          `json:"special_token_count"` // Tokens whose piece looks like a special token
+	Tokens            []TokenPiece `json:"tokens"`              // Tokens in prompt order
+}
+
+// tokenPiecePattern matches the start of a "   123 -> 'piece'" line printed by
+// llama-tokenize without --ids; pieces may themselves contain newlines
+var tokenPiecePattern = regexp.MustCompile(`(?m)^\s*(\d+) -> '`)
+
+// specialPiecePattern recognizes common special token spellings such as <s>, </s>,
+// <|im_start|> and [INST]
+var specialPiecePattern = regexp.MustCompile(`^(<\|[^|]*\|>|</?[A-Za-z_]+>|\[/?[A-Z_]+\])$`)
+
+// parseTokenPieces parses the id/piece listing printed by llama-tokenize.
+//
+// Parameters:
+//   - output: The llama-tokenize standard output
+//
+// Returns:
+//   - []TokenPiece: The tokens in order
+//   - error: An error if no tokens could be found
+func parseTokenPieces(output string) ([]TokenPiece, error) {
+	matches := tokenPiecePattern.FindAllStringSubmatchIndex(output, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("unexpected llama-tokenize output: %.200s", output)
+	}
+
+	pieces := make([]TokenPiece, 0, len(matches))
+	for i, match := range matches {
+		id, err := strconv.Atoi(output[match[2]:match[3]])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token id: %w", err)
+		}
+
+		// The piece runs to the closing quote before the next token line
+		end := len(output)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		piece := output[match[1]:end]
+		if n := len(piece); n > 0 && piece[n-1] == '\n' {
+			piece = piece[:n-1]
+		}
+		if n := len(piece); n > 0 && piece[n-1] == '\'' {
+			piece = piece[:n-1]
+		}
+
+		pieces = append(pieces, TokenPiece{ID: id, Piece: piece, Special: specialPiecePattern.MatchString(piece)})
+	}
+	return pieces, nil
+}
+
+// tokenizePieces runs llama-tokenize for a request and returns each token with its piece.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - arguments: The text to tokenize and tokenization options
+//
+// Returns:
+//   - []TokenPiece: The tokens in order
+//   - error: Any execution or parse error
+func tokenizePieces(ctx context.Context, arguments CountTokensArguments) ([]TokenPiece, error) {
+	tokenizeArgs := appArgs
+	tokenizeArgs.LLamaCliPath = tokenizeCliPath()
+	args, err := prepareTokenizeArgs(arguments, true)
+	if err != nil {
+		return nil, err
+	}
+	output, err := GenerateSingleCompletionWithCancel(ctx, tokenizeArgs, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokenPieces(string(output))
+}
+
+// handleAnalyzePromptTool tokenizes a prompt and returns each token's id and text
+// piece, to diagnose unexpected token splits.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token when auth is enabled
+//   - arguments: The text to analyze and tokenization options
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON {"token_count", "special_token_count", "tokens"} or an error message
+//   - error: Any error that occurred while encoding the response
+func handleAnalyzePromptTool(ctx context.Context, arguments CountTokensArguments) (*mcpgolang.ToolResponse, error) {
+	if arguments.Prompt == "" {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: Prompt cannot be empty")), nil
+	}
+	if token, model := authTokenFromContext(ctx), effectiveModel(CompletionArguments{Model: arguments.Model}); !modelAllowedForToken(token, model) {
+		logger.Printf("Token %q is not permitted to use model %q", token.Name, model)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: model %q is not permitted for this token", filepath.Base(model)))), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(completionTimeoutSeconds(PriorityNormal))*time.Second)
+	defer cancel()
+
+	pieces, err := tokenizePieces(ctx, arguments)
+	if err != nil {
+		logger.Printf("Error analyzing prompt: %v", redactText(err.Error()))
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error analyzing prompt: %v", err))), nil
+	}
+
+	result := PromptAnalysis{TokenCount: len(pieces), Tokens: pieces}
+	for _, piece := range pieces {
+		if piece.Special {
+			result.SpecialTokenCount++
+		}
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode prompt analysis: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
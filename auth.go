@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authTokenKey is the gin context key holding the authenticated *AuthToken
+const authTokenKey = "authToken"
+
+// AuthConfig lists the bearer tokens accepted by the MCP endpoint. It is loaded from
+// the JSON file named by AuthTokensFile; auth is disabled when no tokens are configured.
+type AuthConfig struct {
+	Tokens []AuthToken `json:"tokens"` // Accepted tokens
+}
+
+// AuthToken is one accepted bearer token and what it may access
+type AuthToken struct {
+	Name   string   `json:"name"`             // Identifier used in logs (never log the token itself)
+	Token  string   `json:"token"`            // Secret sent as "Authorization: Bearer <token>"
+	Models []string `json:"models,omitempty"` // Registry names, aliases or paths the token may use; empty allows all
+	Admin  bool     `json:"admin,omitempty"`  // Allows admin tools such as dump_request and replay_request
+}
+
+var (
+	authConfigValue AuthConfig // Loaded auth configuration, empty when auth is disabled
+	authConfigOnce  sync.Once  // Guards the one-time load of AuthTokensFile
+)
+
+// loadAuthConfig reads AuthTokensFile once and caches the parsed configuration.
+// An unreadable or malformed file is fatal for security: every request is rejected
+// rather than silently serving without auth.
+//
+// Returns:
+//   - AuthConfig: The loaded configuration
+//   - bool: Whether auth is enabled
+func loadAuthConfig() (AuthConfig, bool) {
+	authConfigOnce.Do(func() {
+		if appArgs.AuthTokensFile == "" {
+			return
+		}
+
+		data, err := os.ReadFile(appArgs.AuthTokensFile)
+		if err == nil {
+			err = json.Unmarshal(data, &authConfigValue)
+		}
+		if err != nil {
+			logger.Printf("Error: cannot load auth tokens from %s, rejecting all requests: %v", appArgs.AuthTokensFile, err)
+			authConfigValue = AuthConfig{Tokens: []AuthToken{}}
+			return
+		}
+		logger.Printf("Loaded %d auth token(s)", len(authConfigValue.Tokens))
+	})
+	return authConfigValue, authConfigValue.Tokens != nil
+}
+
+// authMiddleware rejects MCP requests without a valid bearer token when auth is
+// enabled, and records the matched token for the tool handlers.
+//
+// Returns:
+//   - gin.HandlerFunc: The middleware
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		config, enabled := loadAuthConfig()
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		presented, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			for i := range config.Tokens {
+				token := &config.Tokens[i]
+				if token.Token != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(token.Token)) == 1 {
+					c.Set(authTokenKey, token)
+					c.Next()
+					return
+				}
+			}
+		}
+
+		logger.Printf("Rejected unauthenticated request from %s", c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid bearer token"})
+	}
+}
+
+// authTokenFromContext returns the token that authenticated the current tool call.
+//
+// Parameters:
+//   - ctx: The tool handler context
+//
+// Returns:
+//   - *AuthToken: The authenticated token, or nil when auth is disabled
+func authTokenFromContext(ctx context.Context) *AuthToken {
+	c, ok := ctx.Value("ginContext").(*gin.Context)
+	if !ok {
+		return nil
+	}
+	value, ok := c.Get(authTokenKey)
+	if !ok {
+		return nil
+	}
+	token, _ := value.(*AuthToken)
+	return token
+}
+
+// modelAllowedForToken checks a request's model against a token's allowlist. Both
+// sides are resolved through the model registry first, so allowlists may name
+// registry models, aliases or paths and requests are matched after aliasing.
+//
+// Parameters:
+//   - token: The authenticated token, or nil when auth is disabled
+//   - model: The resolved model path the request will run
+//
+// Returns:
+//   - bool: Whether the model may be used
+func modelAllowedForToken(token *AuthToken, model string) bool {
+	if token == nil || len(token.Models) == 0 {
+		return true
+	}
+	for _, allowed := range token.Models {
+		path, _ := resolveModel(allowed)
+		if filepath.Clean(path) == filepath.Clean(model) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// BaseCacheInfo describes the prompt prefix and model a saved base KV cache was built from.
+// It is stored next to the cache file as BaseKVCache + ".json".
+type BaseCacheInfo struct {
+	Model        string    `json:"model"`         // Model path the cache was evaluated with
+	PrefixSHA256 string    `json:"prefix_sha256"` // Hex SHA-256 of the cached prompt prefix
+	PrefixBytes  int       `json:"prefix_bytes"`  // Length of the cached prompt prefix in bytes
+	CreatedAt    time.Time `json:"created_at"`    // When the cache was generated
+}
+
+// BuildBaseCacheArguments defines the input structure for the MCP build_base_cache tool
+type BuildBaseCacheArguments struct {
+	Prompt string `json:"prompt" description:"Fixed prompt prefix (typically the system prompt) to evaluate and save"`
+	Model  string `json:"model,omitempty" description:"Model override; requests must use the same model to start from the cache"`
+}
+
+var (
+	baseCacheInfo    *BaseCacheInfo // Metadata of the current base cache, nil when none is usable
+	baseCacheMu      sync.RWMutex   // Guards baseCacheInfo
+	baseCacheOnce    sync.Once      // Guards the one-time load of the metadata file
+	baseCacheBuildMu sync.Mutex     // Serializes build_base_cache calls
+)
+
+// baseCacheInfoFile returns the path of the metadata file stored next to BaseKVCache.
+//
+// Returns:
+//   - string: The metadata file path
+func baseCacheInfoFile() string {
+	return appArgs.BaseKVCache + ".json"
+}
+
+// loadBaseCacheInfo reads the base cache metadata once. A missing cache or metadata
+// file leaves the base cache unused until build_base_cache creates one.
+//
+// Returns:
+//   - *BaseCacheInfo: The cache metadata, or nil when no base cache is usable
+func loadBaseCacheInfo() *BaseCacheInfo {
+	baseCacheOnce.Do(func() {
+		if appArgs.BaseKVCache == "" {
+			return
+		}
+		if llamaCliArgs.PromptCacheROCmd == "" {
+			logger.Printf("Warning: BaseKVCache ignored, PromptCacheROCmd is not set so requests could modify it")
+			return
+		}
+		if _, err := os.Stat(appArgs.BaseKVCache); err != nil {
+			logger.Printf("Base KV cache %s not found; create it with build_base_cache", appArgs.BaseKVCache)
+			return
+		}
+
+		data, err := os.ReadFile(baseCacheInfoFile())
+		if err != nil {
+			logger.Printf("Warning: base KV cache disabled, cannot read %s: %v", baseCacheInfoFile(), err)
+			return
+		}
+		var info BaseCacheInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			logger.Printf("Warning: base KV cache disabled, invalid %s: %v", baseCacheInfoFile(), err)
+			return
+		}
+
+		baseCacheMu.Lock()
+		baseCacheInfo = &info
+		baseCacheMu.Unlock()
+		logger.Printf("Loaded base KV cache %s (%d byte prefix, hash %.12s)", appArgs.BaseKVCache, info.PrefixBytes, info.PrefixSHA256)
+	})
+
+	baseCacheMu.RLock()
+	defer baseCacheMu.RUnlock()
+	return baseCacheInfo
+}
+
+// baseCacheFile returns the base KV cache path when a request can start from it: the
+// request must use the model the cache was built with and its prompt must begin with
+// the cached prefix. The cache is always opened read-only, so requests never modify it.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - string: The base cache path, or "" if the request can't use it
+func baseCacheFile(arguments CompletionArguments) string {
+	info := loadBaseCacheInfo()
+	if info == nil || len(arguments.Prompt) < info.PrefixBytes || effectiveModel(arguments) != info.Model {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(arguments.Prompt[:info.PrefixBytes]))
+	if hex.EncodeToString(sum[:]) != info.PrefixSHA256 {
+		return ""
+	}
+	return appArgs.BaseKVCache
+}
+
+// withoutPromptCache removes prompt cache flags (and their file arguments) from a
+// llama-cli argument list.
+//
+// Parameters:
+//   - args: The llama-cli arguments
+//
+// Returns:
+//   - []string: A copy of args without prompt cache flags
+func withoutPromptCache(args []string) []string {
+	filtered := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case llamaCliArgs.PromptCacheCmd:
+			i++ // Skip the cache file too
+		case llamaCliArgs.PromptCacheROCmd, llamaCliArgs.PromptCacheAllCmd:
+		default:
+			filtered = append(filtered, args[i])
+		}
+	}
+	return filtered
+}
+
+// handleBuildBaseCacheTool evaluates a fixed prompt prefix once and saves its KV cache to
+// BaseKVCache. The cache is written to a temporary file and renamed into place, so requests
+// already reading the previous cache are not disturbed.
+//
+// Parameters:
+//   - ctx: The tool call context
+//   - arguments: The prefix to cache and an optional model override
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The cache metadata, or an error message
+//   - error: Any error that occurred while encoding the response
+func handleBuildBaseCacheTool(ctx context.Context, arguments BuildBaseCacheArguments) (*mcpgolang.ToolResponse, error) {
+	if denied := requireAdmin(ctx); denied != nil {
+		return denied, nil
+	}
+	if appArgs.BaseKVCache == "" || llamaCliArgs.PromptCacheCmd == "" || llamaCliArgs.PromptCacheROCmd == "" {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: BaseKVCache, PromptCacheCmd and PromptCacheROCmd must all be configured")), nil
+	}
+	if arguments.Prompt == "" {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: prompt cannot be empty")), nil
+	}
+
+	baseCacheBuildMu.Lock()
+	defer baseCacheBuildMu.Unlock()
+
+	completion := CompletionArguments{Prompt: arguments.Prompt, Model: arguments.Model, Predict: 1}
+	args, _, err := prepareLlamaArgs(completion)
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+	tmpFile := appArgs.BaseKVCache + ".tmp"
+	args = append(withoutPromptCache(args), llamaCliArgs.PromptCacheCmd, tmpFile)
+
+	// Count the build as in flight so shutdown drains it, and hold a completion slot
+	// while it runs like any other request
+	finishCompletion, err := trackCompletion()
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v; retry the request", err))), nil
+	}
+	defer finishCompletion()
+
+	timeoutSeconds := completionTimeoutSeconds("")
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+
+	releaseRequestSlot, err := acquireRequestSlot(ctx, timeoutSeconds)
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+	defer releaseRequestSlot()
+
+	releaseSlot, err := acquireModelSlot(ctx, effectiveModel(completion), timeoutSeconds)
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+	defer releaseSlot()
+
+	logger.Printf("Building base KV cache %s from a %d byte prefix", appArgs.BaseKVCache, len(arguments.Prompt))
+	start := time.Now()
+	if _, _, err := runLlamaCommand(ctx, appArgs, args, nil); err != nil {
+		os.Remove(tmpFile)
+		logger.Printf("Error building base KV cache: %v", err)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: failed to build base cache: %v", err))), nil
+	}
+	if _, err := os.Stat(tmpFile); err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: llama-cli did not write a prompt cache file")), nil
+	}
+
+	sum := sha256.Sum256([]byte(arguments.Prompt))
+	info := BaseCacheInfo{
+		Model:        effectiveModel(completion),
+		PrefixSHA256: hex.EncodeToString(sum[:]),
+		PrefixBytes:  len(arguments.Prompt),
+		CreatedAt:    time.Now().UTC(),
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode base cache info: %w", err)
+	}
+
+	// Make sure the one-time load has run so it can't overwrite the new metadata later
+	loadBaseCacheInfo()
+
+	// Swap the cache and its metadata while no request can pick up a mismatched pair
+	baseCacheMu.Lock()
+	defer baseCacheMu.Unlock()
+	if err := os.Rename(tmpFile, appArgs.BaseKVCache); err != nil {
+		os.Remove(tmpFile)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: failed to install base cache: %v", err))), nil
+	}
+	if err := os.WriteFile(baseCacheInfoFile(), data, 0644); err != nil {
+		baseCacheInfo = nil
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: failed to write %s: %v", baseCacheInfoFile(), err))), nil
+	}
+	baseCacheInfo = &info
+
+	logger.Printf("Built base KV cache %s in %v", appArgs.BaseKVCache, time.Since(start).Round(time.Millisecond))
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
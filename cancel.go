@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// activeRequest tracks an in-flight completion that can be canceled
+type activeRequest struct {
+	cancel     context.CancelFunc // Cancels the request's context, stopping llama-cli
+	promptHash string             // SHA-256 of the prompt, for clients without a request id
+	owner      string             // Name of the auth token that started the request, "" without auth
+}
+
+// Registry of in-flight completions, indexed by request id
+var (
+	activeRequests   = make(map[string]*activeRequest)
+	activeRequestsMu sync.Mutex
+)
+
+// CancelCompletionArguments defines the input structure for the MCP cancel_completion tool
+type CancelCompletionArguments struct {
+	RequestID  string `json:"request_id,omitempty" description:"Id of the in-flight request to cancel"`
+	PromptHash string `json:"prompt_hash,omitempty" description:"Hex SHA-256 of the prompt, used when the request id is unknown"`
+}
+
+// CancelCompletionResult is the JSON document returned by the cancel_completion tool
+type CancelCompletionResult struct {
+	Canceled   bool     `json:"canceled"`              // Whether at least one request was canceled
+	RequestIDs []string `json:"request_ids,omitempty"` // Ids of the canceled requests
+}
+
+// hashPrompt returns the hex SHA-256 of a prompt, matching what clients send as prompt_hash.
+//
+// Parameters:
+//   - prompt: The prompt text
+//
+// Returns:
+//   - string: The lowercase hex digest
+func hashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// registerActiveRequest derives a cancelable context for a completion, tagged with
+// the request id, and records it in the registry. The returned release function must
+// be called when the request finishes to remove the entry and free the context.
+//
+// Parameters:
+//   - parent: The parent context for the request
+//   - requestID: The request's unique id
+//   - prompt: The prompt text, indexed by hash for cancel-by-prompt
+//   - owner: The auth token name that may cancel the request (see requestOwner)
+//
+// Returns:
+//   - context.Context: The cancelable request context carrying the request id
+//   - func(): Releases the registry entry
+func registerActiveRequest(parent context.Context, requestID, prompt, owner string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.WithValue(parent, requestIDKey{}, requestID))
+
+	entry := &activeRequest{cancel: cancel, promptHash: hashPrompt(prompt), owner: owner}
+	activeRequestsMu.Lock()
+	activeRequests[requestID] = entry
+	activeRequestsMu.Unlock()
+
+	return ctx, func() {
+		activeRequestsMu.Lock()
+		if activeRequests[requestID] == entry {
+			delete(activeRequests, requestID)
+		}
+		activeRequestsMu.Unlock()
+		cancel()
+	}
+}
+
+// requestOwner returns the name of the auth token a tool call was made with, recorded
+// as the owner of the requests it starts.
+//
+// Parameters:
+//   - ctx: The tool call context
+//
+// Returns:
+//   - string: The token name, or "" when auth is disabled
+func requestOwner(ctx context.Context) string {
+	if token := authTokenFromContext(ctx); token != nil {
+		return token.Name
+	}
+	return ""
+}
+
+// mayCancel reports whether a caller may cancel a request: its owner, an admin token,
+// or anyone when auth is disabled.
+//
+// Parameters:
+//   - request: The in-flight request
+//   - caller: The caller's auth token, or nil when auth is disabled
+//
+// Returns:
+//   - bool: Whether the request may be canceled
+func mayCancel(request *activeRequest, caller *AuthToken) bool {
+	return caller == nil || caller.Admin || request.owner == caller.Name
+}
+
+// requestIDActive reports whether a request with the given id is in flight.
+//
+// Parameters:
+//   - requestID: The request id
+//
+// Returns:
+//   - bool: True if the id is registered
+func requestIDActive(requestID string) bool {
+	activeRequestsMu.Lock()
+	defer activeRequestsMu.Unlock()
+	_, ok := activeRequests[requestID]
+	return ok
+}
+
+// maxRequestIDLength bounds client-supplied request ids
+const maxRequestIDLength = 128
+
+// validateRequestID checks a client-supplied request id. Ids name history dump files
+// and appear in every log line, so they are limited to letters, digits, - and _.
+//
+// Parameters:
+//   - requestID: The requested id; "" is valid and means one is generated
+//
+// Returns:
+//   - error: A descriptive error for an unusable id
+func validateRequestID(requestID string) error {
+	if requestID == "" {
+		return nil
+	}
+	if len(requestID) > maxRequestIDLength || !dumpIDPattern.MatchString(requestID) {
+		return fmt.Errorf("invalid request_id: must be at most %d letters, digits, - or _", maxRequestIDLength)
+	}
+	return nil
+}
+
+// newRequestID generates a random (version 4) UUID for a request.
+//
+// Returns:
+//   - string: The UUID in its canonical 8-4-4-4-12 form
+func newRequestID() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		// crypto/rand failing is unrecoverable for id generation; fall back to a job id
+		return newJobID()
+	}
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16])
+}
+
+// cancelByPromptHash cancels in-flight requests whose prompt hashes match, among those
+// the caller may cancel. When more than one request matches, CancelAmbiguousPolicy
+// decides whether all of them are canceled ("all") or the call is rejected ("error").
+//
+// Parameters:
+//   - promptHash: Hex SHA-256 of the prompt
+//   - caller: The caller's auth token, or nil when auth is disabled
+//
+// Returns:
+//   - []string: Ids of the canceled requests
+//   - error: An error if the match is ambiguous and the policy forbids canceling all
+func cancelByPromptHash(promptHash string, caller *AuthToken) ([]string, error) {
+	activeRequestsMu.Lock()
+	defer activeRequestsMu.Unlock()
+
+	var matches []string
+	for id, request := range activeRequests {
+		if request.promptHash == promptHash && mayCancel(request, caller) {
+			matches = append(matches, id)
+		}
+	}
+
+	if len(matches) > 1 && appArgs.CancelAmbiguousPolicy != "all" {
+		return nil, fmt.Errorf("prompt hash matches %d in-flight requests; cancel by request_id instead", len(matches))
+	}
+	for _, id := range matches {
+		activeRequests[id].cancel()
+	}
+	return matches, nil
+}
+
+// cancelByRequestID cancels the in-flight request with the given id. Another token's
+// request is treated as not found, so its id is not revealed.
+//
+// Parameters:
+//   - requestID: The request id to cancel
+//   - caller: The caller's auth token, or nil when auth is disabled
+//
+// Returns:
+//   - bool: Whether a matching request was found and canceled
+func cancelByRequestID(requestID string, caller *AuthToken) bool {
+	activeRequestsMu.Lock()
+	defer activeRequestsMu.Unlock()
+
+	request, ok := activeRequests[requestID]
+	if !ok || !mayCancel(request, caller) {
+		return false
+	}
+	request.cancel()
+	return true
+}
+
+// cancelAllActiveRequests cancels every in-flight request, used when draining for
+// shutdown runs out of time.
+//
+// Returns:
+//   - int: Number of requests canceled
+func cancelAllActiveRequests() int {
+	activeRequestsMu.Lock()
+	defer activeRequestsMu.Unlock()
+
+	for _, request := range activeRequests {
+		request.cancel()
+	}
+	return len(activeRequests)
+}
+
+// handleCancelCompletionTool cancels an in-flight completion by request id, or by
+// prompt hash for clients that cannot supply a request id. With auth enabled a token
+// can only cancel its own requests, unless it is an admin token.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token when auth is enabled
+//   - arguments: The request id or prompt hash identifying the completion
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON result listing the canceled request ids
+//   - error: Any error that occurred while encoding the response
+func handleCancelCompletionTool(ctx context.Context, arguments CancelCompletionArguments) (*mcpgolang.ToolResponse, error) {
+	caller := authTokenFromContext(ctx)
+	var result CancelCompletionResult
+	switch {
+	case arguments.RequestID != "":
+		if cancelByRequestID(arguments.RequestID, caller) {
+			result.RequestIDs = []string{arguments.RequestID}
+		}
+	case arguments.PromptHash != "":
+		ids, err := cancelByPromptHash(arguments.PromptHash, caller)
+		if err != nil {
+			return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+		}
+		result.RequestIDs = ids
+	default:
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: request_id or prompt_hash is required")), nil
+	}
+
+	result.Canceled = len(result.RequestIDs) > 0
+	logger.Printf("Cancel request (id=%q, hash=%.12s) canceled %d request(s)", arguments.RequestID, arguments.PromptHash, len(result.RequestIDs))
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cancel result: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// Chat message roles accepted by generate_chat_completion
+const (
+	ChatRoleSystem    = "system"
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+// DefaultChatTemplate is used when neither the request, ChatTemplateVal nor the model's
+// GGUF metadata names a known template
+const DefaultChatTemplate = "chatml"
+
+// ChatMessage is one turn of a chat conversation
+type ChatMessage struct {
+	Role    string `json:"role" description:"Who wrote the message: system, user or assistant"`
+	Content string `json:"content" description:"The message text"`
+}
+
+// ChatCompletionArguments defines the input structure for the MCP generate_chat_completion tool
+type ChatCompletionArguments struct {
+	Messages     []ChatMessage `json:"messages" description:"The conversation so far, oldest first; the reply continues it as the assistant"`
+	ChatTemplate string        `json:"chat_template,omitempty" description:"Prompt format: chatml, llama3, mistral, gemma or phi3 (default ChatTemplateVal, else detected from the model)"`
+
+	Model          string   `json:"model,omitempty" description:"Model path or registry name (overrides default)"`
+	Predict        int      `json:"predict,omitempty" description:"Number of tokens to generate"`
+	Temperature    float64  `json:"temperature,omitempty" description:"Creativity/randomness control"`
+	TopK           int      `json:"top_k,omitempty" description:"Top-K sampling"`
+	TopP           float64  `json:"top_p,omitempty" description:"Top-P (nucleus) sampling"`
+	MinP           float64  `json:"min_p,omitempty" description:"Min-P sampling in [0, 1]"`
+	RepeatPenalty  float64  `json:"repeat_penalty,omitempty" description:"Repetition penalty"`
+	Seed           *int     `json:"seed,omitempty" description:"Random seed for a reproducible reply"`
+	Stop           []string `json:"stop,omitempty" description:"Stop generating at the first occurrence of any of these strings"`
+	Grammar        string   `json:"grammar,omitempty" description:"GBNF grammar the reply must match"`
+	JsonSchema     string   `json:"json_schema,omitempty" description:"JSON schema the reply must conform to"`
+	Stream         bool     `json:"stream,omitempty" description:"Stream the reply line by line as progress notifications (requires Accept: text/event-stream)"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty" description:"Request timeout in seconds (capped by MaxTimeoutSeconds)"`
+	IncludeUsage   bool     `json:"include_usage,omitempty" description:"Also return prompt and completion token counts"`
+}
+
+// chatTemplate describes how one prompt format lays out a conversation
+type chatTemplate struct {
+	turn        func(role, content string) string // Renders one finished message
+	generation  string                            // Opens the assistant's reply at the end of the prompt
+	mergeSystem bool                              // No system role: system text is prepended to the next user message
+	marker      string                            // Text only this format's Jinja template contains, for detection
+}
+
+// chatTemplates lists the prompt formats generate_chat_completion can render. Beginning
+// of sequence tokens are left out since llama-cli adds the model's own
+var chatTemplates = map[string]chatTemplate{
+	"chatml": {
+		turn:       func(role, content string) string { return "<|im_start|>" + role + "\n" + content + "<|im_end|>\n" },
+		generation: "<|im_start|>assistant\n",
+		marker:     "<|im_start|>",
+	},
+	"llama3": {
+		turn: func(role, content string) string {
+			return "<|start_header_id|>" + role + "<|end_header_id|>\n\n" + content + "<|eot_id|>"
+		},
+		generation: "<|start_header_id|>assistant<|end_header_id|>\n\n",
+		marker:     "<|start_header_id|>",
+	},
+	"mistral": {
+		turn: func(role, content string) string {
+			if role == ChatRoleAssistant {
+				return content + "</s>"
+			}
+			return "[INST] " + content + " [/INST]"
+		},
+		mergeSystem: true,
+		marker:      "[INST]",
+	},
+	"gemma": {
+		turn: func(role, content string) string {
+			if role == ChatRoleAssistant {
+				role = "model"
+			}
+			return "<start_of_turn>" + role + "\n" + content + "<end_of_turn>\n"
+		},
+		generation:  "<start_of_turn>model\n",
+		mergeSystem: true,
+		marker:      "<start_of_turn>",
+	},
+	"phi3": {
+		turn:       func(role, content string) string { return "<|" + role + "|>\n" + content + "<|end|>\n" },
+		generation: "<|assistant|>\n",
+		marker:     "<|end|>",
+	},
+}
+
+// chatTemplateDetectionOrder is the order detection tries templates in; phi3's marker is
+// the most generic, so it goes last
+var chatTemplateDetectionOrder = []string{"chatml", "llama3", "gemma", "mistral", "phi3"}
+
+// chatTemplateNames returns the known template names in a stable order for messages.
+//
+// Returns:
+//   - string: The names, comma-separated
+func chatTemplateNames() string {
+	names := make([]string, 0, len(chatTemplates))
+	for name := range chatTemplates {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// detectChatTemplate picks the prompt format matching the Jinja chat template stored in
+// a model's GGUF metadata (tokenizer.chat_template).
+//
+// Parameters:
+//   - model: The model file
+//
+// Returns:
+//   - string: The template name, empty when the model has no recognizable template
+func detectChatTemplate(model string) string {
+	header, err := readGGUFHeader(model)
+	if err != nil {
+		logger.Printf("Cannot read chat template of %s: %v", filepath.Base(model), err)
+		return ""
+	}
+	jinja, _ := header.Metadata["tokenizer.chat_template"].(string)
+	if jinja == "" {
+		return ""
+	}
+	for _, name := range chatTemplateDetectionOrder {
+		if strings.Contains(jinja, chatTemplates[name].marker) {
+			return name
+		}
+	}
+	return ""
+}
+
+// resolveChatTemplate picks the template for a request: the requested one, else
+// ChatTemplateVal, else the one detected from the model, else DefaultChatTemplate.
+//
+// Parameters:
+//   - requested: The request's chat_template, possibly empty
+//   - model: The resolved model file
+//
+// Returns:
+//   - string: The template name
+//   - error: ErrInvalidArguments if the requested template is unknown
+func resolveChatTemplate(requested, model string) (string, error) {
+	if requested != "" {
+		if _, ok := chatTemplates[requested]; !ok {
+			return "", fmt.Errorf("%w: unknown chat_template %q, must be one of %s", ErrInvalidArguments, requested, chatTemplateNames())
+		}
+		return requested, nil
+	}
+	if configured := llamaCliArgs.ChatTemplateVal; configured != "" {
+		if _, ok := chatTemplates[configured]; ok {
+			return configured, nil
+		}
+		logger.Printf("Warning: ChatTemplateVal %q is not a known chat template, detecting it from the model", configured)
+	}
+	if detected := detectChatTemplate(model); detected != "" {
+		return detected, nil
+	}
+	return DefaultChatTemplate, nil
+}
+
+// renderChatPrompt lays out a conversation in a template's prompt format, ending with
+// the opening of the assistant's reply.
+//
+// Parameters:
+//   - messages: The conversation, oldest first
+//   - name: The template name
+//
+// Returns:
+//   - string: The prompt
+//   - error: ErrInvalidArguments for an empty conversation, an unknown role, a
+//     conversation without a user message, or a system message the template cannot place
+func renderChatPrompt(messages []ChatMessage, name string) (string, error) {
+	if len(messages) == 0 {
+		return "", fmt.Errorf("%w: messages cannot be empty", ErrInvalidArguments)
+	}
+	template := chatTemplates[name]
+
+	var prompt strings.Builder
+	system, hasUser := "", false
+	for i, message := range messages {
+		switch message.Role {
+		case ChatRoleSystem:
+			if template.mergeSystem {
+				system = strings.TrimSpace(system + "\n\n" + message.Content)
+				continue
+			}
+		case ChatRoleUser:
+			hasUser = true
+			if system != "" {
+				message.Content, system = system+"\n\n"+message.Content, ""
+			}
+		case ChatRoleAssistant:
+		default:
+			return "", fmt.Errorf("%w: messages[%d] has role %q, must be system, user or assistant", ErrInvalidArguments, i, message.Role)
+		}
+		prompt.WriteString(template.turn(message.Role, message.Content))
+	}
+	if system != "" {
+		return "", fmt.Errorf("%w: the %s template needs a user message after the system message", ErrInvalidArguments, name)
+	}
+	if !hasUser {
+		return "", fmt.Errorf("%w: messages must include a user message", ErrInvalidArguments)
+	}
+	prompt.WriteString(template.generation)
+	return prompt.String(), nil
+}
+
+// handleChatCompletionTool renders a chat conversation with the model's chat template
+// and generates the assistant's reply through the generate_completion path, so limits,
+// caching, metrics and output cleaning (including stripping the echoed prompt) apply.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token and progress token
+//   - arguments: The conversation and sampling parameters
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The assistant's reply or an error message
+//   - error: Any error that occurred while encoding the response
+func handleChatCompletionTool(ctx context.Context, arguments ChatCompletionArguments) (*mcpgolang.ToolResponse, error) {
+	completion := CompletionArguments{
+		Model:          arguments.Model,
+		Predict:        arguments.Predict,
+		Temperature:    arguments.Temperature,
+		TopK:           arguments.TopK,
+		TopP:           arguments.TopP,
+		MinP:           arguments.MinP,
+		RepeatPenalty:  arguments.RepeatPenalty,
+		Seed:           arguments.Seed,
+		Stop:           arguments.Stop,
+		Grammar:        arguments.Grammar,
+		JsonSchema:     arguments.JsonSchema,
+		Stream:         arguments.Stream,
+		TimeoutSeconds: arguments.TimeoutSeconds,
+		IncludeUsage:   arguments.IncludeUsage,
+	}
+
+	// Resolve and authorize the model before reading its chat template
+	model := llamaCliArgs.ModelFullPathVal
+	if arguments.Model != "" {
+		resolved, err := resolveModelPath(arguments.Model)
+		if err != nil {
+			return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+		}
+		model = resolved
+	}
+	if token := authTokenFromContext(ctx); !modelAllowedForToken(token, model) {
+		logger.Printf("Token %q is not permitted to use model %q", token.Name, model)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: model %q is not permitted for this token", filepath.Base(model)))), nil
+	}
+
+	name, err := resolveChatTemplate(arguments.ChatTemplate, model)
+	if err != nil {
+		return completionErrorResponse(err, completion), nil
+	}
+	completion.Prompt, err = renderChatPrompt(arguments.Messages, name)
+	if err != nil {
+		return completionErrorResponse(err, completion), nil
+	}
+	logger.Printf("Rendered %d chat message(s) for %s with the %s template", len(arguments.Messages), filepath.Base(model), name)
+
+	return handleCompletionTool(ctx, completion)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// inflightCompletion is a completion being generated on behalf of every identical
+// request that arrived while it ran
+type inflightCompletion struct {
+	done   chan struct{}    // Closed once result and err are set
+	once   sync.Once        // Publishes the outcome exactly once
+	result CompletionResult // The shared completion
+	err    error            // The shared failure
+}
+
+// In-flight completions by coalescing key; an entry lives from the first request's
+// arrival until its result is published
+var (
+	inflightCompletions   = make(map[string]*inflightCompletion)
+	inflightCompletionsMu sync.Mutex // Guards inflightCompletions
+)
+
+// coalesceKey returns the key under which concurrent requests share one execution.
+// Requests with an idempotency key share by that key, scoped to the authenticated token
+// so tokens never see each other's output. Other requests share only when they are
+// identical and deterministic, since a random sample must not be handed to every caller.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token
+//   - arguments: The completion request as received
+//
+// Returns:
+//   - string: The key, or "" when the request must run on its own
+func coalesceKey(ctx context.Context, arguments CompletionArguments) string {
+	if arguments.SplitStrategy != "" {
+		return ""
+	}
+	if arguments.IdempotencyKey != "" {
+		scope := ""
+		if token := authTokenFromContext(ctx); token != nil {
+			scope = token.Name
+		}
+		return "idempotency:" + scope + ":" + arguments.IdempotencyKey
+	}
+	hash, transformed, err := resolvedRequestHash(arguments)
+	if err != nil || !isDeterministic(resolveArguments(transformed)) {
+		return ""
+	}
+	return "request:" + hash
+}
+
+// joinInflightCompletion looks up the in-flight completion for a key, starting one when
+// there is none. The caller that starts it must publish its outcome with finish.
+//
+// Parameters:
+//   - key: The key from coalesceKey; "" never coalesces
+//
+// Returns:
+//   - *inflightCompletion: The shared completion, nil for an empty key
+//   - bool: True if the caller started it and must run the completion
+func joinInflightCompletion(key string) (*inflightCompletion, bool) {
+	if key == "" {
+		return nil, true
+	}
+
+	inflightCompletionsMu.Lock()
+	defer inflightCompletionsMu.Unlock()
+	if call, ok := inflightCompletions[key]; ok {
+		return call, false
+	}
+	call := &inflightCompletion{done: make(chan struct{})}
+	inflightCompletions[key] = call
+	return call, true
+}
+
+// finish publishes the outcome to every waiting request and retires the key, so
+// requests arriving afterwards run again (or hit the response cache). Only the first
+// call has an effect, so the starting request can also defer it for early returns.
+//
+// Parameters:
+//   - key: The key the completion was started under
+//   - result: The completion
+//   - err: The failure, shared with every waiter
+func (c *inflightCompletion) finish(key string, result CompletionResult, err error) {
+	if c == nil {
+		return
+	}
+	c.once.Do(func() {
+		inflightCompletionsMu.Lock()
+		delete(inflightCompletions, key)
+		inflightCompletionsMu.Unlock()
+
+		c.result, c.err = result, err
+		close(c.done)
+	})
+}
+
+// wait blocks until the shared completion finishes or the waiting request is done.
+//
+// Parameters:
+//   - ctx: The waiting request's context
+//
+// Returns:
+//   - CompletionResult: The shared completion
+//   - error: The shared failure, or ctx.Err() if the waiting request ended first
+func (c *inflightCompletion) wait(ctx context.Context) (CompletionResult, error) {
+	select {
+	case <-c.done:
+		return c.result, c.err
+	case <-ctx.Done():
+		return CompletionResult{}, ctx.Err()
+	}
+}
+
+// sharedResult returns a completion produced for another request (an identical request
+// in flight, or the response cache) as reported to this one. The output and the
+// parameters that generated it, including the seed, stay as they ran; the fields that
+// only describe how this request was handled are replaced with its own.
+//
+// Parameters:
+//   - result: The shared completion
+//   - arguments: The request receiving it
+//
+// Returns:
+//   - CompletionResult: The completion with this request's own handling fields
+func sharedResult(result CompletionResult, arguments CompletionArguments) CompletionResult {
+	resolved := &result.Resolved
+	resolved.RequestID = arguments.RequestID
+	resolved.Priority = arguments.Priority
+	if resolved.Priority == "" {
+		resolved.Priority = PriorityNormal
+	}
+	resolved.TimeoutSeconds = arguments.TimeoutSeconds
+	resolved.IdempotencyKey = arguments.IdempotencyKey
+	resolved.DebugLog = arguments.DebugLog
+	resolved.Stream = arguments.Stream
+	resolved.OutputSections, resolved.IncludeRaw = arguments.OutputSections, arguments.IncludeRaw
+	resolved.SeparateReasoning = arguments.SeparateReasoning
+	resolved.IncludeUsage, resolved.IncludeMetadata = arguments.IncludeUsage, arguments.IncludeMetadata
+	resolved.MaxOutputChars = arguments.MaxOutputChars
+	resolved.IncludeRequestHash = arguments.IncludeRequestHash
+	resolved.EchoRequest, resolved.EchoPrompt = arguments.EchoRequest, arguments.EchoPrompt
+	resolved.IncludePrefix = arguments.IncludePrefix
+	return result
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Per-model semaphores, keyed by resolved model path. Requests for the same model
+// serialize up to its parallelism while different models run concurrently. Requests
+// waiting for a slot are listed in arrival order so they can report their position.
+var (
+	modelSlots   = make(map[string]chan struct{})
+	modelQueues  = make(map[string][]*queueTracker)
+	modelSlotsMu sync.Mutex
+)
+
+// Server-wide completion slots limiting concurrent requests to MaxConcurrentRequests
+// across all models. Requests that find every slot taken wait in a FIFO queue, and a
+// freed slot is handed straight to the request at its head so later arrivals cannot
+// overtake it.
+var (
+	requestSlotsInUse int              // Slots held by running requests
+	requestQueue      []*requestWaiter // Requests waiting for a slot, in arrival order
+	requestSlotsMu    sync.Mutex       // Guards requestSlotsInUse and requestQueue
+)
+
+// requestWaiter is a request waiting in the server-wide queue
+type requestWaiter struct {
+	tracker *queueTracker // The request's queue tracker
+	ready   chan struct{} // Closed when a slot is handed to the request
+	moved   chan struct{} // Signaled when requests ahead leave the queue
+}
+
+// queueTrackerKey is the context key carrying a request's queue tracker
+type queueTrackerKey struct{}
+
+// queueTracker lets the owner of a request observe its place in a model's wait queue
+type queueTracker struct {
+	mu            sync.Mutex
+	key           string // Model queue the request is waiting in; empty when not waiting
+	limit         int    // Parallelism of that model
+	requestQueued bool   // Whether the request is waiting in the server-wide queue
+
+	onQueued func(QueueStatus) // Optional; called by the waiting request when it joins or moves up the server-wide queue
+}
+
+// QueueStatus reports a waiting request's place in its model's queue
+type QueueStatus struct {
+	Position             int     `json:"position"`               // 1 is next in line
+	EstimatedWaitSeconds float64 `json:"estimated_wait_seconds"` // Rough estimate from the average request duration
+}
+
+// withQueueTracker attaches a new queue tracker to a request context.
+//
+// Parameters:
+//   - ctx: The request context
+//
+// Returns:
+//   - context.Context: The context carrying the tracker
+//   - *queueTracker: The tracker, to be queried with status
+func withQueueTracker(ctx context.Context) (context.Context, *queueTracker) {
+	tracker := &queueTracker{}
+	return context.WithValue(ctx, queueTrackerKey{}, tracker), tracker
+}
+
+// status returns the tracked request's current queue position and estimated wait,
+// in the server-wide queue or its model's queue. The estimate assumes each slot frees
+// up after the average request duration.
+//
+// Returns:
+//   - *QueueStatus: The queue status, or nil when the request is not waiting
+func (t *queueTracker) status() *QueueStatus {
+	t.mu.Lock()
+	key, limit, requestQueued := t.key, t.limit, t.requestQueued
+	t.mu.Unlock()
+
+	position := 0
+	switch {
+	case requestQueued:
+		limit = appArgs.MaxConcurrentRequests
+		requestSlotsMu.Lock()
+		for i, waiting := range requestQueue {
+			if waiting.tracker == t {
+				position = i + 1
+				break
+			}
+		}
+		requestSlotsMu.Unlock()
+	case key != "":
+		modelSlotsMu.Lock()
+		for i, waiting := range modelQueues[key] {
+			if waiting == t {
+				position = i + 1
+				break
+			}
+		}
+		modelSlotsMu.Unlock()
+	}
+	if position == 0 {
+		return nil
+	}
+
+	rounds := (position + limit - 1) / limit
+	wait := metricsSnapshot().AverageDuration() * time.Duration(rounds)
+	return &QueueStatus{Position: position, EstimatedWaitSeconds: wait.Seconds()}
+}
+
+// modelParallelism returns how many requests may run concurrently on a model: the
+// parallelism of the registry entry for that model file, else DefaultModelParallelism.
+//
+// Parameters:
+//   - model: The resolved model path
+//
+// Returns:
+//   - int: The allowed concurrency; non-positive means unlimited
+func modelParallelism(model string) int {
+	for _, entry := range registryEntriesFor(model) {
+		if entry.Parallelism != 0 {
+			return entry.Parallelism
+		}
+	}
+	return appArgs.DefaultModelParallelism
+}
+
+// acquireModelSlot waits for a free slot on a model's semaphore. The wait is bounded
+// by the caller's timeout, after which the request is turned away like one that found
+// no server-wide slot; waiting also stops when the context is canceled.
+//
+// Parameters:
+//   - ctx: Context whose cancellation abandons the wait
+//   - model: The resolved model path
+//   - timeoutSeconds: The caller's timeout, such as requestTimeoutSeconds for a completion
+//
+// Returns:
+//   - func(): Releases the slot; a no-op when the model is unlimited
+//   - error: ErrServerBusy wrapping context.DeadlineExceeded when no slot freed up in
+//     time, or the context error
+func acquireModelSlot(ctx context.Context, model string, timeoutSeconds int) (func(), error) {
+	limit := modelParallelism(model)
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	key := filepath.Clean(model)
+	modelSlotsMu.Lock()
+	slots, ok := modelSlots[key]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		modelSlots[key] = slots
+	}
+	modelSlotsMu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	default:
+	}
+
+	// Join the model's queue; requests without a tracker still count towards positions
+	tracker, ok := ctx.Value(queueTrackerKey{}).(*queueTracker)
+	if !ok {
+		tracker = &queueTracker{}
+	}
+	tracker.mu.Lock()
+	tracker.key, tracker.limit = key, limit
+	tracker.mu.Unlock()
+	modelSlotsMu.Lock()
+	modelQueues[key] = append(modelQueues[key], tracker)
+	position := len(modelQueues[key])
+	modelSlotsMu.Unlock()
+	defer leaveModelQueue(tracker)
+
+	logger.Printf("Waiting up to %d seconds for a free slot on model %s (parallelism %d, queue position %d)", timeoutSeconds, filepath.Base(model), limit, position)
+	timer := time.NewTimer(time.Duration(timeoutSeconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-timer.C:
+		metricsRequestRejected()
+		return nil, fmt.Errorf("%w: all %d slots on model %s stayed in use for %d seconds, retry later (%w)", ErrServerBusy, limit, filepath.Base(model), timeoutSeconds, context.DeadlineExceeded)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// acquireRequestSlot waits for one of the MaxConcurrentRequests server-wide completion
+// slots, queueing behind earlier requests. The wait is bounded by the caller's timeout,
+// after which the request leaves the queue and is turned away; requests that had to wait
+// and requests turned away are counted in the metrics. A request with a queue tracker
+// (see withQueueTracker) reports its position through it.
+//
+// Parameters:
+//   - ctx: Context whose cancellation abandons the wait
+//   - timeoutSeconds: The caller's timeout, such as requestTimeoutSeconds for a completion
+//
+// Returns:
+//   - func(): Releases the slot; a no-op when the limit is disabled
+//   - error: ErrServerBusy wrapping context.DeadlineExceeded when no slot freed up in
+//     time, or the context error
+func acquireRequestSlot(ctx context.Context, timeoutSeconds int) (func(), error) {
+	if appArgs.MaxConcurrentRequests <= 0 {
+		return func() {}, nil
+	}
+
+	requestSlotsMu.Lock()
+	if requestSlotsInUse < appArgs.MaxConcurrentRequests && len(requestQueue) == 0 {
+		requestSlotsInUse++
+		requestSlotsMu.Unlock()
+		return releaseRequestSlot, nil
+	}
+
+	// Join the queue; requests without a tracker still count towards positions
+	tracker, ok := ctx.Value(queueTrackerKey{}).(*queueTracker)
+	if !ok {
+		tracker = &queueTracker{}
+	}
+	tracker.mu.Lock()
+	tracker.requestQueued = true
+	tracker.mu.Unlock()
+	waiter := &requestWaiter{tracker: tracker, ready: make(chan struct{}), moved: make(chan struct{}, 1)}
+	requestQueue = append(requestQueue, waiter)
+	position := len(requestQueue)
+	requestSlotsMu.Unlock()
+
+	metricsRequestQueued()
+	requestLogf(ctx, "All %d completion slots in use, waiting up to %d seconds at queue position %d", appArgs.MaxConcurrentRequests, timeoutSeconds, position)
+	tracker.notifyQueued()
+
+	timer := time.NewTimer(time.Duration(timeoutSeconds) * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-waiter.ready:
+			return releaseRequestSlot, nil
+		case <-waiter.moved:
+			tracker.notifyQueued()
+		case <-timer.C:
+			if !leaveRequestQueue(waiter) {
+				// A slot was handed over as the wait ran out
+				return releaseRequestSlot, nil
+			}
+			metricsRequestRejected()
+			return nil, fmt.Errorf("%w: all %d completion slots stayed in use for %d seconds, retry later (%w)", ErrServerBusy, appArgs.MaxConcurrentRequests, timeoutSeconds, context.DeadlineExceeded)
+		case <-ctx.Done():
+			if !leaveRequestQueue(waiter) {
+				// A slot was handed over as the request ended; pass it on
+				releaseRequestSlot()
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// releaseRequestSlot frees a server-wide completion slot, handing it to the request at
+// the head of the queue when one is waiting.
+func releaseRequestSlot() {
+	requestSlotsMu.Lock()
+	if len(requestQueue) == 0 {
+		requestSlotsInUse--
+		requestSlotsMu.Unlock()
+		return
+	}
+	next := requestQueue[0]
+	requestQueue = requestQueue[1:]
+	moved := slices.Clone(requestQueue)
+	requestSlotsMu.Unlock()
+
+	next.tracker.mu.Lock()
+	next.tracker.requestQueued = false
+	next.tracker.mu.Unlock()
+	close(next.ready)
+	signalQueueMoved(moved)
+}
+
+// leaveRequestQueue removes a request from the server-wide queue when it stops waiting.
+//
+// Parameters:
+//   - waiter: The waiting request
+//
+// Returns:
+//   - bool: False if the request was no longer queued because a slot was handed to it
+func leaveRequestQueue(waiter *requestWaiter) bool {
+	requestSlotsMu.Lock()
+	i := slices.Index(requestQueue, waiter)
+	if i < 0 {
+		requestSlotsMu.Unlock()
+		return false
+	}
+	requestQueue = slices.Delete(requestQueue, i, i+1)
+	moved := slices.Clone(requestQueue[i:])
+	requestSlotsMu.Unlock()
+
+	waiter.tracker.mu.Lock()
+	waiter.tracker.requestQueued = false
+	waiter.tracker.mu.Unlock()
+	signalQueueMoved(moved)
+	return true
+}
+
+// signalQueueMoved tells waiting requests that they moved up the server-wide queue.
+// Signals are coalesced, so a waiter reports its latest position once.
+//
+// Parameters:
+//   - waiters: The requests whose position changed
+func signalQueueMoved(waiters []*requestWaiter) {
+	for _, waiter := range waiters {
+		select {
+		case waiter.moved <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyQueued reports the tracked request's current place in the server-wide queue to
+// its onQueued callback, if it has one and is still waiting.
+func (t *queueTracker) notifyQueued() {
+	if t.onQueued == nil {
+		return
+	}
+	if status := t.status(); status != nil {
+		t.onQueued(*status)
+	}
+}
+
+// requestQueueDepth returns how many requests are waiting for a server-wide slot.
+//
+// Returns:
+//   - int: The number of queued requests
+func requestQueueDepth() int {
+	requestSlotsMu.Lock()
+	defer requestSlotsMu.Unlock()
+	return len(requestQueue)
+}
+
+// leaveModelQueue removes a request from its model's wait queue.
+//
+// Parameters:
+//   - tracker: The request's queue tracker
+func leaveModelQueue(tracker *queueTracker) {
+	tracker.mu.Lock()
+	key := tracker.key
+	tracker.key = ""
+	tracker.mu.Unlock()
+
+	modelSlotsMu.Lock()
+	defer modelSlotsMu.Unlock()
+	queue := modelQueues[key]
+	for i, waiting := range queue {
+		if waiting == tracker {
+			modelQueues[key] = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(modelQueues[key]) == 0 {
+		delete(modelQueues, key)
+	}
+}
+
+// modelLoad returns how busy a model is: requests running on it plus requests waiting
+// for one of its slots. Models without a parallelism limit have no slots to count, so
+// the number of running llama.cpp processes server-wide is used instead.
+//
+// Parameters:
+//   - model: The resolved model path
+//
+// Returns:
+//   - int: The current load
+func modelLoad(model string) int {
+	if modelParallelism(model) <= 0 {
+		return int(activeProcesses.Load())
+	}
+
+	key := filepath.Clean(model)
+	modelSlotsMu.Lock()
+	defer modelSlotsMu.Unlock()
+	return len(modelSlots[key]) + len(modelQueues[key])
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"strconv"
+)
+
+// MinAutoContextSize is the smallest context AutoContextSize will choose
+const MinAutoContextSize = 512
+
+// autoContextSize picks the smallest power-of-two context that fits the prompt plus
+// the predict budget, capped at AutoContextSizeMax. It leaves the request unchanged
+// when the feature is off, the client set ctx_size, the prompt comes from a file,
+// the predict budget is unbounded, or the tokenizer pre-pass fails.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the tokenizer pre-pass
+//   - arguments: The transformed completion request
+//
+// Returns:
+//   - CompletionArguments: The request, with CtxSize set when a size was chosen
+func autoContextSize(ctx context.Context, arguments CompletionArguments) CompletionArguments {
+	if !appArgs.AutoContextSize || arguments.CtxSize > 0 || arguments.PromptFile != "" {
+		return arguments
+	}
+
+	predict := arguments.Predict
+	if predict <= 0 {
+		predict, _ = strconv.Atoi(llamaCliArgs.PredictVal)
+	}
+	if predict <= 0 {
+		logger.Println("AutoContextSize: predict budget is unbounded, using configured context size")
+		return arguments
+	}
+
+	tokens, err := tokenize(ctx, CountTokensArguments{Prompt: arguments.Prompt + arguments.AssistantPrefix, Model: arguments.Model})
+	if err != nil {
+		logger.Printf("AutoContextSize: tokenizer pre-pass failed, using configured context size: %v", err)
+		return arguments
+	}
+
+	needed := len(tokens) + predict
+	size := MinAutoContextSize
+	for size < needed {
+		size *= 2
+	}
+	if appArgs.AutoContextSizeMax > 0 && size > appArgs.AutoContextSizeMax {
+		size = appArgs.AutoContextSizeMax
+	}
+
+	logger.Printf("AutoContextSize: prompt %d tokens + predict %d, using ctx-size %d", len(tokens), predict, size)
+	arguments.CtxSize = size
+	return arguments
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// debugLogKey is the context key carrying a request's debug logger
+type debugLogKey struct{}
+
+// debugLogMu serializes rotation and opening of debug log files
+var debugLogMu sync.Mutex
+
+// validateDebugLogName checks that a debug_log name stays inside DebugLogPath.
+//
+// Parameters:
+//   - name: The requested file name
+//
+// Returns:
+//   - error: A descriptive error for absolute paths or names escaping the directory
+func validateDebugLogName(name string) error {
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("invalid debug_log %q: must be a relative file name inside the debug log directory", name)
+	}
+	return nil
+}
+
+// debugLogDir returns the directory debug_log files are confined to.
+//
+// Returns:
+//   - string: DebugLogPath, or AppLogPath/debug when unset
+func debugLogDir() string {
+	if appArgs.DebugLogPath != "" {
+		return appArgs.DebugLogPath
+	}
+	return filepath.Join(appArgs.AppLogPath, "debug")
+}
+
+// attachDebugLog opens the request's debug_log file, rotating it to "<name>.1" once it
+// exceeds DebugLogMaxBytes, and attaches a logger for it to the context. Open failures
+// are logged and the request continues without a debug log.
+//
+// Parameters:
+//   - ctx: The request context
+//   - arguments: The completion request; nothing is attached without debug_log
+//
+// Returns:
+//   - context.Context: The context, carrying the debug logger when one was opened
+//   - func(): Closes the debug log file
+func attachDebugLog(ctx context.Context, arguments CompletionArguments) (context.Context, func()) {
+	if arguments.DebugLog == "" || validateDebugLogName(arguments.DebugLog) != nil {
+		return ctx, func() {}
+	}
+	path := filepath.Join(debugLogDir(), arguments.DebugLog)
+
+	debugLogMu.Lock()
+	if info, err := os.Stat(path); err == nil && appArgs.DebugLogMaxBytes > 0 && info.Size() > appArgs.DebugLogMaxBytes {
+		if err := os.Rename(path, path+".1"); err != nil {
+			logger.Printf("Warning: could not rotate debug log %s: %v", path, err)
+		}
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	var file *os.File
+	if err == nil {
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	}
+	debugLogMu.Unlock()
+	if err != nil {
+		logger.Printf("Warning: could not open debug log %s: %v", path, err)
+		return ctx, func() {}
+	}
+
+	debugLogger := log.New(file, fmt.Sprintf("[%s] ", requestIDFromContext(ctx)), log.LstdFlags|log.Lmicroseconds)
+	if data, err := json.Marshal(redactArguments(arguments)); err == nil {
+		debugLogger.Printf("Request arguments: %s", data)
+	}
+	return context.WithValue(ctx, debugLogKey{}, debugLogger), func() { file.Close() }
+}
+
+// debugLogf writes a line to the request's debug log only, if it has one.
+//
+// Parameters:
+//   - ctx: The request context
+//   - format: The log format string
+//   - v: The format arguments
+func debugLogf(ctx context.Context, format string, v ...any) {
+	if debugLogger, ok := ctx.Value(debugLogKey{}).(*log.Logger); ok {
+		debugLogger.Printf(format, v...)
+	}
+}
+
+// requestLogf writes a line to the server log, tagged with the request id, and tees it
+// to the request's debug log.
+//
+// Parameters:
+//   - ctx: The request context
+//   - format: The log format string
+//   - v: The format arguments
+func requestLogf(ctx context.Context, format string, v ...any) {
+	outputWithFields(2, requestFields(requestIDFromContext(ctx)), fmt.Sprintf(format, v...))
+	debugLogf(ctx, format, v...)
+}
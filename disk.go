@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// cacheWritesDisabled is set when free space on the prompt cache volume drops
+// below DiskMinFreeMB; prompt cache flags are then omitted from llama-cli runs
+var cacheWritesDisabled atomic.Bool
+
+// checkDiskSpace inspects free space on the prompt cache and log volumes, logging a
+// warning below DiskWarnFreeMB and disabling prompt cache writes below DiskMinFreeMB.
+// Cache writes are re-enabled automatically once space is freed.
+func checkDiskSpace() {
+	volumes := []struct {
+		name string
+		path string
+	}{
+		{"prompt cache", appArgs.PromptCachePath},
+		{"log", appArgs.AppLogPath},
+	}
+
+	for _, volume := range volumes {
+		if volume.path == "" {
+			continue
+		}
+
+		free, err := freeDiskBytes(volume.path)
+		if err != nil {
+			logger.Printf("Disk check for %s volume (%s) unavailable: %v", volume.name, volume.path, err)
+			continue
+		}
+
+		freeMB := int64(free / (1024 * 1024))
+		belowMin := appArgs.DiskMinFreeMB > 0 && freeMB < int64(appArgs.DiskMinFreeMB)
+		switch {
+		case belowMin:
+			logger.Printf("Warning: %s volume (%s) has %d MB free, below the %d MB minimum", volume.name, volume.path, freeMB, appArgs.DiskMinFreeMB)
+		case appArgs.DiskWarnFreeMB > 0 && freeMB < int64(appArgs.DiskWarnFreeMB):
+			logger.Printf("Warning: %s volume (%s) is low on space: %d MB free", volume.name, volume.path, freeMB)
+		default:
+			logger.Printf("Disk status: %s volume (%s) has %d MB free", volume.name, volume.path, freeMB)
+		}
+
+		// Only the cache volume gates behaviour; a full log volume is reported but not actionable here
+		if volume.path == appArgs.PromptCachePath {
+			if previous := cacheWritesDisabled.Swap(belowMin); previous != belowMin {
+				if belowMin {
+					logger.Println("Prompt cache writes disabled until disk space is freed")
+				} else {
+					logger.Println("Prompt cache writes re-enabled")
+				}
+			}
+		}
+	}
+}
+
+// startDiskMonitor runs checkDiskSpace every DiskCheckIntervalSeconds until the
+// context is canceled. A non-positive interval disables periodic checks.
+//
+// Parameters:
+//   - ctx: Context whose cancellation stops the monitor
+func startDiskMonitor(ctx context.Context) {
+	if appArgs.DiskCheckIntervalSeconds <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(appArgs.DiskCheckIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkDiskSpace()
+			}
+		}
+	}()
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "errors"
+
+// freeDiskBytes is not implemented on this platform; disk checks are skipped.
+//
+// Parameters:
+//   - path: Any path on the volume to inspect
+//
+// Returns:
+//   - uint64: Always zero
+//   - error: Always an unsupported-platform error
+func freeDiskBytes(path string) (uint64, error) {
+	return 0, errors.New("free space checks are not supported on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import "syscall"
+
+// freeDiskBytes returns the number of bytes available to unprivileged users on the
+// filesystem containing path.
+//
+// Parameters:
+//   - path: Any path on the volume to inspect
+//
+// Returns:
+//   - uint64: Available bytes
+//   - error: Any error returned by statfs
+func freeDiskBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
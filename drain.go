@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// drainCancelGrace is how long a forced drain waits for canceled completions to
+// return their responses
+const drainCancelGrace = 5 * time.Second
+
+// In-flight completion tracking for draining on shutdown
+var (
+	inFlightCompletions sync.WaitGroup // Synchronous requests and async jobs still running
+	draining            atomic.Bool    // Set once shutdown starts; new completions are refused
+	drainMu             sync.Mutex     // Orders starting a completion against starting the drain
+)
+
+// trackCompletion counts a completion as in flight so shutdown waits for it.
+//
+// Returns:
+//   - func(): Marks the completion finished; nil when refused
+//   - error: ErrShuttingDown once the server has started draining
+func trackCompletion() (func(), error) {
+	drainMu.Lock()
+	defer drainMu.Unlock()
+	if draining.Load() {
+		return nil, ErrShuttingDown
+	}
+	inFlightCompletions.Add(1)
+	return inFlightCompletions.Done, nil
+}
+
+// drainCompletions stops new completions from starting and waits up to timeout for the
+// in-flight ones to finish. Completions still running at the deadline are canceled,
+// so their clients get a cancellation error instead of a dropped connection.
+//
+// Parameters:
+//   - timeout: How long to let in-flight completions run
+//
+// Returns:
+//   - bool: Whether every completion finished on its own
+func drainCompletions(timeout time.Duration) bool {
+	drainMu.Lock()
+	draining.Store(true)
+	drainMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		inFlightCompletions.Wait()
+		close(done)
+	}()
+
+	logger.Printf("Draining in-flight completions (up to %v)...", timeout)
+	select {
+	case <-done:
+		logger.Println("All in-flight completions finished")
+		return true
+	case <-time.After(timeout):
+	}
+
+	canceled := cancelAllActiveRequests()
+	logger.Printf("Drain timed out, canceled %d in-flight completion(s)", canceled)
+	select {
+	case <-done:
+	case <-time.After(drainCancelGrace):
+		logger.Println("Canceled completions did not finish in time")
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strconv"
+)
+
+// defaultLlamaTemperature is the temperature llama-cli samples at when it is not passed
+// one; prepareLlamaArgs never passes a temperature of 0
+const defaultLlamaTemperature = 0.8
+
+// resolveArguments fills a request's unset parameters with the server defaults and
+// applies the same clamps as prepareLlamaArgs, giving the parameters that actually ran.
+//
+// Parameters:
+//   - arguments: The completion request after prompt transforms and context sizing
+//
+// Returns:
+//   - CompletionArguments: The request with defaults filled in
+func resolveArguments(arguments CompletionArguments) CompletionArguments {
+	arguments.Model = effectiveModel(arguments)
+	if arguments.Priority == "" {
+		arguments.Priority = PriorityNormal
+	}
+
+	if arguments.Threads <= 0 {
+		arguments.Threads, _ = strconv.Atoi(llamaCliArgs.ThreadsVal)
+	}
+	if arguments.ThreadsBatch <= 0 {
+		arguments.ThreadsBatch, _ = strconv.Atoi(llamaCliArgs.ThreadsBatchVal)
+	}
+	if arguments.GpuLayers <= 0 {
+		arguments.GpuLayers, _ = strconv.Atoi(llamaCliArgs.GPULayersVal)
+	}
+	if arguments.SplitMode == "" && validateSplitMode(llamaCliArgs.SplitModeCmdVal) == nil {
+		arguments.SplitMode = llamaCliArgs.SplitModeCmdVal
+	}
+	if mainGPU, err := strconv.Atoi(llamaCliArgs.MainGPUVal); arguments.MainGPU == nil && err == nil {
+		arguments.MainGPU = &mainGPU
+	}
+	if len(arguments.TensorSplit) == 0 && llamaCliArgs.TensorSplitVal != "" {
+		if ratios, err := parseTensorSplit(llamaCliArgs.TensorSplitVal); err == nil && validateTensorSplit(ratios) == nil {
+			arguments.TensorSplit = ratios
+		}
+	}
+	if arguments.CtxSize <= 0 {
+		arguments.CtxSize, _ = strconv.Atoi(llamaCliArgs.CtxSizeVal)
+	}
+	if maxCtx := modelMaxContext(arguments.Model); maxCtx > 0 && arguments.CtxSize > maxCtx {
+		arguments.CtxSize = maxCtx
+	}
+	if arguments.Keep == 0 {
+		arguments.Keep, _ = strconv.Atoi(llamaCliArgs.KeepVal)
+	}
+	if arguments.RopeScaling == "" && validateRopeScaling(llamaCliArgs.RopeScalingCmdVal) == nil {
+		arguments.RopeScaling = llamaCliArgs.RopeScalingCmdVal
+	}
+	if arguments.RopeScale == 0 {
+		arguments.RopeScale, _ = strconv.ParseFloat(llamaCliArgs.RopeScaleVal, 64)
+	}
+	if arguments.YarnOrigContext == 0 {
+		arguments.YarnOrigContext, _ = strconv.Atoi(llamaCliArgs.YarnOrigContextCmdVal)
+	}
+	if arguments.BatchSize <= 0 {
+		arguments.BatchSize, _ = strconv.Atoi(llamaCliArgs.BatchCmdVal)
+	}
+	if arguments.UBatchSize <= 0 {
+		arguments.UBatchSize, _ = strconv.Atoi(llamaCliArgs.UBatchCmdVal)
+	}
+	if arguments.CpuMask == "" && llamaCliArgs.CpuMaskVal != "" && validateCpuMask(llamaCliArgs.CpuMaskVal) == nil {
+		arguments.CpuMask = llamaCliArgs.CpuMaskVal
+	}
+	if arguments.CpuRange == "" && llamaCliArgs.CpuRangeVal != "" && validateCpuRange(llamaCliArgs.CpuRangeVal) == nil {
+		arguments.CpuRange = llamaCliArgs.CpuRangeVal
+	}
+
+	if arguments.Predict <= 0 {
+		arguments.Predict, _ = strconv.Atoi(llamaCliArgs.PredictVal)
+	}
+	if arguments.Temperature <= 0 {
+		arguments.Temperature, _ = strconv.ParseFloat(llamaCliArgs.TemperatureVal, 64)
+	}
+	if arguments.Temperature <= 0 {
+		arguments.Temperature = defaultLlamaTemperature
+	}
+	if arguments.TopK <= 0 {
+		arguments.TopK, _ = strconv.Atoi(llamaCliArgs.TopKVal)
+	}
+	if arguments.TopP <= 0 {
+		arguments.TopP, _ = strconv.ParseFloat(llamaCliArgs.TopPVal, 64)
+	}
+	if arguments.MinP == 0 {
+		arguments.MinP, _ = strconv.ParseFloat(llamaCliArgs.MinPVal, 64)
+	}
+	if arguments.TypicalP == 0 {
+		arguments.TypicalP, _ = strconv.ParseFloat(llamaCliArgs.TypicalPVal, 64)
+	}
+	if arguments.Tfs == 0 {
+		arguments.Tfs, _ = strconv.ParseFloat(llamaCliArgs.TfsVal, 64)
+	}
+	if arguments.RepeatPenalty <= 0 {
+		arguments.RepeatPenalty, _ = strconv.ParseFloat(llamaCliArgs.RepeatPenaltyVal, 64)
+	}
+	if arguments.Mirostat == 0 && llamaCliArgs.MirostatCmd != "" {
+		arguments.Mirostat, _ = strconv.Atoi(llamaCliArgs.MirostatVal)
+	}
+	if arguments.Mirostat != 0 && arguments.MirostatTau == 0 {
+		arguments.MirostatTau, _ = strconv.ParseFloat(llamaCliArgs.MirostatTauVal, 64)
+	}
+	if arguments.Mirostat != 0 && arguments.MirostatEta == 0 {
+		arguments.MirostatEta, _ = strconv.ParseFloat(llamaCliArgs.MirostatEtaVal, 64)
+	}
+	if arguments.DynatempRange == 0 && llamaCliArgs.DynatempRangeCmd != "" {
+		arguments.DynatempRange, _ = strconv.ParseFloat(llamaCliArgs.DynatempRangeVal, 64)
+	}
+	if arguments.DynatempRange != 0 && arguments.DynatempExp == 0 {
+		arguments.DynatempExp, _ = strconv.ParseFloat(llamaCliArgs.DynatempExpVal, 64)
+	}
+	if len(arguments.Samplers) == 0 {
+		if samplers := parseSamplers(llamaCliArgs.SamplersVal); validateSamplers(samplers) == nil {
+			arguments.Samplers = samplers
+		}
+	}
+	if arguments.RepeatLastN == 0 {
+		arguments.RepeatLastN, _ = strconv.Atoi(llamaCliArgs.RepeatLastPenaltyVal)
+	}
+
+	if arguments.FlashAttention == nil {
+		flashAttention := llamaCliArgs.FlashAttentionCmdEnabled
+		arguments.FlashAttention = &flashAttention
+	}
+	if arguments.StopOnDoubleNewline == nil {
+		stopOnDoubleNewline := appArgs.StopOnDoubleNewline
+		arguments.StopOnDoubleNewline = &stopOnDoubleNewline
+	}
+	if (arguments.Seed == nil || *arguments.Seed < 0) && arguments.ConversationID != "" && arguments.Turn >= 0 && llamaCliArgs.RandomSeedCmd != "" {
+		seed := int(conversationSeed(arguments.ConversationID, arguments.Turn))
+		arguments.Seed = &seed
+	}
+	return arguments
+}
+
+// echoArguments prepares resolved arguments for the echo_request response block. Prompt
+// content is replaced with RedactionPlaceholder unless the request set echo_prompt.
+//
+// Parameters:
+//   - resolved: The resolved request parameters
+//   - includePrompt: Whether to return the prompt text as-is
+//
+// Returns:
+//   - CompletionArguments: The arguments to echo
+func echoArguments(resolved CompletionArguments, includePrompt bool) CompletionArguments {
+	if includePrompt {
+		return resolved
+	}
+	for _, field := range []*string{&resolved.Prompt, &resolved.AssistantPrefix, &resolved.SplitInstruction} {
+		if *field != "" {
+			*field = appArgs.RedactionPlaceholder
+		}
+	}
+	return resolved
+}
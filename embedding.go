@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// embeddingSeparator keeps llama-embedding from splitting a text into one embedding
+// per line (its default separator is a newline)
+const embeddingSeparator = "<#embSep#>"
+
+// EmbeddingArguments defines the input structure for the MCP generate_embedding tool
+type EmbeddingArguments struct {
+	Text  any    `json:"text" jsonschema:"oneof_type=string;array" description:"Text to embed, or an array of texts embedded one after another"`
+	Model string `json:"model,omitempty" description:"Embedding model path or registry name (overrides EmbeddingModelPathVal)"`
+}
+
+// EmbeddingItem is the embedding of one input text, or why it could not be computed
+type EmbeddingItem struct {
+	Index     int       `json:"index"`               // Position of the text in the request
+	Embedding []float64 `json:"embedding,omitempty"` // The embedding vector
+	Error     string    `json:"error,omitempty"`     // Set when this text failed
+}
+
+// EmbeddingResult is the JSON document returned by the generate_embedding tool
+type EmbeddingResult struct {
+	Model      string          `json:"model"`      // Model file the embeddings were computed with
+	Embeddings []EmbeddingItem `json:"embeddings"` // One entry per input text, in request order
+}
+
+// embeddingCliPath returns the llama-embedding executable to use: EmbeddingCliPath when
+// configured, otherwise llama-embedding next to llama-cli.
+//
+// Returns:
+//   - string: Path to the embedding executable
+func embeddingCliPath() string {
+	if appArgs.EmbeddingCliPath != "" {
+		return appArgs.EmbeddingCliPath
+	}
+	name := "llama-embedding"
+	if strings.EqualFold(filepath.Ext(appArgs.LLamaCliPath), ".exe") {
+		name += ".exe"
+	}
+	return filepath.Join(filepath.Dir(appArgs.LLamaCliPath), name)
+}
+
+// embeddingModel returns the model an embedding request runs with: the override
+// (resolved through the model registry and confined to ModelPath), else
+// EmbeddingModelPathVal, else the default model.
+//
+// Parameters:
+//   - model: The request's model override, possibly empty
+//
+// Returns:
+//   - string: The model path
+//   - error: An error if the override escapes ModelPath
+func embeddingModel(model string) (string, error) {
+	if model != "" {
+		return resolveModelPath(model)
+	}
+	if llamaCliArgs.EmbeddingModelPathVal != "" {
+		return llamaCliArgs.EmbeddingModelPathVal, nil
+	}
+	return llamaCliArgs.ModelFullPathVal, nil
+}
+
+// embeddingTexts normalizes the text argument, which may be a string or an array of strings.
+//
+// Parameters:
+//   - text: The decoded text argument
+//
+// Returns:
+//   - []string: The texts to embed
+//   - error: An error if text is neither a string nor an array of strings
+func embeddingTexts(text any) ([]string, error) {
+	switch value := text.(type) {
+	case string:
+		return []string{value}, nil
+	case []any:
+		texts := make([]string, len(value))
+		for i, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("text[%d] is not a string", i)
+			}
+			texts[i] = s
+		}
+		return texts, nil
+	default:
+		return nil, fmt.Errorf("text must be a string or an array of strings")
+	}
+}
+
+// prepareEmbeddingArgs builds the llama-embedding arguments for one text, the
+// embedding counterpart of prepareLlamaArgs. Output is requested as JSON so the
+// vector can be parsed exactly.
+//
+// Parameters:
+//   - text: The text to embed
+//   - model: The resolved model path
+//
+// Returns:
+//   - []string: The llama-embedding argument list
+func prepareEmbeddingArgs(text, model string) []string {
+	args := []string{
+		"--model", model,
+		llamaCliArgs.PromptCmd, text,
+		"--embd-separator", embeddingSeparator,
+		"--embd-output-format", "json",
+		"--log-disable",
+	}
+	if llamaCliArgs.EmbeddingCmd != "" {
+		args = append(args, llamaCliArgs.EmbeddingCmd)
+	}
+	return args
+}
+
+// parseEmbedding extracts the vector from llama-embedding's JSON output
+// ({"data": [{"embedding": [...]}]}). Any log lines around the document are ignored.
+//
+// Parameters:
+//   - output: The llama-embedding standard output
+//
+// Returns:
+//   - []float64: The embedding vector
+//   - error: An error if no embedding could be found
+func parseEmbedding(output string) ([]float64, error) {
+	start := strings.Index(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("unexpected llama-embedding output: %.200s", output)
+	}
+
+	var document struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &document); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding: %w", err)
+	}
+	if len(document.Data) == 0 || len(document.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("llama-embedding returned no embedding")
+	}
+	return document.Data[0].Embedding, nil
+}
+
+// embed computes the embedding of one text, waiting for a MaxConcurrentRequests slot
+// and a slot on the model like a completion would.
+//
+// Parameters:
+//   - text: The text to embed
+//   - model: The resolved model path
+//
+// Returns:
+//   - []float64: The embedding vector
+//   - error: Any execution or parse error
+func embed(text, model string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	timeoutSeconds := completionTimeoutSeconds(PriorityNormal)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+
+	releaseRequestSlot, err := acquireRequestSlot(ctx, timeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseRequestSlot()
+
+	releaseSlot, err := acquireModelSlot(ctx, model, timeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseSlot()
+
+	embeddingArgs := appArgs
+	embeddingArgs.LLamaCliPath = embeddingCliPath()
+	output, err := GenerateSingleCompletionWithCancel(ctx, embeddingArgs, prepareEmbeddingArgs(text, model))
+	if err != nil {
+		return nil, err
+	}
+	return parseEmbedding(string(output))
+}
+
+// handleEmbeddingTool computes embeddings for retrieval. An array of texts is embedded
+// one text at a time; a failing text is reported in its own entry without failing
+// the rest of the batch.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token when auth is enabled
+//   - arguments: The text or texts to embed and an optional model override
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON {"model", "embeddings"} or an error message
+//   - error: Any error that occurred while encoding the response
+func handleEmbeddingTool(ctx context.Context, arguments EmbeddingArguments) (*mcpgolang.ToolResponse, error) {
+	texts, err := embeddingTexts(arguments.Text)
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+	if len(texts) == 0 {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: text cannot be empty")), nil
+	}
+
+	model, err := embeddingModel(arguments.Model)
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+	if token := authTokenFromContext(ctx); !modelAllowedForToken(token, model) {
+		logger.Printf("Token %q is not permitted to use model %q", token.Name, model)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: model %q is not permitted for this token", filepath.Base(model)))), nil
+	}
+
+	// Count the batch as in flight so shutdown drains it
+	finishCompletion, err := trackCompletion()
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v; retry the request", err))), nil
+	}
+	defer finishCompletion()
+
+	logger.Printf("Generating %d embedding(s) with %s", len(texts), filepath.Base(model))
+	result := EmbeddingResult{Model: filepath.Base(model), Embeddings: make([]EmbeddingItem, len(texts))}
+	for i, text := range texts {
+		result.Embeddings[i].Index = i
+		vector, err := embed(text, model)
+		if err != nil {
+			logger.Printf("Error generating embedding %d: %v", i, redactText(err.Error()))
+			result.Embeddings[i].Error = err.Error()
+			continue
+		}
+		result.Embeddings[i].Embedding = vector
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode embeddings: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
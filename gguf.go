@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// ggufMagic is "GGUF" read as a little-endian uint32
+const ggufMagic = 0x46554747
+
+// Limits guarding the parser against malformed files claiming huge sizes
+const (
+	ggufMaxStringLength = 64 << 20 // Longest metadata string (chat templates and the like are well below)
+	ggufMaxCount        = 1 << 28  // Most key/value pairs, tensors, array elements or tensor dimensions
+)
+
+// GGUF metadata value types
+const (
+	ggufTypeUint8 uint32 = iota
+	ggufTypeInt8
+	ggufTypeUint16
+	ggufTypeInt16
+	ggufTypeUint32
+	ggufTypeInt32
+	ggufTypeFloat32
+	ggufTypeBool
+	ggufTypeString
+	ggufTypeArray
+	ggufTypeUint64
+	ggufTypeInt64
+	ggufTypeFloat64
+)
+
+// ggufFileTypes names llama.cpp's general.file_type values (llama_ftype)
+var ggufFileTypes = map[uint64]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1",
+	10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S", 15: "Q4_K_M",
+	16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K", 19: "IQ2_XXS", 20: "IQ2_XS", 21: "Q2_K_S",
+	22: "IQ3_XS", 23: "IQ3_XXS", 24: "IQ1_S", 25: "IQ4_NL", 26: "IQ3_S", 27: "IQ3_M",
+	28: "IQ2_S", 29: "IQ2_M", 30: "IQ4_XS", 31: "IQ1_M", 32: "BF16", 36: "TQ1_0", 37: "TQ2_0",
+}
+
+// ErrMalformedGGUF is returned when a file is not a readable GGUF model
+var ErrMalformedGGUF = errors.New("malformed GGUF file")
+
+// GGUFHeader is the parsed header of a GGUF file: its metadata table and the total
+// element count of its tensors
+type GGUFHeader struct {
+	Version        uint32         // GGUF format version (1-3)
+	TensorCount    uint64         // Number of tensors in the file
+	ParameterCount uint64         // Sum of the tensors' element counts
+	Metadata       map[string]any // Metadata values; arrays are summarized as their length
+}
+
+// ggufReader decodes GGUF's little-endian primitives, turning a short read into a
+// truncation error
+type ggufReader struct {
+	r       *bufio.Reader
+	version uint32
+}
+
+// read decodes one fixed-size value.
+func (g *ggufReader) read(value any) error {
+	if err := binary.Read(g.r, binary.LittleEndian, value); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("%w: file is truncated", ErrMalformedGGUF)
+		}
+		return err
+	}
+	return nil
+}
+
+// count decodes a length or count, which is 32-bit in version 1 and 64-bit after,
+// rejecting values too large to be genuine.
+func (g *ggufReader) count(what string) (uint64, error) {
+	var n uint64
+	if g.version == 1 {
+		var n32 uint32
+		if err := g.read(&n32); err != nil {
+			return 0, err
+		}
+		n = uint64(n32)
+	} else if err := g.read(&n); err != nil {
+		return 0, err
+	}
+	if n > ggufMaxCount {
+		return 0, fmt.Errorf("%w: %s %d is too large", ErrMalformedGGUF, what, n)
+	}
+	return n, nil
+}
+
+// string decodes a length-prefixed string.
+func (g *ggufReader) string() (string, error) {
+	n, err := g.count("string length")
+	if err != nil {
+		return "", err
+	}
+	if n > ggufMaxStringLength {
+		return "", fmt.Errorf("%w: string length %d is too large", ErrMalformedGGUF, n)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(g.r, buf); err != nil {
+		return "", fmt.Errorf("%w: file is truncated", ErrMalformedGGUF)
+	}
+	return string(buf), nil
+}
+
+// readGGUFValue decodes one fixed-size value of type T.
+func readGGUFValue[T any](g *ggufReader) (T, error) {
+	var v T
+	err := g.read(&v)
+	return v, err
+}
+
+// finiteFloat returns a float metadata value, or its text for NaN and infinities,
+// which JSON cannot encode.
+func finiteFloat(v float64) any {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
+// value decodes one metadata value of the given type. Arrays are read through but
+// only their length is kept, since the large ones (tokenizer vocabularies) are not
+// useful to report.
+func (g *ggufReader) value(valueType uint32) (any, error) {
+	switch valueType {
+	case ggufTypeUint8:
+		return readGGUFValue[uint8](g)
+	case ggufTypeInt8:
+		return readGGUFValue[int8](g)
+	case ggufTypeUint16:
+		return readGGUFValue[uint16](g)
+	case ggufTypeInt16:
+		return readGGUFValue[int16](g)
+	case ggufTypeUint32:
+		return readGGUFValue[uint32](g)
+	case ggufTypeInt32:
+		return readGGUFValue[int32](g)
+	case ggufTypeFloat32:
+		v, err := readGGUFValue[float32](g)
+		if err != nil {
+			return nil, err
+		}
+		return finiteFloat(float64(v)), nil
+	case ggufTypeBool:
+		v, err := readGGUFValue[uint8](g)
+		if err != nil {
+			return nil, err
+		}
+		return v != 0, nil
+	case ggufTypeString:
+		return g.string()
+	case ggufTypeUint64:
+		return readGGUFValue[uint64](g)
+	case ggufTypeInt64:
+		return readGGUFValue[int64](g)
+	case ggufTypeFloat64:
+		v, err := readGGUFValue[float64](g)
+		if err != nil {
+			return nil, err
+		}
+		return finiteFloat(v), nil
+	case ggufTypeArray:
+		var elemType uint32
+		if err := g.read(&elemType); err != nil {
+			return nil, err
+		}
+		if elemType == ggufTypeArray {
+			return nil, fmt.Errorf("%w: nested arrays are not supported", ErrMalformedGGUF)
+		}
+		n, err := g.count("array length")
+		if err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < n; i++ {
+			if _, err := g.value(elemType); err != nil {
+				return nil, err
+			}
+		}
+		return fmt.Sprintf("[array of %d]", n), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown value type %d", ErrMalformedGGUF, valueType)
+	}
+}
+
+// readGGUFHeader parses a GGUF file's header (magic, version, metadata key/value table
+// and tensor infos) without reading the tensor data.
+//
+// Parameters:
+//   - path: The model file
+//
+// Returns:
+//   - GGUFHeader: The parsed header
+//   - error: An error wrapping ErrMalformedGGUF if the file is not valid GGUF or is
+//     truncated, or the error opening it
+func readGGUFHeader(path string) (GGUFHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return GGUFHeader{}, err
+	}
+	defer file.Close()
+
+	g := &ggufReader{r: bufio.NewReaderSize(file, 1<<16)}
+	var magic uint32
+	if err := g.read(&magic); err != nil {
+		return GGUFHeader{}, err
+	}
+	if magic != ggufMagic {
+		return GGUFHeader{}, fmt.Errorf("%w: bad magic number 0x%08x", ErrMalformedGGUF, magic)
+	}
+	if err := g.read(&g.version); err != nil {
+		return GGUFHeader{}, err
+	}
+	if g.version < 1 || g.version > 3 {
+		return GGUFHeader{}, fmt.Errorf("%w: unsupported version %d", ErrMalformedGGUF, g.version)
+	}
+
+	header := GGUFHeader{Version: g.version, Metadata: map[string]any{}}
+	if header.TensorCount, err = g.count("tensor count"); err != nil {
+		return GGUFHeader{}, err
+	}
+	kvCount, err := g.count("metadata count")
+	if err != nil {
+		return GGUFHeader{}, err
+	}
+
+	for i := uint64(0); i < kvCount; i++ {
+		key, err := g.string()
+		if err != nil {
+			return GGUFHeader{}, err
+		}
+		var valueType uint32
+		if err := g.read(&valueType); err != nil {
+			return GGUFHeader{}, err
+		}
+		value, err := g.value(valueType)
+		if err != nil {
+			return GGUFHeader{}, fmt.Errorf("metadata %q: %w", key, err)
+		}
+		header.Metadata[key] = value
+	}
+
+	// Tensor infos: name, dimensions, type and data offset
+	for i := uint64(0); i < header.TensorCount; i++ {
+		if _, err := g.string(); err != nil {
+			return GGUFHeader{}, err
+		}
+		var nDims uint32
+		if err := g.read(&nDims); err != nil {
+			return GGUFHeader{}, err
+		}
+		if nDims > 8 {
+			return GGUFHeader{}, fmt.Errorf("%w: tensor %d has %d dimensions", ErrMalformedGGUF, i, nDims)
+		}
+		elements := uint64(1)
+		for d := uint32(0); d < nDims; d++ {
+			dim, err := g.count("tensor dimension")
+			if err != nil {
+				return GGUFHeader{}, err
+			}
+			elements *= dim
+		}
+		var tensorType uint32
+		var offset uint64
+		if err := g.read(&tensorType); err != nil {
+			return GGUFHeader{}, err
+		}
+		if err := g.read(&offset); err != nil {
+			return GGUFHeader{}, err
+		}
+		header.ParameterCount += elements
+	}
+	return header, nil
+}
+
+// ggufUint converts an integer metadata value to uint64.
+//
+// Parameters:
+//   - value: The metadata value
+//
+// Returns:
+//   - uint64: The value
+//   - bool: Whether the value was a non-negative integer
+func ggufUint(value any) (uint64, bool) {
+	switch v := value.(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int8:
+		return uint64(v), v >= 0
+	case int16:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// InspectModelArguments defines the input structure for the MCP inspect_model tool
+type InspectModelArguments struct {
+	Model string `json:"model,omitempty" description:"Model file in ModelPath or registry name (defaults to ModelFullPathVal)"`
+}
+
+// InspectModelResult is the JSON document returned by the inspect_model tool
+type InspectModelResult struct {
+	Model          string         `json:"model"`                     // Model file name
+	GGUFVersion    uint32         `json:"gguf_version"`              // GGUF format version
+	Architecture   string         `json:"architecture,omitempty"`    // general.architecture, e.g. llama or qwen3
+	Name           string         `json:"name,omitempty"`            // general.name
+	ContextLength  uint64         `json:"n_ctx_train,omitempty"`     // <arch>.context_length, the trained context size
+	Quantization   string         `json:"quantization,omitempty"`    // general.file_type as a name such as Q4_K_M
+	ParameterCount uint64         `json:"parameter_count,omitempty"` // Total tensor elements
+	SizeLabel      string         `json:"size_label,omitempty"`      // general.size_label, e.g. 8B
+	TensorCount    uint64         `json:"tensor_count"`              // Number of tensors
+	Metadata       map[string]any `json:"metadata"`                  // All metadata; arrays shown as their length
+}
+
+// inspectModel reads a model's GGUF header and picks out the commonly needed metadata.
+//
+// Parameters:
+//   - path: The model file
+//
+// Returns:
+//   - InspectModelResult: The model's metadata
+//   - error: Any error reading or parsing the header
+func inspectModel(path string) (InspectModelResult, error) {
+	header, err := readGGUFHeader(path)
+	if err != nil {
+		return InspectModelResult{}, err
+	}
+
+	result := InspectModelResult{
+		Model:          filepath.Base(path),
+		GGUFVersion:    header.Version,
+		ParameterCount: header.ParameterCount,
+		TensorCount:    header.TensorCount,
+		Metadata:       header.Metadata,
+	}
+	result.Architecture, _ = header.Metadata["general.architecture"].(string)
+	result.Name, _ = header.Metadata["general.name"].(string)
+	result.SizeLabel, _ = header.Metadata["general.size_label"].(string)
+	if n, ok := ggufUint(header.Metadata[result.Architecture+".context_length"]); ok {
+		result.ContextLength = n
+	}
+	if fileType, ok := ggufUint(header.Metadata["general.file_type"]); ok {
+		if name, known := ggufFileTypes[fileType]; known {
+			result.Quantization = name
+		} else {
+			result.Quantization = fmt.Sprintf("unknown (%d)", fileType)
+		}
+	}
+	return result, nil
+}
+
+// handleInspectModelTool reports a model's GGUF metadata (trained context size,
+// architecture, quantization, parameter count) without launching llama-cli.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token when auth is enabled
+//   - arguments: The model to inspect
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The model's metadata as JSON or an error message
+//   - error: Any error that occurred while encoding the response
+func handleInspectModelTool(ctx context.Context, arguments InspectModelArguments) (*mcpgolang.ToolResponse, error) {
+	model := llamaCliArgs.ModelFullPathVal
+	if arguments.Model != "" {
+		resolved, err := resolveModelPath(arguments.Model)
+		if err != nil {
+			return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+		}
+		model = resolved
+	}
+	if token := authTokenFromContext(ctx); !modelAllowedForToken(token, model) {
+		logger.Printf("Token %q is not permitted to use model %q", token.Name, model)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: model %q is not permitted for this token", filepath.Base(model)))), nil
+	}
+
+	result, err := inspectModel(model)
+	if err != nil {
+		logger.Printf("Error inspecting model %s: %v", model, err)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error inspecting %s: %v", filepath.Base(model), err))), nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode model metadata: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
@@ -3,6 +3,7 @@ module byte-vision-mcp
 go 1.23
 
 require (
+	github.com/gin-gonic/gin v1.8.1
 	github.com/joho/godotenv v1.5.1
 	github.com/metoro-io/mcp-golang v0.12.0
 )
@@ -11,7 +12,6 @@ require (
 	github.com/bahlo/generic-list-go v0.2.0 // indirect
 	github.com/buger/jsonparser v1.1.1 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
-	github.com/gin-gonic/gin v1.8.1 // indirect
 	github.com/go-playground/locales v0.14.0 // indirect
 	github.com/go-playground/universal-translator v0.18.0 // indirect
 	github.com/go-playground/validator/v10 v10.10.0 // indirect
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// grammarArgs returns the llama-cli arguments constraining a request's output: grammar
+// is passed inline with GrammarCmd, grammar_file with GrammarFileCmd, and json_schema
+// with JsonSchemaCmd (llama.cpp converts the schema to a grammar).
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - []string: The constraint arguments, empty when the request has none
+//   - error: An error if more than one constraint is set, a flag is not configured,
+//     the file is missing, or the schema is not valid JSON
+func grammarArgs(arguments CompletionArguments) ([]string, error) {
+	set := 0
+	for _, field := range []string{arguments.Grammar, arguments.GrammarFile, arguments.JsonSchema} {
+		if field != "" {
+			set++
+		}
+	}
+
+	switch {
+	case set > 1:
+		return nil, fmt.Errorf("only one of grammar, grammar_file and json_schema can be used")
+	case arguments.JsonSchema != "":
+		if llamaCliArgs.JsonSchemaCmd == "" {
+			return nil, fmt.Errorf("json_schema is not supported: JsonSchemaCmd is not configured")
+		}
+		if !json.Valid([]byte(arguments.JsonSchema)) {
+			return nil, fmt.Errorf("json_schema is not valid JSON")
+		}
+		return []string{llamaCliArgs.JsonSchemaCmd, arguments.JsonSchema}, nil
+	case arguments.Grammar != "":
+		if llamaCliArgs.GrammarCmd == "" {
+			return nil, fmt.Errorf("grammar is not supported: GrammarCmd is not configured")
+		}
+		return []string{llamaCliArgs.GrammarCmd, arguments.Grammar}, nil
+	case arguments.GrammarFile != "":
+		if llamaCliArgs.GrammarFileCmd == "" {
+			return nil, fmt.Errorf("grammar_file is not supported: GrammarFileCmd is not configured")
+		}
+		if _, err := os.Stat(arguments.GrammarFile); err != nil {
+			return nil, fmt.Errorf("grammar_file: %v", err)
+		}
+		return []string{llamaCliArgs.GrammarFileCmd, arguments.GrammarFile}, nil
+	}
+	return nil, nil
+}
+
+// withGrammarFile moves an inline grammar into a temporary file when llama-cli can only
+// read grammars from files (GrammarCmd empty, GrammarFileCmd set).
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - CompletionArguments: The request, with grammar replaced by grammar_file when moved
+//   - func(): Removes the temporary file; a no-op when none was written
+//   - error: Any error writing the file
+func withGrammarFile(arguments CompletionArguments) (CompletionArguments, func(), error) {
+	if arguments.Grammar == "" || arguments.GrammarFile != "" || llamaCliArgs.GrammarCmd != "" || llamaCliArgs.GrammarFileCmd == "" {
+		return arguments, func() {}, nil
+	}
+
+	file, err := os.CreateTemp("", "byte-vision-grammar-*.gbnf")
+	if err != nil {
+		return arguments, nil, fmt.Errorf("failed to create grammar file: %w", err)
+	}
+	_, err = file.WriteString(arguments.Grammar)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return arguments, nil, fmt.Errorf("failed to write grammar file: %w", err)
+	}
+
+	arguments.GrammarFile, arguments.Grammar = file.Name(), ""
+	return arguments, func() { os.Remove(file.Name()) }, nil
+}
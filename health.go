@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Health states reported by the health endpoint
+const (
+	HealthStatusOK        = "ok"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// HealthStatus is the JSON document returned by the health endpoint
+type HealthStatus struct {
+	Status         string  `json:"status"`          // ok, degraded or unhealthy
+	ErrorRate      float64 `json:"error_rate"`      // Fraction of failed requests within the window
+	RecentRequests int     `json:"recent_requests"` // Finished requests within the window
+	WindowSeconds  int     `json:"window_seconds"`  // Length of the rolling window
+}
+
+// currentHealth derives the server health from the rolling error rate. The rate is
+// only trusted once HealthMinRequests requests have finished within the window, so a
+// single early failure doesn't take an instance out of rotation.
+//
+// Returns:
+//   - HealthStatus: The health document
+//   - int: The HTTP status code (503 when unhealthy, otherwise 200)
+func currentHealth() (HealthStatus, int) {
+	rate, samples := recentErrorRate()
+	health := HealthStatus{
+		Status:         HealthStatusOK,
+		ErrorRate:      rate,
+		RecentRequests: samples,
+		WindowSeconds:  appArgs.HealthWindowSeconds,
+	}
+
+	if samples < appArgs.HealthMinRequests {
+		return health, http.StatusOK
+	}
+	switch {
+	case rate >= appArgs.HealthUnhealthyErrorRate:
+		health.Status = HealthStatusUnhealthy
+		return health, http.StatusServiceUnavailable
+	case rate >= appArgs.HealthDegradedErrorRate:
+		health.Status = HealthStatusDegraded
+	}
+	return health, http.StatusOK
+}
+
+// handleHealth serves the health endpoint.
+//
+// Parameters:
+//   - c: The request context
+func handleHealth(c *gin.Context) {
+	health, code := currentHealth()
+	if health.Status != HealthStatusOK {
+		logger.Printf("Health check reporting %s (error rate %.2f over %d requests)", health.Status, health.ErrorRate, health.RecentRequests)
+	}
+	c.JSON(code, health)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// HistoryEntry captures everything needed to reproduce a finished request
+type HistoryEntry struct {
+	RequestID  string               `json:"request_id"`      // Request or job id
+	Timestamp  time.Time            `json:"timestamp"`       // When the request finished
+	DurationMs int64                `json:"duration_ms"`     // Wall-clock generation time
+	Arguments  CompletionArguments  `json:"arguments"`       // Request arguments after server-side transforms
+	Argv       []string             `json:"argv"`            // Exact llama-cli command line of the last attempt
+	Error      string               `json:"error,omitempty"` // Failure description, empty on success
+	Config     ServerConfigSnapshot `json:"config"`          // Server configuration and llama.cpp build at the time
+}
+
+// Bounded history of recent requests, oldest first
+var (
+	requestHistory   []HistoryEntry
+	requestHistoryMu sync.Mutex
+)
+
+// requestIDKey is the context key carrying the current request id
+type requestIDKey struct{}
+
+// requestIDFromContext returns the request id attached by registerActiveRequest.
+//
+// Parameters:
+//   - ctx: A request context
+//
+// Returns:
+//   - string: The request id, or "" if none is attached
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// recordHistory stores a finished request in the bounded history. It does nothing
+// when HistorySize is not positive or the request has no id.
+//
+// Parameters:
+//   - ctx: The request context carrying the request id
+//   - arguments: The request arguments
+//   - argv: The llama-cli command line that ran
+//   - err: The execution error, or nil on success
+//   - duration: Wall-clock generation time
+func recordHistory(ctx context.Context, arguments CompletionArguments, argv []string, err error, duration time.Duration) {
+	requestID := requestIDFromContext(ctx)
+	if appArgs.HistorySize <= 0 || requestID == "" || argv == nil {
+		return
+	}
+
+	entry := HistoryEntry{
+		RequestID:  requestID,
+		Timestamp:  time.Now(),
+		DurationMs: duration.Milliseconds(),
+		Arguments:  redactArguments(arguments),
+		Argv:       redactArgv(argv),
+		Config:     currentConfigSnapshot(),
+	}
+	if err != nil {
+		entry.Error = redactText(err.Error())
+	}
+
+	requestHistoryMu.Lock()
+	defer requestHistoryMu.Unlock()
+	requestHistory = append(requestHistory, entry)
+	if len(requestHistory) > appArgs.HistorySize {
+		requestHistory = requestHistory[len(requestHistory)-appArgs.HistorySize:]
+	}
+}
+
+// findHistory looks up a request in the in-memory history.
+//
+// Parameters:
+//   - requestID: The request id
+//
+// Returns:
+//   - HistoryEntry: The entry
+//   - bool: Whether it was found
+func findHistory(requestID string) (HistoryEntry, bool) {
+	requestHistoryMu.Lock()
+	defer requestHistoryMu.Unlock()
+	for i := len(requestHistory) - 1; i >= 0; i-- {
+		if requestHistory[i].RequestID == requestID {
+			return requestHistory[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// dumpIDPattern restricts dump file names to plain ids so they can't escape HistoryDumpPath
+var dumpIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// historyDumpFile returns the dump file path for a request id.
+//
+// Parameters:
+//   - requestID: The request id
+//
+// Returns:
+//   - string: The dump file path
+//   - error: An error if the id is not a plain identifier
+func historyDumpFile(requestID string) (string, error) {
+	if !dumpIDPattern.MatchString(requestID) {
+		return "", fmt.Errorf("invalid request_id %q", requestID)
+	}
+	dir := appArgs.HistoryDumpPath
+	if dir == "" {
+		dir = filepath.Join(appArgs.AppLogPath, "request-dumps")
+	}
+	return filepath.Join(dir, requestID+".json"), nil
+}
+
+// DumpRequestArguments defines the input structure for the MCP dump_request tool
+type DumpRequestArguments struct {
+	RequestID string `json:"request_id" description:"Id of a recent request to save for replay"`
+}
+
+// ReplayRequestArguments defines the input structure for the MCP replay_request tool
+type ReplayRequestArguments struct {
+	RequestID string `json:"request_id" description:"Id of a request in the recent history or a saved dump"`
+}
+
+// requireAdmin rejects admin tool calls from non-admin tokens when auth is enabled.
+// Over the stdio transport there are no tokens and the launching client is trusted.
+//
+// Parameters:
+//   - ctx: The tool call context
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: An error response, or nil if the caller may proceed
+func requireAdmin(ctx context.Context) *mcpgolang.ToolResponse {
+	if _, enabled := loadAuthConfig(); !enabled || appArgs.Transport == TransportStdio {
+		return nil
+	}
+	if token := authTokenFromContext(ctx); token != nil && token.Admin {
+		return nil
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: this tool requires an admin token"))
+}
+
+// handleDumpRequestTool saves a recent request, with its argv and a configuration
+// snapshot, to HistoryDumpPath so it can be replayed later.
+//
+// Parameters:
+//   - ctx: The tool call context
+//   - arguments: The id of the request to save
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The dump file path, or an error message
+//   - error: Any error that occurred while encoding the response
+func handleDumpRequestTool(ctx context.Context, arguments DumpRequestArguments) (*mcpgolang.ToolResponse, error) {
+	if denied := requireAdmin(ctx); denied != nil {
+		return denied, nil
+	}
+
+	entry, ok := findHistory(arguments.RequestID)
+	if !ok {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: request %q is not in the recent history", arguments.RequestID))), nil
+	}
+	path, err := historyDumpFile(entry.RequestID)
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request dump: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+		err = os.WriteFile(path, data, 0600)
+	}
+	if err != nil {
+		logger.Printf("Failed to dump request %s: %v", entry.RequestID, err)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error writing dump: %v", err))), nil
+	}
+
+	logger.Printf("Dumped request %s to %s", entry.RequestID, path)
+	result, _ := json.Marshal(map[string]string{"request_id": entry.RequestID, "path": path})
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(result))), nil
+}
+
+// handleReplayRequestTool re-runs a recorded request with its exact llama-cli argv,
+// taken from the recent history or, failing that, from a saved dump.
+//
+// Parameters:
+//   - ctx: The tool call context
+//   - arguments: The id of the request to replay
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The replayed output followed by a JSON summary, or an error message
+//   - error: Any error that occurred while encoding the response
+func handleReplayRequestTool(ctx context.Context, arguments ReplayRequestArguments) (*mcpgolang.ToolResponse, error) {
+	if denied := requireAdmin(ctx); denied != nil {
+		return denied, nil
+	}
+
+	entry, source := HistoryEntry{}, "memory"
+	if found, ok := findHistory(arguments.RequestID); ok {
+		entry = found
+	} else {
+		source = "dump"
+		path, err := historyDumpFile(arguments.RequestID)
+		if err == nil {
+			var data []byte
+			if data, err = os.ReadFile(path); err == nil {
+				err = json.Unmarshal(data, &entry)
+			}
+		}
+		if err != nil {
+			return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: cannot load request %q: %v", arguments.RequestID, err))), nil
+		}
+	}
+	if len(entry.Argv) == 0 {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: recorded request has no command line")), nil
+	}
+
+	// Count the replay as in flight so shutdown drains it, and hold a completion slot
+	// while it runs like any other request
+	finishCompletion, err := trackCompletion()
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v; retry the request", err))), nil
+	}
+	defer finishCompletion()
+
+	timeoutSeconds := requestTimeoutSeconds(entry.Arguments)
+	releaseRequestSlot, err := acquireRequestSlot(ctx, timeoutSeconds)
+	if err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+	defer releaseRequestSlot()
+
+	runCtx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+
+	// Run the recorded argv verbatim, including the binary it was recorded with
+	logger.Printf("Replaying request %s from %s", entry.RequestID, source)
+	replayArgs := appArgs
+	replayArgs.LLamaCliPath = entry.Argv[0]
+	startTime := time.Now()
+	output, err := GenerateSingleCompletionWithCancel(runCtx, replayArgs, entry.Argv[1:])
+
+	summary := map[string]any{
+		"request_id":     entry.RequestID,
+		"source":         source,
+		"duration_ms":    time.Since(startTime).Milliseconds(),
+		"original_error": entry.Error,
+	}
+	if err != nil {
+		summary["error"] = err.Error()
+	}
+	data, jsonErr := json.Marshal(summary)
+	if jsonErr != nil {
+		return nil, fmt.Errorf("failed to encode replay summary: %w", jsonErr)
+	}
+	return &mcpgolang.ToolResponse{
+		Content: []*mcpgolang.Content{
+			mcpgolang.NewTextContent(string(output)),
+			mcpgolang.NewTextContent(string(data)),
+		},
+	}, nil
+}
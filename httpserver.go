@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	mcphttp "github.com/metoro-io/mcp-golang/transport/http"
+)
+
+// newHTTPServer builds the HTTP server that carries the MCP endpoint together with
+// the operational endpoints (health, metrics), so they share HttpPort.
+//
+// Parameters:
+//   - transport: The MCP transport whose handler serves EndPoint
+//
+// Returns:
+//   - *http.Server: The configured, not yet started server
+func newHTTPServer(transport *mcphttp.GinTransport) *http.Server {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// MCP JSON-RPC endpoint, behind bearer-token auth when AuthTokensFile is set and
+	// per-client rate limiting when RateLimitPerMinute is set; clients accepting
+	// text/event-stream can receive streamed output
+	router.POST(appArgs.EndPoint, authMiddleware(), rateLimitMiddleware(), streamingMiddleware(), transport.Handler())
+
+	// Liveness with error-rate based degradation for load balancers
+	if appArgs.HealthEndpoint != "" {
+		router.GET(appArgs.HealthEndpoint, handleHealth)
+	}
+
+	// Readiness for orchestrators: llama-cli and the model file are usable
+	if appArgs.ReadinessEndpoint != "" {
+		router.GET(appArgs.ReadinessEndpoint, handleReadiness)
+	}
+
+	// Prometheus scrape endpoint, unless it has its own MetricsPort
+	if prometheusPath() != "" && newMetricsServer() == nil {
+		router.GET(prometheusPath(), handlePrometheusMetrics)
+	}
+
+	return &http.Server{
+		Addr:    appArgs.HttpPort,
+		Handler: router,
+	}
+}
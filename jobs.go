@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// Job states reported by get_job and in callback payloads
+const (
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCanceled  = "canceled"
+)
+
+// Terminal events reported once a job stops, named like the equivalent SSE events
+const (
+	JobEventDone      = "done"      // Generation finished normally
+	JobEventError     = "error"     // Generation failed or timed out
+	JobEventCancelled = "cancelled" // A cancel request was honored; output holds what was generated until then
+)
+
+// completionJob is an asynchronous completion whose output accumulates while llama-cli runs
+type completionJob struct {
+	mu        sync.Mutex
+	id        string    // Job id returned to the client
+	requestID string    // The request's id, as sent by the client or generated for it
+	status    string    // One of the JobStatus* values
+	event     string    // One of the JobEvent* values once finished
+	output    []byte    // Raw output generated so far (complete once finished)
+	result    string    // Post-processed completion once completed
+	err       string    // Failure description for failed or canceled jobs
+	warnings  []string  // Non-fatal warnings raised for the request
+	usage     *Usage    // Token usage, when requested with include_usage
+	finished  time.Time // When the job stopped running; zero while running
+
+	queue *queueTracker // Position in the model's wait queue while waiting for a slot
+
+	broadcast *jobBroadcaster // Wakes subscribe_job streams on new output; nil without subscribers
+}
+
+// Registry of asynchronous jobs, indexed by job id
+var (
+	jobs   = make(map[string]*completionJob)
+	jobsMu sync.Mutex
+)
+
+// JobStatus is the JSON document returned by get_job and passed to job completion hooks
+type JobStatus struct {
+	JobID        string   `json:"job_id"`             // Job identifier
+	RequestID    string   `json:"request_id"`         // The request's id, as sent by the client or generated for it
+	Status       string   `json:"status"`             // running, completed, failed or canceled
+	Event        string   `json:"event,omitempty"`    // Terminal event once finished: done, error or cancelled
+	Output       string   `json:"output"`             // Raw output from the requested offset onwards, as streamed
+	Result       string   `json:"result,omitempty"`   // Completion text once completed, post-processed like a synchronous response
+	OutputLength int      `json:"output_length"`      // Total bytes of output so far; pass as offset to fetch only new text
+	Error        string   `json:"error,omitempty"`    // Failure description when the job did not complete
+	Warnings     []string `json:"warnings,omitempty"` // Non-fatal warnings raised for the request
+	Usage        *Usage   `json:"usage,omitempty"`    // Token usage once completed, when requested with include_usage
+
+	Queue *QueueStatus `json:"queue,omitempty"` // Queue position while waiting for a model slot
+}
+
+// GetJobArguments defines the input structure for the MCP get_job tool
+type GetJobArguments struct {
+	JobID  string `json:"job_id" description:"Job id returned when the request was accepted"`
+	Offset int    `json:"offset,omitempty" description:"Return output from this byte offset; pass the previous output_length to receive only new text"`
+}
+
+// startJob runs a completion in the background as a pollable job. Output is streamed
+// into the job as it is generated, and the job is registered for cancellation under
+// its id. Finished jobs are kept for JobTTLSeconds.
+//
+// Parameters:
+//   - arguments: The completion request
+//   - owner: The auth token name that may cancel the job (see requestOwner)
+//   - onFinish: Optional hook invoked with the final job status
+//
+// Returns:
+//   - string: The new job id
+func startJob(arguments CompletionArguments, owner string, onFinish func(JobStatus)) string {
+	expireJobs()
+
+	ctx, tracker := withQueueTracker(context.Background())
+	job := &completionJob{id: newJobID(), requestID: arguments.RequestID, status: JobStatusRunning, queue: tracker}
+	jobsMu.Lock()
+	jobs[job.id] = job
+	jobsMu.Unlock()
+
+	// Jobs are drained on shutdown like synchronous requests; the accepting handler is
+	// still counted in flight here, so adding to the wait group cannot race the drain
+	inFlightCompletions.Add(1)
+	go func() {
+		defer inFlightCompletions.Done()
+		startTime := time.Now()
+		// The job is canceled by its job id; logs and history keep the request id
+		ctx, release := registerActiveRequest(ctx, job.id, arguments.Prompt, owner)
+		ctx = context.WithValue(ctx, requestIDKey{}, arguments.RequestID)
+		ctx, closeDebugLog := attachDebugLog(ctx, arguments)
+		defer closeDebugLog()
+		var result CompletionResult
+		releaseRequestSlot, err := acquireRequestSlot(ctx, requestTimeoutSeconds(arguments))
+		if err == nil {
+			result, err = executeStreamingCompletion(ctx, arguments, job.appendOutput)
+			releaseRequestSlot()
+		}
+
+		// A canceled run may surface as a process error; report it as the cancellation it was
+		if err != nil && !errors.Is(err, context.Canceled) && errors.Is(ctx.Err(), context.Canceled) {
+			err = fmt.Errorf("%w (%v)", context.Canceled, err)
+		}
+		release()
+		tokens, _ := completionTokens(result)
+		metricsRequestFinished(outcomeForError(err), time.Since(startTime), tokens)
+		logSlowRequest(arguments.RequestID, arguments, time.Since(startTime))
+
+		// Post-process the output exactly like a synchronous response
+		var text string
+		if err == nil {
+			var content []*mcpgolang.Content
+			var output string
+			if content, output, err = completionContent(arguments, result); err == nil {
+				text = contentText(content)
+				requestLogf(ctx, "Job %s completed in %v, output length: %d chars", job.id, time.Since(startTime), len(output))
+				debugLogf(ctx, "Output:\n%s", output)
+			}
+		}
+		if errors.Is(err, context.Canceled) {
+			requestLogf(ctx, "Job %s cancelled at client request", job.id)
+		} else if err != nil {
+			requestLogf(ctx, "Job %s failed: %v", job.id, err)
+		}
+		job.finish(result, text, err)
+
+		if onFinish != nil {
+			onFinish(job.snapshot(0))
+		}
+	}()
+
+	return job.id
+}
+
+// appendOutput adds a chunk of streamed output to the job.
+//
+// Parameters:
+//   - chunk: The output chunk; copied, so the caller may reuse it
+func (j *completionJob) appendOutput(chunk []byte) {
+	j.mu.Lock()
+	j.output = append(j.output, chunk...)
+	j.broadcast.notify()
+	j.mu.Unlock()
+}
+
+// finish records the final state of the job.
+//
+// Parameters:
+//   - result: The completion result
+//   - text: The post-processed completion text (see completionContent)
+//   - err: The completion error, or nil on success
+func (j *completionJob) finish(result CompletionResult, text string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	defer j.broadcast.notify()
+
+	j.finished = time.Now()
+	j.warnings = result.Warnings
+	j.usage = result.Usage
+	switch {
+	case err == nil:
+		j.status, j.event = JobStatusCompleted, JobEventDone
+		j.output = result.Output
+		j.result = text
+	case errors.Is(err, context.Canceled):
+		j.status, j.event = JobStatusCanceled, JobEventCancelled
+		j.err = "completion was canceled"
+	default:
+		j.status, j.event = JobStatusFailed, JobEventError
+		j.err = err.Error()
+	}
+}
+
+// snapshot returns the job's current status with output from the given byte offset.
+// While the job is running, a trailing partial UTF-8 sequence is held back so that
+// clients never receive a split character.
+//
+// Parameters:
+//   - offset: Byte offset into the accumulated output
+//
+// Returns:
+//   - JobStatus: The job status
+func (j *completionJob) snapshot(offset int) JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	output := j.output
+	if j.status == JobStatusRunning {
+		output = trimPartialRune(output)
+	}
+	offset = max(0, min(offset, len(output)))
+
+	var queue *QueueStatus
+	if j.status == JobStatusRunning {
+		queue = j.queue.status()
+	}
+
+	return JobStatus{
+		JobID:        j.id,
+		RequestID:    j.requestID,
+		Status:       j.status,
+		Event:        j.event,
+		Output:       string(output[offset:]),
+		Result:       j.result,
+		OutputLength: len(output),
+		Error:        j.err,
+		Warnings:     j.warnings,
+		Usage:        j.usage,
+		Queue:        queue,
+	}
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence from the end of b.
+//
+// Parameters:
+//   - b: Output that may end mid-character
+//
+// Returns:
+//   - []byte: b without a trailing partial character
+func trimPartialRune(b []byte) []byte {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return b[:i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// expireJobs removes finished jobs older than JobTTLSeconds. Running jobs never expire.
+func expireJobs() {
+	ttl := time.Duration(appArgs.JobTTLSeconds) * time.Second
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	for id, job := range jobs {
+		job.mu.Lock()
+		expired := !job.finished.IsZero() && time.Since(job.finished) > ttl
+		job.mu.Unlock()
+		if expired {
+			delete(jobs, id)
+		}
+	}
+}
+
+// jobAcceptedResponse builds the immediate response for a request handed off to a job.
+//
+// Parameters:
+//   - jobID: The id of the started job
+//   - requestID: The request's id
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: {"job_id": ..., "request_id": ..., "status": "accepted"}
+func jobAcceptedResponse(jobID, requestID string) *mcpgolang.ToolResponse {
+	data, _ := json.Marshal(map[string]string{"job_id": jobID, "request_id": requestID, "status": "accepted"})
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data)))
+}
+
+// handleGetJobTool reports the status and accumulated output of an asynchronous job.
+//
+// Parameters:
+//   - arguments: The job id and optional output offset
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON job status, or an error message for unknown jobs
+//   - error: Any error that occurred while encoding the response
+func handleGetJobTool(arguments GetJobArguments) (*mcpgolang.ToolResponse, error) {
+	expireJobs()
+
+	jobsMu.Lock()
+	job, ok := jobs[arguments.JobID]
+	jobsMu.Unlock()
+	if !ok {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: job %q not found or expired", arguments.JobID))), nil
+	}
+
+	data, err := json.Marshal(job.snapshot(arguments.Offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job status: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
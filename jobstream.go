@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// jobBroadcaster fans a job's output out to every subscribe_job stream watching it.
+// Subscribers read the job's accumulated output from their own offset, so each gets
+// the full stream (backfill first, then live output) and a slow one never blocks the
+// job or the others. The broadcaster only signals that something changed.
+type jobBroadcaster struct {
+	changed     chan struct{} // Closed and replaced whenever output is appended or the job finishes
+	subscribers int           // Active streams; the broadcaster is dropped when it reaches zero
+}
+
+// notify wakes every subscriber. Safe on a nil broadcaster. Callers must hold the job's mu.
+func (b *jobBroadcaster) notify() {
+	if b == nil {
+		return
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// SubscribeJobArguments defines the input structure for the MCP subscribe_job tool
+type SubscribeJobArguments struct {
+	JobID  string `json:"job_id" description:"Job id returned when the request was accepted"`
+	Offset int    `json:"offset,omitempty" description:"Byte offset to start from; 0 replays all output produced so far"`
+}
+
+// subscribe registers a stream on the job's broadcaster, creating it for the first one.
+//
+// Returns:
+//   - func(): Unsubscribes; the broadcaster is removed when the last subscriber leaves
+func (j *completionJob) subscribe() func() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.broadcast == nil {
+		j.broadcast = &jobBroadcaster{changed: make(chan struct{})}
+	}
+	j.broadcast.subscribers++
+
+	return func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if j.broadcast.subscribers--; j.broadcast.subscribers == 0 {
+			j.broadcast = nil
+		}
+	}
+}
+
+// nextChange returns the channel closed on the job's next change, or nil once the
+// job has finished and nothing more will arrive.
+//
+// Returns:
+//   - <-chan struct{}: The change channel
+func (j *completionJob) nextChange() <-chan struct{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != JobStatusRunning {
+		return nil
+	}
+	return j.broadcast.changed
+}
+
+// handleSubscribeJobTool streams a job's output to the caller as progress notifications:
+// first everything produced since offset, then new output as it is generated, until the
+// job finishes or the client disconnects. Any number of clients may watch the same job.
+//
+// Parameters:
+//   - ctx: The tool call context
+//   - arguments: The job id and optional starting offset
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The final job status without output, or an error message
+//   - error: Any error that occurred while encoding the response
+func handleSubscribeJobTool(ctx context.Context, arguments SubscribeJobArguments) (*mcpgolang.ToolResponse, error) {
+	jobsMu.Lock()
+	job, ok := jobs[arguments.JobID]
+	jobsMu.Unlock()
+	if !ok {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: job %q not found or expired", arguments.JobID))), nil
+	}
+
+	stream := newOutputStream(ctx)
+	if stream == nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: subscribe_job requires Accept: text/event-stream; poll get_job instead")), nil
+	}
+	unsubscribe := job.subscribe()
+	defer unsubscribe()
+
+	// Take the change channel before each read so output appended in between isn't missed
+	offset := arguments.Offset
+	for {
+		changed := job.nextChange()
+		status := job.snapshot(offset)
+		if status.Output != "" {
+			stream.write([]byte(status.Output))
+		}
+		offset = status.OutputLength
+		if changed == nil {
+			stream.flush()
+			break
+		}
+
+		select {
+		case <-changed:
+		case <-stream.done:
+			logger.Printf("Subscriber to job %s disconnected", job.id)
+			return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: client disconnected")), nil
+		}
+	}
+
+	data, err := json.Marshal(job.snapshot(offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job status: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
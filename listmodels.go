@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// ListModelsArguments defines the input structure for the MCP list_models tool
+type ListModelsArguments struct {
+	Recursive bool `json:"recursive,omitempty" description:"Also list models in subdirectories of ModelPath"`
+}
+
+// ModelFileInfo describes one model file found under ModelPath
+type ModelFileInfo struct {
+	Name     string    `json:"name"`     // Path relative to ModelPath, usable as a request's model
+	Size     int64     `json:"size"`     // File size in bytes
+	Modified time.Time `json:"modified"` // Last modification time
+}
+
+// ListModelsResult is the JSON document returned by the list_models tool
+type ListModelsResult struct {
+	ModelPath string          `json:"model_path"` // Directory that was scanned
+	Models    []ModelFileInfo `json:"models"`     // Model files, sorted by name
+}
+
+// isModelFile reports whether a file name is a complete GGUF model. Partial downloads
+// are left out: browsers and huggingface-cli append a suffix (.part, .crdownload,
+// .incomplete) and curl/wget-style tools write hidden temporary files.
+//
+// Parameters:
+//   - name: The file's base name
+//
+// Returns:
+//   - bool: Whether the file should be listed
+func isModelFile(name string) bool {
+	return !strings.HasPrefix(name, ".") && strings.EqualFold(filepath.Ext(name), ".gguf")
+}
+
+// listModels scans ModelPath for GGUF model files.
+//
+// Parameters:
+//   - root: The directory to scan
+//   - recursive: Whether to descend into subdirectories (hidden ones are skipped)
+//
+// Returns:
+//   - []ModelFileInfo: The model files, sorted by name
+//   - error: Any error reading the directory
+func listModels(root string, recursive bool) ([]ModelFileInfo, error) {
+	models := []ModelFileInfo{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			logger.Printf("list_models: skipping %s: %v", path, err)
+			return nil
+		}
+		if entry.IsDir() {
+			if path != root && (!recursive || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isModelFile(entry.Name()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			logger.Printf("list_models: skipping %s: %v", path, err)
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			if info, err = os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		models = append(models, ModelFileInfo{Name: filepath.ToSlash(name), Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models, nil
+}
+
+// handleListModelsTool lists the GGUF files under ModelPath so clients can discover
+// which models they can request. Models outside a token's allowlist are left out.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token when auth is enabled
+//   - arguments: Whether to scan subdirectories
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON {"model_path", "models"} or an error message
+//   - error: Any error that occurred while encoding the response
+func handleListModelsTool(ctx context.Context, arguments ListModelsArguments) (*mcpgolang.ToolResponse, error) {
+	if appArgs.ModelPath == "" {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: ModelPath is not configured")), nil
+	}
+
+	models, err := listModels(appArgs.ModelPath, arguments.Recursive)
+	if err != nil {
+		logger.Printf("Error listing models in %s: %v", appArgs.ModelPath, err)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error listing models: %v", err))), nil
+	}
+
+	result := ListModelsResult{ModelPath: appArgs.ModelPath, Models: []ModelFileInfo{}}
+	token := authTokenFromContext(ctx)
+	for _, model := range models {
+		if modelAllowedForToken(token, filepath.Join(appArgs.ModelPath, filepath.FromSlash(model.Name))) {
+			result.Models = append(result.Models, model)
+		}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode model list: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
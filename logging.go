@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log formats accepted by LogFormat
+const (
+	LogFormatText = "text" // "[APP] <date> <time> <file:line>: <message>" lines
+	LogFormatJSON = "json" // One JSON object per line
+)
+
+// jsonLogOutput receives structured records when LogFormat is json; nil in text mode
+var jsonLogOutput *jsonLogWriter
+
+// jsonLogWriter turns log.Logger output into JSON records. Loggers writing to it must
+// use log.Lshortfile and no other flags or prefix, so each write is "file:line: message".
+type jsonLogWriter struct {
+	out io.Writer  // Destination (console and log file)
+	mu  sync.Mutex // Keeps records from interleaving
+}
+
+// Write implements io.Writer for one formatted log.Logger line.
+//
+// Parameters:
+//   - p: The formatted line
+//
+// Returns:
+//   - int: len(p), so the logger never sees a short write
+//   - error: Any error writing the record
+func (w *jsonLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	source, message, found := strings.Cut(line, ": ")
+	if !found || !strings.Contains(source, ".go:") {
+		source, message = "", line
+	}
+	return len(p), w.write(time.Now(), source, message, nil)
+}
+
+// write encodes one record: time, level, source and message, followed by the extra
+// fields in name order. Fields cannot replace the standard keys.
+//
+// Parameters:
+//   - now: The record timestamp
+//   - source: The calling file:line, or "" when unknown
+//   - message: The log message
+//   - fields: Extra request fields, possibly nil
+//
+// Returns:
+//   - error: Any error writing the record
+func (w *jsonLogWriter) write(now time.Time, source, message string, fields map[string]any) error {
+	var record bytes.Buffer
+	record.WriteByte('{')
+	appendJSONField(&record, "time", now.Format(time.RFC3339Nano))
+	appendJSONField(&record, "level", logLevel(message))
+	if source != "" {
+		appendJSONField(&record, "source", source)
+	}
+	appendJSONField(&record, "message", message)
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		switch name {
+		case "time", "level", "source", "message":
+			continue
+		}
+		appendJSONField(&record, name, fields[name])
+	}
+	record.WriteString("}\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.out.Write(record.Bytes())
+	return err
+}
+
+// appendJSONField appends "name":value to a JSON object under construction.
+//
+// Parameters:
+//   - record: The object so far, starting with "{"
+//   - name: The field name
+//   - value: The field value; values that cannot be encoded are written as strings
+func appendJSONField(record *bytes.Buffer, name string, value any) {
+	if record.Len() > 1 {
+		record.WriteByte(',')
+	}
+	key, _ := json.Marshal(name)
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	record.Write(key)
+	record.WriteByte(':')
+	record.Write(data)
+}
+
+// logLevel derives a record's level from the message prefixes the code base already
+// uses ("Error:", "Warning:", "WARN:", "DEBUG:").
+//
+// Parameters:
+//   - message: The log message
+//
+// Returns:
+//   - string: "error", "warn", "debug" or "info"
+func logLevel(message string) string {
+	prefix, _, _ := strings.Cut(message, ":")
+	switch strings.ToLower(prefix) {
+	case "error":
+		return "error"
+	case "warning", "warn":
+		return "warn"
+	case "debug":
+		return "debug"
+	}
+	return "info"
+}
+
+// logWithFields logs a message together with request fields (request id, model,
+// duration, ...) so they can be queried. In JSON mode the fields become top-level
+// keys of the record; in text mode they are appended as name=value pairs.
+//
+// Parameters:
+//   - fields: Field name -> value
+//   - format: The log format string
+//   - v: The format arguments
+func logWithFields(fields map[string]any, format string, v ...any) {
+	outputWithFields(2, fields, fmt.Sprintf(format, v...))
+}
+
+// logRequestf logs a line belonging to a request, tagged with its request id so
+// interleaved requests can be told apart.
+//
+// Parameters:
+//   - requestID: The request id; "" logs the line untagged
+//   - format: The log format string
+//   - v: The format arguments
+func logRequestf(requestID string, format string, v ...any) {
+	outputWithFields(2, requestFields(requestID), fmt.Sprintf(format, v...))
+}
+
+// requestFields returns the log fields identifying a request.
+//
+// Parameters:
+//   - requestID: The request id
+//
+// Returns:
+//   - map[string]any: {"request_id": requestID}, or nil for ""
+func requestFields(requestID string) map[string]any {
+	if requestID == "" {
+		return nil
+	}
+	return map[string]any{"request_id": requestID}
+}
+
+// outputWithFields writes a log line with fields, attributing it to a caller up the
+// stack like log.Logger.Output.
+//
+// Parameters:
+//   - calldepth: Frames to skip; 1 attributes the line to the caller of outputWithFields
+//   - fields: Field name -> value, possibly nil
+//   - message: The formatted message
+func outputWithFields(calldepth int, fields map[string]any, message string) {
+	if jsonLogOutput != nil {
+		source := ""
+		if _, file, line, ok := runtime.Caller(calldepth); ok {
+			source = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+		}
+		_ = jsonLogOutput.write(time.Now(), source, message, fields)
+		return
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		message += fmt.Sprintf(" %s=%v", name, fields[name])
+	}
+	_ = logger.Output(calldepth+1, message)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// resolveLogitBias rewrites logit_bias keys given as token text into token ids, since
+// llama-cli's --logit-bias only takes ids. Text is tokenized with the request's model,
+// without BOS, and must be exactly one token.
+//
+// Parameters:
+//   - ctx: Context for cancellation of the tokenizer runs
+//   - arguments: The completion request
+//
+// Returns:
+//   - CompletionArguments: The request with every logit_bias key a token id
+//   - error: ErrInvalidArguments if a text key is not a single token or two keys name
+//     the same token, or the tokenizer error
+func resolveLogitBias(ctx context.Context, arguments CompletionArguments) (CompletionArguments, error) {
+	if len(arguments.LogitBias) == 0 {
+		return arguments, nil
+	}
+
+	noBos := false
+	resolved := make(map[string]float64, len(arguments.LogitBias))
+	keys := make(map[string]string, len(arguments.LogitBias))
+	for key, bias := range arguments.LogitBias {
+		id := key
+		if _, err := strconv.Atoi(key); err != nil {
+			tokens, err := tokenize(ctx, CountTokensArguments{Prompt: key, Model: arguments.Model, AddBos: &noBos})
+			if err != nil {
+				return arguments, fmt.Errorf("failed to tokenize logit_bias key %q: %w", key, err)
+			}
+			if len(tokens) != 1 {
+				return arguments, fmt.Errorf("%w: logit_bias key %q is %d tokens, not one; use token ids instead", ErrInvalidArguments, key, len(tokens))
+			}
+			id = strconv.Itoa(tokens[0])
+		}
+		if other, ok := keys[id]; ok {
+			return arguments, fmt.Errorf("%w: logit_bias keys %q and %q are the same token %s", ErrInvalidArguments, other, key, id)
+		}
+		keys[id] = key
+		resolved[id] = bias
+	}
+
+	arguments.LogitBias = resolved
+	return arguments, nil
+}
+
+// logitBiasArgs returns one LogitBiasCmd flag per biased token, in token id order so
+// the command line is deterministic.
+//
+// Parameters:
+//   - arguments: The completion request, with logit_bias keys already resolved to ids
+//
+// Returns:
+//   - []string: The logit bias arguments, empty when the request has none
+//   - error: An error if a key is not a token id, a bias is not finite, or
+//     LogitBiasCmd is not configured
+func logitBiasArgs(arguments CompletionArguments) ([]string, error) {
+	if len(arguments.LogitBias) == 0 {
+		return nil, nil
+	}
+	if llamaCliArgs.LogitBiasCmd == "" {
+		return nil, fmt.Errorf("logit_bias is not supported: LogitBiasCmd is not configured")
+	}
+
+	ids := make([]int, 0, len(arguments.LogitBias))
+	biases := make(map[int]float64, len(arguments.LogitBias))
+	for key, bias := range arguments.LogitBias {
+		id, err := strconv.Atoi(key)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("logit_bias key %q is not a token id", key)
+		}
+		if math.IsNaN(bias) || math.IsInf(bias, 0) {
+			return nil, fmt.Errorf("logit_bias for token %d must be a finite number", id)
+		}
+		ids = append(ids, id)
+		biases[id] = bias
+	}
+	sort.Ints(ids)
+
+	var args []string
+	for _, id := range ids {
+		// llama-cli expects TOKEN_ID followed by a signed bias, e.g. 15043+1 or 15043-100
+		args = append(args, llamaCliArgs.LogitBiasCmd, fmt.Sprintf("%d%+g", id, biases[id]))
+	}
+	return args, nil
+}
@@ -4,39 +4,91 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	mcpgolang "github.com/metoro-io/mcp-golang"
+	mcptransport "github.com/metoro-io/mcp-golang/transport"
 	mcphttp "github.com/metoro-io/mcp-golang/transport/http"
+	"github.com/metoro-io/mcp-golang/transport/stdio"
 )
 
 // Configuration constants define application defaults and limits
 const (
 	// ShutdownTimeout is the maximum time to wait for graceful shutdown
 	ShutdownTimeout = 30 * time.Second
+	// PriorityHigh, PriorityNormal and PriorityLow are the accepted request priorities
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
 	// DefaultConfigFile is the default environment configuration file name
 	DefaultConfigFile = "byte-vision-cfg.env"
+	// ErrorStderrTailBytes bounds the llama-cli stderr included in debug error responses
+	ErrorStderrTailBytes = 2000
+	// ErrorStderrSummaryLines and ErrorStderrSummaryBytes bound the stderr summary added
+	// to every llama-cli failure message
+	ErrorStderrSummaryLines = 3
+	ErrorStderrSummaryBytes = 500
 )
 
+// ErrInvalidArguments marks errors caused by invalid per-request completion parameters
+var ErrInvalidArguments = errors.New("invalid arguments")
+
+// ErrEmptyOutput is returned when llama-cli succeeds without producing output and
+// EmptyOutputPolicy is "error"
+var ErrEmptyOutput = errors.New("model produced empty output")
+
+// ErrAdmissionRejected is returned when the admission policy turns away an expensive
+// request while the server is busy
+var ErrAdmissionRejected = errors.New("request not admitted")
+
+// ErrServerBusy is returned when no MaxConcurrentRequests slot frees up within the
+// request's timeout
+var ErrServerBusy = errors.New("server busy")
+
+// ErrShuttingDown is returned for completions that arrive after shutdown has started
+var ErrShuttingDown = errors.New("server is shutting down")
+
 // CompletionMetrics tracks performance and usage statistics for completion requests
 type CompletionMetrics struct {
 	RequestCount  int64         // Total number of completion requests received
 	SuccessCount  int64         // Number of successful completions
 	ErrorCount    int64         // Number of failed completions
 	TimeoutCount  int64         // Number of requests that timed out
+	CanceledCount int64         // Number of requests canceled before finishing
+	InvalidCount  int64         // Number of requests rejected for invalid arguments
 	TotalDuration time.Duration // Cumulative time spent on all requests
-	AverageTokens float64       // Average number of tokens generated per request
+	TotalTokens   int64         // Approximate number of tokens generated by successful requests
+	AverageTokens float64       // Average number of tokens generated per successful request
+
+	DurationBuckets [len(metricsDurationBuckets)]int64 // Finished requests per duration bucket (not cumulative)
+
+	CacheHits      int64 // Requests answered from the response cache
+	CacheMisses    int64 // Cacheable requests that had to be generated
+	CacheEvictions int64 // Response cache entries dropped by LRU pressure or expiry
+
+	QueuedCount   int64 // Requests that waited for a MaxConcurrentRequests slot
+	RejectedCount int64 // Requests turned away because no slot freed up in time
+
+	RetryCount int64 // llama-cli relaunches after a transient failure
+
+	CoalescedCount int64 // Requests that shared an identical request's execution instead of running llama-cli
+
+	ThrottledCount int64 // Tool calls rejected by the per-client rate limit
 }
 
 // Global variables for application configuration and state management
@@ -52,23 +104,136 @@ var (
 type CompletionArguments struct {
 	Prompt string `json:"prompt" description:"The prompt text to generate completion for"`
 
+	// Prompt Template Parameters
+	Template     string            `json:"template,omitempty" description:"Name of a server-side prompt template (a .tmpl file in PromptTemplatePath) rendered into the prompt"`
+	TemplateVars map[string]string `json:"template_vars,omitempty" description:"Values for the template's variables; prompt, when given, is available as {{.prompt}}"`
+
+	// Profile Parameters
+	Profile string `json:"profile,omitempty" description:"Name of a server-side profile (from ProfilesPath) supplying model and sampling parameters this request leaves unset; explicit arguments take precedence"`
+
 	// Core Model & Performance Parameters
-	Model     string `json:"model,omitempty" description:"Model path (overrides default)"`
+	Model     string `json:"model,omitempty" description:"Model path or registry name (overrides default)"`
 	Threads   int    `json:"threads,omitempty" description:"CPU threads for generation"`
 	GpuLayers int    `json:"gpu_layers,omitempty" description:"GPU acceleration layers"`
 	CtxSize   int    `json:"ctx_size,omitempty" description:"Context window size"`
+	Keep      int    `json:"keep,omitempty" description:"Prompt tokens kept when the context fills up; -1 keeps the whole prompt"`
 	BatchSize int    `json:"batch_size,omitempty" description:"Batch processing size"`
+	CpuMask   string `json:"cpu_mask,omitempty" description:"CPU affinity mask in hex (e.g. 0xFF)"`
+	CpuRange  string `json:"cpu_range,omitempty" description:"CPU affinity range in lo-hi form (e.g. 0-7)"`
+
+	ThreadsBatch int `json:"threads_batch,omitempty" description:"CPU threads for prompt processing (default: same as threads)"`
+	UBatchSize   int `json:"ubatch_size,omitempty" description:"Physical batch size; must not exceed batch_size"`
+
+	SplitMode string `json:"split_mode,omitempty" description:"How to split the model across GPUs: none, layer or row"`
+	MainGPU   *int   `json:"main_gpu,omitempty" description:"GPU index holding the model (split_mode none) or intermediate results and KV (split_mode row)"`
+
+	TensorSplit []float64 `json:"tensor_split,omitempty" description:"Fraction of the model to put on each GPU, one ratio per GPU (e.g. [3, 1])"`
+
+	// RoPE scaling for contexts beyond the trained length
+	RopeScaling     string  `json:"rope_scaling,omitempty" description:"RoPE frequency scaling method: none, linear or yarn"`
+	RopeScale       float64 `json:"rope_scale,omitempty" description:"RoPE context scaling factor, e.g. 4 to stretch a 8192 context to 32768"`
+	YarnOrigContext int     `json:"yarn_orig_ctx,omitempty" description:"Original training context size of the model for YaRN scaling"`
+
+	FlashAttention *bool `json:"flash_attention,omitempty" description:"Enable or disable flash attention for this request (default FlashAttentionCmdEnabled)"`
 
 	// Generation Control Parameters
 	Predict       int     `json:"predict,omitempty" description:"Number of tokens to generate"`
-	Temperature   float64 `json:"temperature,omitempty" description:"Creativity/randomness control"`
+	Temperature   float64 `json:"temperature,omitempty" description:"Creativity/randomness control; the midpoint of the range when dynatemp_range is set"`
 	TopK          int     `json:"top_k,omitempty" description:"Top-K sampling"`
 	TopP          float64 `json:"top_p,omitempty" description:"Top-P (nucleus) sampling"`
+	MinP          float64 `json:"min_p,omitempty" description:"Min-P sampling in [0, 1]: drop tokens below this fraction of the top token's probability"`
+	TypicalP      float64 `json:"typical_p,omitempty" description:"Locally typical sampling p in (0, 1]; 1 disables"`
+	Tfs           float64 `json:"tfs,omitempty" description:"Tail free sampling z in (0, 1]; 1 disables"`
 	RepeatPenalty float64 `json:"repeat_penalty,omitempty" description:"Repetition penalty"`
+	RepeatLastN   int     `json:"repeat_last_n,omitempty" description:"How many recent tokens repeat_penalty looks at; -1 uses the whole context"`
+
+	LogitBias map[string]float64 `json:"logit_bias,omitempty" description:"Bias added to individual tokens' logits, keyed by token id as a string (e.g. {\"15043\": -100} to suppress token 15043) or by token text that is exactly one token (e.g. {\" Hello\": 2}); ids come from the tokenize tool"`
+
+	// Mirostat sampling
+	Mirostat    int     `json:"mirostat,omitempty" description:"Mirostat sampling mode: 0 off, 1 Mirostat, 2 Mirostat 2.0 (replaces top_k/top_p/min_p)"`
+	MirostatTau float64 `json:"mirostat_tau,omitempty" description:"Mirostat target entropy; lower is more focused (used only when mirostat is 1 or 2)"`
+	MirostatEta float64 `json:"mirostat_eta,omitempty" description:"Mirostat learning rate (used only when mirostat is 1 or 2)"`
+
+	// Dynamic temperature
+	DynatempRange float64 `json:"dynatemp_range,omitempty" description:"Dynamic temperature range: each token is sampled at a temperature between temperature - range and temperature + range, higher when the model is uncertain; 0 keeps the fixed temperature"`
+	DynatempExp   float64 `json:"dynatemp_exp,omitempty" description:"Dynamic temperature exponent, > 0; above 1 keeps the temperature near the low end longer (used only when dynatemp_range is set)"`
+
+	Samplers []string `json:"samplers,omitempty" description:"Sampler chain in the order applied, e.g. [\"penalties\", \"top_k\", \"min_p\", \"temperature\"] (default SamplersVal)"`
+
+	Stop                []string `json:"stop,omitempty" description:"Stop generating at the first occurrence of any of these strings"`
+	StopOnDoubleNewline *bool    `json:"stop_on_double_newline,omitempty" description:"Stop generating at the first blank line (default StopOnDoubleNewline)"`
+	IncludeStopInOutput bool     `json:"include_stop_in_output,omitempty" description:"Keep the stop sequence that ended generation in the returned text (stripped by default)"`
+	CleanOutput         *bool    `json:"clean_output,omitempty" description:"Strip the prompt echo, llama.cpp log lines and end-of-text markers from the output (default true)"`
+
+	// Constrained output
+	Grammar     string `json:"grammar,omitempty" description:"GBNF grammar the output must match, e.g. to force valid JSON"`
+	GrammarFile string `json:"grammar_file,omitempty" description:"Path of a GBNF grammar file on the server (cannot be combined with grammar)"`
+	JsonSchema  string `json:"json_schema,omitempty" description:"JSON schema the output must conform to, e.g. {\"type\": \"object\", ...} (cannot be combined with grammar)"`
 
 	// Input/Output Parameters
 	PromptFile string `json:"prompt_file,omitempty" description:"Prompt from file"`
 	LogFile    string `json:"log_file,omitempty" description:"Output logging"`
+
+	DebugLog string `json:"debug_log,omitempty" description:"File name under DebugLogPath that receives this request's server-side log lines"`
+
+	Stream bool `json:"stream,omitempty" description:"Stream output line by line as progress notifications (requires Accept: text/event-stream)"`
+
+	// Output Formatting Parameters
+	OutputSections bool `json:"output_sections,omitempty" description:"Split the output into {title, body} sections at the configured markers"`
+	IncludeRaw     bool `json:"include_raw,omitempty" description:"Also return the unparsed output when output_sections is set"`
+
+	SeparateReasoning bool `json:"separate_reasoning,omitempty" description:"Return {reasoning, answer} with the model's thinking block split from the final answer"`
+
+	IncludeUsage bool `json:"include_usage,omitempty" description:"Append an OpenAI-style usage block {prompt_tokens, completion_tokens, total_tokens}"`
+
+	IncludeMetadata bool `json:"include_metadata,omitempty" description:"Append {metadata} with the duration, approximate token counts, model and whether the request timed out"`
+
+	MaxOutputChars int `json:"max_output_chars,omitempty" description:"Truncate the returned text to this many characters and append a truncation marker"`
+
+	IncludeRequestHash bool `json:"include_request_hash,omitempty" description:"Append {request_hash}, a stable cache key for this request"`
+
+	EchoRequest bool `json:"echo_request,omitempty" description:"Append {request}, the effective parameters after defaults and clamps; prompt text is redacted"`
+	EchoPrompt  bool `json:"echo_prompt,omitempty" description:"Keep the prompt text in the echo_request block instead of redacting it"`
+
+	// Output Priming Parameters
+	AssistantPrefix string `json:"assistant_prefix,omitempty" description:"Text appended to the prompt that the output must continue from (prefill), e.g. {"`
+	IncludePrefix   bool   `json:"include_prefix,omitempty" description:"Prepend assistant_prefix to the returned output"`
+
+	// Long Prompt Parameters
+	SplitStrategy    string `json:"split_strategy,omitempty" description:"Split an oversized prompt into overlapping token windows: windows (per-window results) or combined"`
+	SplitInstruction string `json:"split_instruction,omitempty" description:"Instruction prepended to every window when split_strategy is set"`
+
+	// Reproducibility Parameters
+	Seed           *int   `json:"seed,omitempty" description:"Random seed for sampling; omitted or negative picks a random seed, which is returned in the response so the run can be reproduced"`
+	ConversationID string `json:"conversation_id,omitempty" description:"Conversation id; each turn gets a deterministic seed derived from it and turn"`
+	Turn           int    `json:"turn,omitempty" description:"Turn number within conversation_id (default 0)"`
+
+	// Scheduling Parameters
+	Priority       string `json:"priority,omitempty" description:"Request priority: high (short timeout), normal (default) or low (long timeout)"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" description:"Timeout for this request in seconds, overriding the priority timeout (at most MaxTimeoutSeconds)"`
+
+	// Delivery Parameters
+	CallbackURL string `json:"callback_url,omitempty" description:"Webhook URL to POST the result to; the call returns a job id immediately"`
+	Async       bool   `json:"async,omitempty" description:"Run as a background job and return its id immediately; poll get_job for progress"`
+
+	IdempotencyKey string `json:"idempotency_key,omitempty" description:"Concurrent requests with the same key share one generation and all receive its result"`
+
+	// Tracing Parameters
+	RequestID string `json:"request_id,omitempty" description:"Id for this request in server logs, metadata and cancel_completion (letters, digits, - and _); a UUID is generated when omitted"`
+}
+
+// CompletionResult carries the output of a successful completion together with any
+// non-fatal warnings raised while preparing it
+type CompletionResult struct {
+	Output   []byte         // Raw output from llama-cli
+	Warnings []string       // Warnings to surface to the client (e.g., deprecated model alias)
+	Stats    LlamaPerfStats // Performance statistics parsed from llama-cli stderr
+	Usage    *Usage         // Token usage, when requested with include_usage
+
+	Resolved CompletionArguments // Effective parameters after defaults and clamps
+
+	Prompt          string // Prompt passed to llama-cli after templates and variable substitution
+	AssistantPrefix string // Prefill appended to Prompt, which llama-cli echoes along with it
 }
 
 // setupLogging configures dual logging to both file and console with structured output.
@@ -92,8 +257,24 @@ func setupLogging() error {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
-	// Create multi-writer to output to both console and file simultaneously
-	multiWriter := io.MultiWriter(os.Stdout, logFile)
+	// Create multi-writer to output to both console and file simultaneously. Over the stdio
+	// transport stdout carries the protocol, so the console copy goes to stderr instead
+	console := io.Writer(os.Stdout)
+	if appArgs.Transport == TransportStdio {
+		console = os.Stderr
+	}
+	multiWriter := io.MultiWriter(console, logFile)
+
+	// Emit one JSON record per line when LogFormat is json; the records carry their own
+	// timestamp, so the loggers only add the source file
+	if appArgs.LogFormat == LogFormatJSON {
+		jsonLogOutput = &jsonLogWriter{out: multiWriter}
+		logger = log.New(jsonLogOutput, "", log.Lshortfile)
+		log.SetOutput(jsonLogOutput)
+		log.SetFlags(log.Lshortfile)
+		logger.Printf("Logging initialized - writing JSON records to %s", logFilePath)
+		return nil
+	}
 
 	// Create a custom logger with [APP] prefix and timestamp/file information
 	logger = log.New(multiWriter, "[APP] ", log.LstdFlags|log.Lshortfile)
@@ -137,6 +318,11 @@ func main() {
 	llamaCliArgs = ParseDefaultLlamaCliEnv()
 	appArgs = ParseDefaultAppEnv()
 
+	// Fail fast on configuration that would only break once llama-cli is invoked
+	if err := ValidateConfig(appArgs, llamaCliArgs); err != nil {
+		log.Fatal(err)
+	}
+
 	// Setup structured logging to file and console
 	if err := setupLogging(); err != nil {
 		log.Fatalf("Failed to setup logging: %v", err)
@@ -144,10 +330,36 @@ func main() {
 
 	logger.Println("Application starting...")
 
+	// Probe the llama.cpp build once so outputs can be tied to a specific backend version
+	if version := GetLlamaVersion(appArgs); version.Error != "" {
+		logger.Printf("Warning: could not determine llama.cpp version: %s", version.Error)
+	} else {
+		logger.Printf("Using llama.cpp version %s", version)
+	}
+
+	// Compile prompt redaction patterns now so configuration errors surface at startup
+	loadRedactionPatterns()
+
+	// Report whether requests can start from the precomputed base KV cache
+	loadBaseCacheInfo()
+
 	// Create context for coordinating graceful shutdown across goroutines
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Check free space on the cache/log volumes now and periodically afterwards
+	checkDiskSpace()
+	startDiskMonitor(ctx)
+
+	// Periodically log a metrics summary when configured
+	startMetricsLogger(ctx)
+
+	// Evict expired response cache entries in the background
+	startResponseCacheSweeper(ctx)
+
+	// Forget rate limit buckets of clients that stopped calling
+	startRateLimitSweeper(ctx)
+
 	// Setup signal handling for graceful shutdown (Ctrl+C, SIGTERM)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -158,16 +370,25 @@ func main() {
 		serverErr <- runServer(ctx)
 	}()
 
-	// Wait for either a shutdown signal or server error
+	// Wait for either a shutdown signal or the server stopping on its own (an error, or
+	// the stdio client closing stdin)
+	serverStopped := false
 	select {
 	case <-quit:
 		logger.Println("Received shutdown signal...")
 	case err := <-serverErr:
+		serverStopped = true
 		if err != nil && !errors.Is(err, context.Canceled) {
 			logger.Printf("Server error: %v", err)
 		}
 	}
 
+	// Let in-flight completions finish before anything is torn down; the stdio client is
+	// already gone when the server stopped on its own
+	if !serverStopped {
+		drainCompletions(ShutdownTimeout)
+	}
+
 	// Initiate graceful shutdown by canceling the context
 	cancel()
 
@@ -175,11 +396,13 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 	defer shutdownCancel()
 
-	select {
-	case <-shutdownCtx.Done():
-		logger.Println("Forced shutdown after timeout")
-	case <-serverErr:
-		logger.Println("Server shutdown complete")
+	if !serverStopped {
+		select {
+		case <-shutdownCtx.Done():
+			logger.Println("Forced shutdown after timeout")
+		case <-serverErr:
+			logger.Println("Server shutdown complete")
+		}
 	}
 
 	logger.Println("Application shutdown complete")
@@ -194,9 +417,20 @@ func main() {
 // Returns:
 //   - error: Any error that occurred during server operation
 func runServer(ctx context.Context) error {
-	// Create HTTP transport for the MCP protocol
-	transport := mcphttp.NewHTTPTransport(appArgs.EndPoint)
-	transport.WithAddr(appArgs.HttpPort)
+	// Create the MCP transport: stdio for clients that launch the server, otherwise HTTP
+	// mounted on a server shared with the operational endpoints
+	var transport mcptransport.Transport
+	var ginTransport *mcphttp.GinTransport
+	stdinClosed := make(chan struct{})
+	switch appArgs.Transport {
+	case TransportStdio:
+		transport = stdio.NewStdioServerTransportWithIO(&eofNotifyingReader{r: os.Stdin, closed: stdinClosed}, os.Stdout)
+	case TransportHTTP:
+		ginTransport = mcphttp.NewGinTransport()
+		transport = ginTransport
+	default:
+		return fmt.Errorf("unknown Transport %q: must be %q or %q", appArgs.Transport, TransportHTTP, TransportStdio)
+	}
 
 	// Create the MCP server instance
 	server := mcpgolang.NewServer(transport)
@@ -206,23 +440,154 @@ func runServer(ctx context.Context) error {
 		return fmt.Errorf("failed to register completion tool: %w", err)
 	}
 
-	logger.Printf("Starting MCP HTTP server on %s%s", appArgs.HttpPort, appArgs.EndPoint)
+	// Register the chat completion tool for role-structured conversations
+	if err := server.RegisterTool("generate_chat_completion", "Generate the assistant's reply to a conversation of system/user/assistant messages, formatted with the model's chat template", handleChatCompletionTool); err != nil {
+		return fmt.Errorf("failed to register chat completion tool: %w", err)
+	}
 
-	// Start the server in a separate goroutine to allow for cancellation
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- server.Serve()
-	}()
+	// Register the tokenizer tool for context budgeting, also under the name clients of
+	// other llama.cpp frontends look for
+	if err := server.RegisterTool("count_tokens", "Count the tokens in a prompt using the model's tokenizer, without generating", handleCountTokensTool); err != nil {
+		return fmt.Errorf("failed to register count_tokens tool: %w", err)
+	}
+	if err := server.RegisterTool("tokenize", "Tokenize a prompt with the model's tokenizer and return the token count and optionally the ids (same as count_tokens)", handleCountTokensTool); err != nil {
+		return fmt.Errorf("failed to register tokenize tool: %w", err)
+	}
+
+	// Register the embeddings tool for retrieval workloads
+	if err := server.RegisterTool("generate_embedding", "Compute embedding vectors for a text or an array of texts with llama-embedding", handleEmbeddingTool); err != nil {
+		return fmt.Errorf("failed to register generate_embedding tool: %w", err)
+	}
+
+	// Register the model discovery tool
+	if err := server.RegisterTool("list_models", "List the GGUF model files in ModelPath with their sizes and modification times", handleListModelsTool); err != nil {
+		return fmt.Errorf("failed to register list_models tool: %w", err)
+	}
+
+	// Register the GGUF metadata inspection tool
+	if err := server.RegisterTool("inspect_model", "Read a model's GGUF header and return its trained context size, architecture, quantization and parameter count", handleInspectModelTool); err != nil {
+		return fmt.Errorf("failed to register inspect_model tool: %w", err)
+	}
+
+	// Register the tokenization breakdown tool
+	if err := server.RegisterTool("analyze_prompt", "Show how a prompt tokenizes: each token's id and text piece, plus special token counts", handleAnalyzePromptTool); err != nil {
+		return fmt.Errorf("failed to register analyze_prompt tool: %w", err)
+	}
+
+	// Register the parameter sensitivity tool
+	if err := server.RegisterTool("profile_parameters", "Vary one sampling parameter at a time around the defaults and report how the output changed", handleProfileParametersTool); err != nil {
+		return fmt.Errorf("failed to register profile_parameters tool: %w", err)
+	}
+
+	// Register the cancellation tool for aborting in-flight completions
+	if err := server.RegisterTool("cancel_completion", "Cancel an in-flight completion by request_id or by the hex SHA-256 of its prompt", handleCancelCompletionTool); err != nil {
+		return fmt.Errorf("failed to register cancel_completion tool: %w", err)
+	}
+
+	// Register the job polling and streaming tools for async and callback requests
+	if err := server.RegisterTool("get_job", "Get the status and output generated so far for an asynchronous completion job", handleGetJobTool); err != nil {
+		return fmt.Errorf("failed to register get_job tool: %w", err)
+	}
+	if err := server.RegisterTool("subscribe_job", "Stream an asynchronous job's output, replaying what was already generated (requires Accept: text/event-stream)", handleSubscribeJobTool); err != nil {
+		return fmt.Errorf("failed to register subscribe_job tool: %w", err)
+	}
+
+	// Register the admin tools for saving and replaying recorded requests
+	if appArgs.HistorySize > 0 {
+		if err := server.RegisterTool("dump_request", "Admin: save a recent request (arguments, argv and config snapshot) to a file for replay", handleDumpRequestTool); err != nil {
+			return fmt.Errorf("failed to register dump_request tool: %w", err)
+		}
+		if err := server.RegisterTool("replay_request", "Admin: re-run a recorded request with its exact llama-cli command line", handleReplayRequestTool); err != nil {
+			return fmt.Errorf("failed to register replay_request tool: %w", err)
+		}
+	}
 
-	// Wait for either context cancellation or server error
+	// Register the admin base KV cache builder and resource usage tools
+	if err := server.RegisterTool("build_base_cache", "Admin: evaluate a fixed prompt prefix once and save its KV cache as the read-only BaseKVCache", handleBuildBaseCacheTool); err != nil {
+		return fmt.Errorf("failed to register build_base_cache tool: %w", err)
+	}
+
+	if err := server.RegisterTool("resource_status", "Admin: report server CPU time, memory, open file descriptors and running llama.cpp processes", handleResourceStatusTool); err != nil {
+		return fmt.Errorf("failed to register resource_status tool: %w", err)
+	}
+
+	// Register the configuration/version introspection tool
+	if err := server.RegisterTool("get_config", "Return the server configuration and the llama.cpp version in use", handleGetConfigTool); err != nil {
+		return fmt.Errorf("failed to register get_config tool: %w", err)
+	}
+
+	// Load the model into the page cache before accepting requests
+	preloadModel(ctx)
+
+	// Connect the MCP server to the transport; over stdio this starts reading stdin,
+	// over HTTP requests arrive through the HTTP server
+	if err := server.Serve(); err != nil {
+		return fmt.Errorf("failed to start MCP server: %w", err)
+	}
+
+	// Start the HTTP server in a separate goroutine to allow for cancellation
+	errChan := make(chan error, 2)
+	var httpServer *http.Server
+	if ginTransport != nil {
+		httpServer = newHTTPServer(ginTransport)
+		logger.Printf("Starting MCP HTTP server on %s%s", appArgs.HttpPort, appArgs.EndPoint)
+		if appArgs.HealthEndpoint != "" {
+			logger.Printf("Health endpoint available at %s%s", appArgs.HttpPort, appArgs.HealthEndpoint)
+		}
+		if appArgs.ReadinessEndpoint != "" {
+			logger.Printf("Readiness endpoint available at %s%s", appArgs.HttpPort, appArgs.ReadinessEndpoint)
+
+			// Keep the deep check's result fresh until the server shuts down
+			startDeepHealthCheck(ctx)
+		}
+		go func() {
+			errChan <- httpServer.ListenAndServe()
+		}()
+	} else {
+		logger.Println("Serving MCP over stdio")
+	}
+
+	// Serve Prometheus metrics on their own port when MetricsPort is set
+	var metricsServer *http.Server
+	if prometheusPath() != "" {
+		if metricsServer = newMetricsServer(); metricsServer != nil {
+			logger.Printf("Prometheus metrics available at %s%s", appArgs.MetricsPort, prometheusPath())
+			go func() {
+				errChan <- metricsServer.ListenAndServe()
+			}()
+		} else if httpServer != nil {
+			logger.Printf("Prometheus metrics available at %s%s", appArgs.HttpPort, prometheusPath())
+		} else {
+			logger.Println("Warning: Prometheus metrics need MetricsPort when Transport is stdio")
+		}
+	}
+
+	// Wait for context cancellation, the stdio client going away, or a server error
 	select {
 	case <-ctx.Done():
 		logger.Println("Shutting down server...")
-		// Attempt graceful transport shutdown
+		// Stop accepting requests and close the transport
+		if httpServer != nil {
+			if err := httpServer.Close(); err != nil {
+				logger.Printf("HTTP server shutdown error: %v", err)
+			}
+		}
+		if metricsServer != nil {
+			if err := metricsServer.Close(); err != nil {
+				logger.Printf("Metrics server shutdown error: %v", err)
+			}
+		}
 		if err := transport.Close(); err != nil {
 			logger.Printf("Transport shutdown error: %v", err)
 		}
 		return ctx.Err()
+	case <-stdinClosed:
+		logger.Println("stdin closed by the MCP client, shutting down...")
+		if metricsServer != nil {
+			metricsServer.Close()
+		}
+		transport.Close()
+		return nil
 	case err := <-errChan:
 		return err
 	}
@@ -232,27 +597,87 @@ func runServer(ctx context.Context) error {
 // executing LLama.cpp, and returning formatted responses with error handling.
 //
 // Parameters:
+//   - ctx: The tool call context, carrying the authenticated token when auth is enabled
 //   - arguments: The completion request containing the prompt text
 //
 // Returns:
 //   - *mcpgolang.ToolResponse: Formatted response containing the completion or error
 //   - error: Any error that occurred during request processing
-func handleCompletionTool(arguments CompletionArguments) (*mcpgolang.ToolResponse, error) {
-	// Initialize metrics tracking for this request
-	var metrics CompletionMetrics
+func handleCompletionTool(ctx context.Context, arguments CompletionArguments) (*mcpgolang.ToolResponse, error) {
+	// Count the request in the server-wide metrics
 	startTime := time.Now()
-	metrics.RequestCount++
+	metricsRequestStarted()
+
+	// Use the client's request id so it can correlate logs and cancel the request;
+	// an unusable one is replaced for logging and rejected below
+	requestIDErr := validateRequestID(arguments.RequestID)
+	if arguments.RequestID == "" || requestIDErr != nil {
+		arguments.RequestID = newRequestID()
+	}
+	requestID := arguments.RequestID
+	outcome, tokens := outcomeError, 0
+
+	// Trace the request when OpenTelemetry export is enabled
+	span := startSpan(ctx, "generate_completion")
+	span.SetAttribute("request.id", requestID)
+	span.SetAttribute("gen_ai.request.model", filepath.Base(effectiveModel(arguments)))
+	var spanErr error
+	defer func() {
+		if (outcome == outcomeError || outcome == outcomeInvalid) && spanErr == nil {
+			spanErr = errors.New("request rejected")
+		}
+		span.End(spanErr)
+	}()
 
-	// Track request duration and log performance metrics
+	// Track request duration and log performance metrics; asynchronous jobs record their own result
 	defer func() {
+		if outcome == outcomeAccepted {
+			return
+		}
 		duration := time.Since(startTime)
-		metrics.TotalDuration += duration
-		logger.Printf("Request completed in %v (avg: %v)", duration, time.Duration(int64(metrics.TotalDuration)/metrics.RequestCount))
+		snapshot := metricsRequestFinished(outcome, duration, tokens)
+		logWithFields(map[string]any{"request_id": requestID, "model": filepath.Base(effectiveModel(arguments)), "duration_ms": duration.Milliseconds(), "tokens": tokens},
+			"Request completed in %v (avg: %v, avg tokens: %.1f)", duration, snapshot.AverageDuration(), snapshot.AverageTokens)
+		logSlowRequest(requestID, arguments, duration)
 	}()
 
+	// Count the request as in flight so shutdown drains it; refuse it once draining
+	finishCompletion, err := trackCompletion()
+	if err != nil {
+		spanErr = err
+		return completionErrorResponse(err, arguments), nil
+	}
+	defer finishCompletion()
+
+	if requestIDErr != nil {
+		outcome = outcomeInvalid
+		return completionErrorResponse(fmt.Errorf("%w: %v", ErrInvalidArguments, requestIDErr), arguments), nil
+	}
+	if requestIDActive(requestID) {
+		outcome = outcomeInvalid
+		return completionErrorResponse(fmt.Errorf("%w: request_id %q is already used by a request in flight", ErrInvalidArguments, requestID), arguments), nil
+	}
+
+	// Render a named prompt template so everything below sees the final prompt
+	arguments, err = renderPromptTemplate(arguments)
+	if err != nil {
+		outcome = outcomeInvalid
+		return completionErrorResponse(fmt.Errorf("%w: %v", ErrInvalidArguments, err), arguments), nil
+	}
+
+	// Fill unset parameters from the named profile; explicit arguments take precedence
+	// and server defaults still apply to whatever neither sets
+	arguments, err = applySamplingProfile(arguments)
+	if err != nil {
+		outcome = outcomeInvalid
+		return completionErrorResponse(fmt.Errorf("%w: %v", ErrInvalidArguments, err), arguments), nil
+	}
+	span.SetAttribute("gen_ai.request.model", filepath.Base(effectiveModel(arguments)))
+
 	// Validate that the prompt is not empty
 	if arguments.Prompt == "" {
-		logger.Println("Empty prompt received")
+		logRequestf(requestID, "Empty prompt received")
+		outcome = outcomeInvalid
 		return &mcpgolang.ToolResponse{
 			Content: []*mcpgolang.Content{
 				mcpgolang.NewTextContent("Error: Prompt cannot be empty"),
@@ -261,73 +686,570 @@ func handleCompletionTool(arguments CompletionArguments) (*mcpgolang.ToolRespons
 	}
 
 	// Log the incoming request with truncated prompt for readability
-	logger.Printf("Handling completion request for prompt: %.100s...", arguments.Prompt)
+	logWithFields(map[string]any{"request_id": requestID, "model": filepath.Base(effectiveModel(arguments))},
+		"Handling completion request %s for prompt: %.100s...", requestID, redactText(arguments.Prompt))
+
+	// Confine the per-request debug log to DebugLogPath
+	if arguments.DebugLog != "" {
+		if err := validateDebugLogName(arguments.DebugLog); err != nil {
+			outcome = outcomeInvalid
+			return completionErrorResponse(fmt.Errorf("%w: %v", ErrInvalidArguments, err), arguments), nil
+		}
+	}
+
+	// Enforce the authenticated token's model allowlist
+	if token, model := authTokenFromContext(ctx), effectiveModel(arguments); !modelAllowedForToken(token, model) {
+		logRequestf(requestID, "Token %q is not permitted to use model %q", token.Name, model)
+		outcome = outcomeInvalid
+		return &mcpgolang.ToolResponse{
+			Content: []*mcpgolang.Content{
+				mcpgolang.NewTextContent(fmt.Sprintf("Error: model %q is not permitted for this token", filepath.Base(model))),
+			},
+		}, nil
+	}
+
+	// Hand off to the asynchronous webhook path when the client asked for a callback
+	if arguments.CallbackURL != "" {
+		response, accepted := startCallbackJob(arguments, requestOwner(ctx))
+		if accepted {
+			outcome = outcomeAccepted
+		} else {
+			outcome = outcomeInvalid
+		}
+		return response, nil
+	}
+
+	// Hand off to a pollable background job when the client asked for one
+	if arguments.Async {
+		jobID := startJob(arguments, requestOwner(ctx), nil)
+		logRequestf(requestID, "Accepted async job %s", jobID)
+		outcome = outcomeAccepted
+		return jobAcceptedResponse(jobID, requestID), nil
+	}
+
+	// Register the request so it can be canceled while in flight
+	requestCtx, release := registerActiveRequest(context.Background(), requestID, arguments.Prompt, requestOwner(ctx))
+	defer release()
+	requestCtx, closeDebugLog := attachDebugLog(requestCtx, arguments)
+	defer closeDebugLog()
+
+	// Share one execution between concurrent identical requests; the first one runs it
+	// and publishes its outcome, including failures, to the others
+	coalesce := coalesceKey(ctx, arguments)
+	inflight, leader := joinInflightCompletion(coalesce)
+	if leader {
+		defer inflight.finish(coalesce, CompletionResult{}, errors.New("request ended before completing"))
+	}
+
+	// Forward output line by line while it is generated when the client can receive it;
+	// split requests return their windows at the end instead
+	var onChunk func([]byte)
+	var stream *outputStream
+	if arguments.Stream && arguments.SplitStrategy == "" {
+		if stream = newOutputStream(ctx); stream != nil {
+			onChunk = stream.write
+		} else {
+			logRequestf(requestID, "Streaming requested for %s but the client does not accept text/event-stream; buffering", requestID)
+		}
+	}
+
+	// Report the request's place in the server-wide queue on the stream while it waits
+	if stream != nil && appArgs.StreamQueuePosition {
+		var queue *queueTracker
+		requestCtx, queue = withQueueTracker(requestCtx)
+		queue.onQueued = func(status QueueStatus) {
+			stream.send(fmt.Sprintf("[queued: position %d, estimated wait %.0fs]\n", status.Position, status.EstimatedWaitSeconds))
+		}
+	}
+
+	// Limit concurrent completions server-wide; waiting requests can still be canceled.
+	// Requests waiting on a shared execution don't need a slot of their own
+	if leader {
+		releaseRequestSlot, err := acquireRequestSlot(requestCtx, requestTimeoutSeconds(arguments))
+		if err != nil {
+			outcome = outcomeForError(err)
+			spanErr = err
+			inflight.finish(coalesce, CompletionResult{}, err)
+			if stream != nil && errors.Is(requestCtx.Err(), context.Canceled) {
+				stream.cancelled("canceled while queued")
+			}
+			return completionErrorResponse(err, arguments), nil
+		}
+		defer releaseRequestSlot()
+	}
+
+	// Process oversized prompts window by window when a split strategy is requested
+	if arguments.SplitStrategy != "" {
+		windows, err := executeSplitCompletion(requestCtx, arguments)
+		outcome = outcomeForError(err)
+		spanErr = err
+		if err != nil {
+			debugLogf(requestCtx, "Request failed: %v", err)
+			return completionErrorResponse(err, arguments), nil
+		}
+		debugLogf(requestCtx, "Split completion finished with %d windows in %v", len(windows), time.Since(startTime))
+		for _, window := range windows {
+			windowTokens, _ := completionTokens(window.result)
+			tokens += windowTokens
+		}
+		return splitResponse(arguments, windows)
+	}
+
+	// Execute the completion generation, unless an identical request is in the response cache
+	cacheKey := responseCacheKey(arguments)
+	result, cached := cachedCompletion(cacheKey)
+	if cached {
+		requestLogf(requestCtx, "Serving request %s from the response cache", requestID)
+		result = sharedResult(result, arguments)
+	} else if !leader {
+		requestLogf(requestCtx, "Request %s is waiting for an identical request in flight", requestID)
+		metricsRequestCoalesced()
+		result, err = inflight.wait(requestCtx)
+		result = sharedResult(result, arguments)
+		if errors.Is(err, context.Canceled) && requestCtx.Err() == nil {
+			// The request this one waited on was canceled through cancel_completion; that
+			// cancels only that request, so run this one on its own
+			requestLogf(requestCtx, "Identical request was canceled; running request %s on its own", requestID)
+			var releaseRequestSlot func()
+			if releaseRequestSlot, err = acquireRequestSlot(requestCtx, requestTimeoutSeconds(arguments)); err == nil {
+				result, err = executeStreamingCompletion(requestCtx, arguments, onChunk)
+				releaseRequestSlot()
+				if err == nil {
+					storeCompletion(cacheKey, result)
+				}
+			}
+		}
+	} else {
+		result, err = executeStreamingCompletion(requestCtx, arguments, onChunk)
+		if err == nil {
+			storeCompletion(cacheKey, result)
+		}
+	}
+	if leader {
+		inflight.finish(coalesce, result, err)
+	}
+	if stream != nil {
+		stream.flush()
+		// Acknowledge a cancel explicitly rather than leaving it to look like a failure
+		if err != nil && errors.Is(requestCtx.Err(), context.Canceled) {
+			stream.cancelled("canceled before completion")
+		}
+	}
+	outcome = outcomeForError(err)
+	spanErr = err
+	if err == nil {
+		tokens, _ = completionTokens(result)
+	}
+	span.SetAttribute("gen_ai.response.finish_reason", finishReason(arguments, tokens, err))
+	if err != nil {
+		debugLogf(requestCtx, "Request failed after %v: %v", time.Since(startTime), err)
+		response := completionErrorResponse(err, arguments)
+		if arguments.IncludeMetadata && errors.Is(err, context.DeadlineExceeded) {
+			data, err := json.Marshal(map[string]CompletionMetadata{"metadata": completionMetadata(arguments, result, time.Since(startTime), true)})
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode metadata: %w", err)
+			}
+			response.Content = append(response.Content, mcpgolang.NewTextContent(string(data)))
+		}
+		return response, nil
+	}
+	span.SetAttribute("gen_ai.usage.output_tokens", tokens)
+	if result.Usage != nil {
+		span.SetAttribute("gen_ai.usage.input_tokens", result.Usage.PromptTokens)
+	} else if result.Stats.PromptTokens > 0 {
+		span.SetAttribute("gen_ai.usage.input_tokens", result.Stats.PromptTokens)
+	}
+
+	// Apply the requested output post-processing and return the completion
+	content, output, err := completionContent(arguments, result)
+	if err != nil {
+		return nil, err
+	}
+	requestLogf(requestCtx, "Completion generated successfully, output length: %d chars", len(output))
+	debugLogf(requestCtx, "Output (%v):\n%s", time.Since(startTime), output)
+
+	// Append the token usage block when requested
+	if result.Usage != nil {
+		data, err := json.Marshal(map[string]*Usage{"usage": result.Usage})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode usage: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+	}
+
+	// Give clients a cache key for the request
+	if arguments.IncludeRequestHash {
+		// The transforms already succeeded for this request's run
+		hash, _, _ := resolvedRequestHash(arguments)
+		data, err := json.Marshal(map[string]string{"request_hash": hash})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request hash: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+	}
+
+	// Echo the parameters that actually ran for audit trails
+	if arguments.EchoRequest {
+		data, err := json.Marshal(map[string]CompletionArguments{"request": echoArguments(result.Resolved, arguments.EchoPrompt)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request echo: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+	}
+
+	// Append the request metadata block when requested
+	if arguments.IncludeMetadata {
+		data, err := json.Marshal(map[string]CompletionMetadata{"metadata": completionMetadata(arguments, result, time.Since(startTime), false)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+	}
+
+	// Report the seed the completion ran with so it can be reproduced
+	if result.Resolved.Seed != nil {
+		data, err := json.Marshal(map[string]int{"seed": *result.Resolved.Seed})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode seed: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+	}
+
+	// Surface non-fatal warnings after the completion so simple clients still read the text first
+	if warnings, err := warningsContent(result.Warnings); err != nil {
+		return nil, err
+	} else if warnings != nil {
+		content = append(content, warnings)
+	}
+	return &mcpgolang.ToolResponse{Content: content}, nil
+}
 
-	// Get timeout configuration with fallback to default
+// effectiveModel returns the model path a request will run with: the per-request
+// override (resolved through the model registry) when present, otherwise the
+// configured default.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - string: The model path
+func effectiveModel(arguments CompletionArguments) string {
+	if arguments.Model != "" {
+		model, _ := resolveModel(arguments.Model)
+		return model
+	}
+	return llamaCliArgs.ModelFullPathVal
+}
+
+// completionTimeoutSeconds returns the effective completion timeout for a request
+// priority. High and low priority use their own timeouts when configured; everything
+// else uses TimeOutSeconds, falling back to a five minute default when the configured
+// value is not positive.
+//
+// Parameters:
+//   - priority: The request priority ("high", "normal", "low" or empty)
+//
+// Returns:
+//   - int: The timeout in seconds
+func completionTimeoutSeconds(priority string) int {
 	timeoutSeconds := appArgs.TimeOutSeconds
+	switch {
+	case priority == PriorityHigh && appArgs.HighPriorityTimeOutSeconds > 0:
+		timeoutSeconds = appArgs.HighPriorityTimeOutSeconds
+	case priority == PriorityLow && appArgs.LowPriorityTimeOutSeconds > 0:
+		timeoutSeconds = appArgs.LowPriorityTimeOutSeconds
+	}
 	if timeoutSeconds <= 0 {
 		timeoutSeconds = 300 // fallback default of 5 minutes
 	}
+	return timeoutSeconds
+}
 
-	// Create context with timeout for the completion request
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
-	defer cancel()
+// requestTimeoutSeconds returns the timeout a completion request runs with: its
+// timeout_seconds override when set, otherwise the timeout for its priority.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - int: The timeout in seconds
+func requestTimeoutSeconds(arguments CompletionArguments) int {
+	if arguments.TimeoutSeconds > 0 {
+		return arguments.TimeoutSeconds
+	}
+	return completionTimeoutSeconds(arguments.Priority)
+}
+
+// executeCompletion prepares the llama-cli arguments for a request and runs a single
+// completion bounded by the configured timeout. It is shared by the synchronous tool
+// handler and the asynchronous job paths.
+//
+// Parameters:
+//   - parent: Parent context; canceling it aborts the completion
+//   - arguments: The completion request containing the prompt and any overrides
+//
+// Returns:
+//   - CompletionResult: The output from the LLama.cpp command and any warnings
+//   - error: ErrInvalidArguments for bad overrides, context.DeadlineExceeded on timeout,
+//     context.Canceled when aborted, or any execution error
+func executeCompletion(parent context.Context, arguments CompletionArguments) (CompletionResult, error) {
+	return executeStreamingCompletion(parent, arguments, nil)
+}
+
+// executeStreamingCompletion behaves like executeCompletion but, when onChunk is set,
+// runs llama-cli in streaming mode and reports output as it is generated.
+//
+// Parameters:
+//   - parent: Parent context; canceling it aborts the completion
+//   - arguments: The completion request containing the prompt and any overrides
+//   - onChunk: Optional callback receiving output chunks as they are produced
+//
+// Returns:
+//   - CompletionResult: The output from the LLama.cpp command and any warnings
+//   - error: Same as executeCompletion
+func executeStreamingCompletion(parent context.Context, arguments CompletionArguments, onChunk func([]byte)) (CompletionResult, error) {
+	if err := validatePriority(arguments.Priority); err != nil {
+		return CompletionResult{}, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	if err := validateTimeout(arguments.TimeoutSeconds); err != nil {
+		return CompletionResult{}, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	if arguments.SplitStrategy != "" {
+		return CompletionResult{}, fmt.Errorf("%w: split_strategy cannot be combined with async or callback_url", ErrInvalidArguments)
+	}
+
+	// Apply server-side prompt transforms (templates and variable injection)
+	arguments, err := applyPromptTransforms(arguments)
+	if err != nil {
+		return CompletionResult{}, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+
+	// Size the context to the prompt when AutoContextSize is enabled
+	arguments = autoContextSize(parent, arguments)
+
+	// Hand an inline grammar to llama-cli through a temporary file if it can only read files
+	arguments, removeGrammarFile, err := withGrammarFile(arguments)
+	if err != nil {
+		return CompletionResult{}, err
+	}
+	defer removeGrammarFile()
+
+	// Turn logit_bias keys given as token text into the token ids llama-cli expects
+	arguments, err = resolveLogitBias(parent, arguments)
+	if err != nil {
+		return CompletionResult{}, err
+	}
+
+	// Pick the seed up front so it can be reported and the run reproduced
+	arguments = withRandomSeed(arguments)
 
-	logger.Printf("Starting completion with timeout of %d seconds", timeoutSeconds)
+	// Reject, hold or downgrade expensive requests while the model is busy
+	arguments, admissionWarning, err := admitRequest(parent, arguments)
+	if err != nil {
+		return CompletionResult{}, err
+	}
 
 	// Prepare command-line arguments for LLama.cpp using configuration
-	args := prepareLlamaArgs(arguments)
+	args, warnings, err := prepareLlamaArgs(arguments)
+	if err != nil {
+		return CompletionResult{}, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	if admissionWarning != "" {
+		warnings = append(warnings, admissionWarning)
+	}
+
+	resolved := resolveArguments(arguments)
 
-	// Execute the completion generation
-	output, err := GenerateSingleCompletionWithCancel(ctx, appArgs, args)
+	// Serialize per model; the wait is bounded by the timeout but not counted against the run
+	releaseSlot, err := acquireModelSlot(parent, effectiveModel(arguments), requestTimeoutSeconds(arguments))
 	if err != nil {
-		// Handle timeout errors specifically
-		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
-			logger.Printf("Completion timed out after %d seconds", timeoutSeconds)
-			return &mcpgolang.ToolResponse{
-				Content: []*mcpgolang.Content{
-					mcpgolang.NewTextContent(fmt.Sprintf("Error: Completion timed out after %d seconds", timeoutSeconds)),
-				},
-			}, nil
+		return CompletionResult{}, err
+	}
+	defer releaseSlot()
+
+	// Record the command line of the last attempt for dump/replay once the request finishes
+	var argv []string
+	startTime := time.Now()
+	defer func() { recordHistory(parent, arguments, argv, err, time.Since(startTime)) }()
+
+	// Create context with timeout for the completion request
+	timeoutSeconds := requestTimeoutSeconds(arguments)
+	ctx, cancel := context.WithTimeout(parent, time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+
+	requestLogf(parent, "Starting completion with timeout of %d seconds", timeoutSeconds)
+
+	// Note whether any output reached the client; a retry can't take it back
+	var streamed bool
+	forward := onChunk
+	if onChunk != nil {
+		forward = func(chunk []byte) {
+			streamed = streamed || len(chunk) > 0
+			onChunk(chunk)
 		}
+	}
 
-		// Handle other execution errors
-		logger.Printf("Error generating completion: %v", err)
-		return &mcpgolang.ToolResponse{
-			Content: []*mcpgolang.Content{
-				mcpgolang.NewTextContent(fmt.Sprintf("Error generating completion: %v", err)),
-			},
-		}, nil
+	var stderr string
+	run := func(args []string) ([]byte, error) {
+		var output []byte
+		argv = append([]string{appArgs.LLamaCliPath}, args...)
+		debugLogf(parent, "Running: %s", formatArgv(redactArgv(argv)))
+		output, stderr, err = runLlamaCommand(ctx, appArgs, args, forward)
+
+		// Relaunch after transient failures such as a crash or OOM kill during model load
+		for retry := 1; retry <= appArgs.MaxRetries && isTransientLaunchFailure(ctx, err, output); retry++ {
+			backoff := retryBackoff(retry)
+			requestLogf(parent, "llama-cli failed (%v), retrying in %v (retry %d of %d)", err, backoff, retry, appArgs.MaxRetries)
+			metricsLlamaRetry()
+			if waitErr := sleepContext(ctx, backoff); waitErr != nil {
+				return nil, waitErr
+			}
+			output, stderr, err = runLlamaCommand(ctx, appArgs, args, forward)
+		}
+		return output, err
+	}
+	output, err := run(args)
+
+	// Some models/quant types reject flash attention; retry once without the flag
+	if err != nil && ctx.Err() == nil && isFlashAttentionFailure(err) {
+		if fallbackArgs, removed := removeLastArg(args, llamaCliArgs.FlashAttentionCmd); removed {
+			requestLogf(parent, "Flash attention not supported by model, retrying without %s", llamaCliArgs.FlashAttentionCmd)
+			args = fallbackArgs
+			resolved.FlashAttention = new(bool)
+			output, err = run(args)
+		}
+	}
+
+	// Transient immediate EOS often clears with a different seed, provided the seed can
+	// be changed and nothing was forwarded to a stream yet
+	if err == nil && appArgs.EmptyOutputRetries > 0 && isEmptyOutput(arguments, output) {
+		switch {
+		case llamaCliArgs.RandomSeedCmd == "":
+			requestLogf(parent, "Empty output, not retrying: RandomSeedCmd is not configured")
+		case streamed:
+			requestLogf(parent, "Empty output, not retrying: output was already streamed to the client")
+		default:
+			for retry := 1; retry <= appArgs.EmptyOutputRetries && err == nil && isEmptyOutput(arguments, output); retry++ {
+				var seed uint32
+				args, seed, _ = nudgeSeed(args, retry)
+				effectiveSeed := int(seed)
+				resolved.Seed = &effectiveSeed
+				requestLogf(parent, "Empty output, retrying with seed %d (retry %d of %d)", seed, retry, appArgs.EmptyOutputRetries)
+				output, err = run(args)
+			}
+		}
+	}
+
+	if err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)) {
+		return CompletionResult{}, fmt.Errorf("completion timed out after %d seconds: %w", timeoutSeconds, context.DeadlineExceeded)
+	}
+
+	// An immediate EOS or misconfigured template can exit cleanly with nothing generated
+	if err == nil && isEmptyOutput(arguments, output) {
+		requestLogf(parent, "Warning: llama-cli exited successfully but produced empty output")
+		if appArgs.EmptyOutputPolicy == "error" {
+			return CompletionResult{Warnings: warnings}, ErrEmptyOutput
+		}
+	}
+	result := CompletionResult{Output: output, Warnings: warnings, Resolved: resolved, Prompt: arguments.Prompt, AssistantPrefix: arguments.AssistantPrefix}
+	if err == nil {
+		result.Stats, _ = parsePerfStats(stderr)
+		if arguments.IncludeUsage {
+			usage := computeUsage(ctx, arguments, result)
+			result.Usage = &usage
+		}
 	}
+	return result, err
+}
 
-	logger.Printf("Completion generated successfully, output length: %d chars", len(output))
+// completionErrorResponse converts an executeCompletion error into the text
+// response returned to MCP clients, logging it along the way.
+//
+// Parameters:
+//   - err: The error returned by executeCompletion
+//   - arguments: The completion request that failed
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: Response describing the failure
+func completionErrorResponse(err error, arguments CompletionArguments) *mcpgolang.ToolResponse {
+	var message string
+	switch {
+	case errors.Is(err, ErrInvalidArguments):
+		// Handle invalid per-request overrides
+		logRequestf(arguments.RequestID, "Invalid completion arguments: %v", err)
+		message = fmt.Sprintf("Error: %v", err)
+	case errors.Is(err, ErrShuttingDown):
+		// Handle requests refused while draining for shutdown
+		logRequestf(arguments.RequestID, "Request refused: server is shutting down")
+		message = "Error: server is shutting down; retry the request"
+	case errors.Is(err, ErrServerBusy):
+		// Handle requests that found every completion slot busy for too long
+		logRequestf(arguments.RequestID, "Request rejected: %v", err)
+		message = fmt.Sprintf("Error: %v", err)
+	case errors.Is(err, ErrAdmissionRejected):
+		// Handle requests turned away by the admission policy
+		logRequestf(arguments.RequestID, "Request rejected by admission policy: %v", err)
+		message = fmt.Sprintf("Error: %v", err)
+	case errors.Is(err, ErrEmptyOutput):
+		// Handle empty output rejected by EmptyOutputPolicy
+		message = "Error: Model produced empty output (check the model, prompt template and stop settings)"
+	case errors.Is(err, context.Canceled):
+		// Handle requests aborted through cancel_completion
+		logRequestf(arguments.RequestID, "Completion was canceled")
+		message = "Error: Completion was canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		// Handle timeout errors specifically
+		logRequestf(arguments.RequestID, "Completion timed out after %d seconds", requestTimeoutSeconds(arguments))
+		message = fmt.Sprintf("Error: Completion timed out after %d seconds", requestTimeoutSeconds(arguments))
+	default:
+		// Handle other execution errors
+		logRequestf(arguments.RequestID, "Error generating completion: %v", redactText(err.Error()))
+		message = fmt.Sprintf("Error generating completion: %v", err)
+
+		// Include the failing command line and stderr so the failure can be reproduced;
+		// gated because the argv contains the prompt
+		var execErr *LlamaExecError
+		if appArgs.DebugErrorDetails && errors.As(err, &execErr) {
+			message += fmt.Sprintf("\n\nCommand:\n%s\n\nStderr:\n%s", formatArgv(execErr.Argv), stderrTail(execErr.Stderr, ErrorStderrTailBytes))
+		}
+	}
 
-	// Return successful completion as MCP tool response
 	return &mcpgolang.ToolResponse{
 		Content: []*mcpgolang.Content{
-			mcpgolang.NewTextContent(string(output)),
+			mcpgolang.NewTextContent(message),
 		},
-	}, nil
+	}
 }
 
-// prepareLlamaArgs constructs command-line arguments for LLama.cpp by combining
-// configuration from environment variables with the user-provided prompt.
-// It filters out any existing prompt arguments to avoid conflicts.
+// prepareLlamaArgs constructs command-line arguments for LLama.cpp execution
+// using both configuration defaults and optional runtime overrides.
 //
 // Parameters:
-//   - prompt: The user-provided prompt text to include in the arguments
+//   - arguments: The completion request containing the prompt and any overrides
 //
 // Returns:
-// prepareLlamaArgs constructs command-line arguments for LLama.cpp execution
-// using both configuration defaults and optional runtime overrides
-func prepareLlamaArgs(arguments CompletionArguments) []string {
-	var args []string
+//   - []string: The llama-cli argument list
+//   - []string: Non-fatal warnings to report to the client
+//   - error: An argument error if a per-request override is invalid
+func prepareLlamaArgs(arguments CompletionArguments) ([]string, []string, error) {
+	var args, warnings []string
 
 	// Core Model & Performance Parameters
 
-	// Model path - use override or default
+	// Model path - use override (resolved through registry names and aliases, and confined
+	// to ModelPath otherwise) or default
 	if arguments.Model != "" {
-		args = append(args, llamaCliArgs.ModelCmd, arguments.Model)
+		model, err := resolveModelPath(arguments.Model)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, warning := resolveModel(arguments.Model); warning != "" {
+			logRequestf(arguments.RequestID, "Deprecation warning: %s", warning)
+			if appArgs.ModelAliasWarnings {
+				warnings = append(warnings, warning)
+			}
+		}
+		args = append(args, llamaCliArgs.ModelCmd, model)
 	} else if llamaCliArgs.ModelFullPathVal != "" {
 		args = append(args, llamaCliArgs.ModelCmd, llamaCliArgs.ModelFullPathVal)
 	}
@@ -339,6 +1261,17 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.ThreadsCmd, llamaCliArgs.ThreadsVal)
 	}
 
+	// CPU threads for prompt processing - use override or default; ThreadsBatchCmd may be
+	// missing from older configurations
+	if arguments.ThreadsBatch > 0 {
+		if llamaCliArgs.ThreadsBatchCmd == "" {
+			return nil, nil, fmt.Errorf("threads_batch is not supported: ThreadsBatchCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.ThreadsBatchCmd, fmt.Sprintf("%d", arguments.ThreadsBatch))
+	} else if threadsBatchVal, err := strconv.Atoi(llamaCliArgs.ThreadsBatchVal); llamaCliArgs.ThreadsBatchCmd != "" && err == nil && threadsBatchVal > 0 {
+		args = append(args, llamaCliArgs.ThreadsBatchCmd, llamaCliArgs.ThreadsBatchVal)
+	}
+
 	// GPU layers - use override or default
 	if arguments.GpuLayers > 0 {
 		args = append(args, llamaCliArgs.GPULayersCmd, fmt.Sprintf("%d", arguments.GpuLayers))
@@ -346,11 +1279,111 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.GPULayersCmd, llamaCliArgs.GPULayersVal)
 	}
 
-	// Context size - use override or default
-	if arguments.CtxSize > 0 {
-		args = append(args, llamaCliArgs.CtxSizeCmd, fmt.Sprintf("%d", arguments.CtxSize))
-	} else if ctxSizeVal, err := strconv.Atoi(llamaCliArgs.CtxSizeVal); err == nil && ctxSizeVal > 0 {
-		args = append(args, llamaCliArgs.CtxSizeCmd, llamaCliArgs.CtxSizeVal)
+	// Multi-GPU split mode - use validated override or default; SplitModeCmd may be missing
+	// from older configurations
+	if arguments.SplitMode != "" {
+		if err := validateSplitMode(arguments.SplitMode); err != nil {
+			return nil, nil, err
+		}
+		if llamaCliArgs.SplitModeCmd == "" {
+			return nil, nil, fmt.Errorf("split_mode is not supported: SplitModeCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.SplitModeCmd, arguments.SplitMode)
+	} else if llamaCliArgs.SplitModeCmd != "" && validateSplitMode(llamaCliArgs.SplitModeCmdVal) == nil {
+		args = append(args, llamaCliArgs.SplitModeCmd, llamaCliArgs.SplitModeCmdVal)
+	}
+
+	// Main GPU - use validated override or default
+	if arguments.MainGPU != nil {
+		if *arguments.MainGPU < 0 {
+			return nil, nil, fmt.Errorf("main_gpu must be a GPU index, got %d", *arguments.MainGPU)
+		}
+		if llamaCliArgs.MainGPUCmd == "" {
+			return nil, nil, fmt.Errorf("main_gpu is not supported: MainGPUCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.MainGPUCmd, fmt.Sprintf("%d", *arguments.MainGPU))
+	} else if mainGPUVal, err := strconv.Atoi(llamaCliArgs.MainGPUVal); llamaCliArgs.MainGPUCmd != "" && err == nil && mainGPUVal >= 0 {
+		args = append(args, llamaCliArgs.MainGPUCmd, llamaCliArgs.MainGPUVal)
+	}
+
+	// Tensor split across GPUs - use validated override or default
+	if len(arguments.TensorSplit) > 0 {
+		if err := validateTensorSplit(arguments.TensorSplit); err != nil {
+			return nil, nil, err
+		}
+		if llamaCliArgs.TensorSplitCmd == "" {
+			return nil, nil, fmt.Errorf("tensor_split is not supported: TensorSplitCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.TensorSplitCmd, formatTensorSplit(arguments.TensorSplit))
+	} else if llamaCliArgs.TensorSplitCmd != "" && llamaCliArgs.TensorSplitVal != "" {
+		if ratios, err := parseTensorSplit(llamaCliArgs.TensorSplitVal); err == nil && validateTensorSplit(ratios) == nil {
+			args = append(args, llamaCliArgs.TensorSplitCmd, formatTensorSplit(ratios))
+		}
+	}
+
+	// Context size - use override or default, clamped to the model's trained maximum
+	ctxSize := arguments.CtxSize
+	if ctxSize <= 0 {
+		ctxSize, _ = strconv.Atoi(llamaCliArgs.CtxSizeVal)
+	}
+	if maxCtx := modelMaxContext(effectiveModel(arguments)); maxCtx > 0 && ctxSize > maxCtx {
+		warning := fmt.Sprintf("ctx_size %d exceeds the model maximum of %d, using %d", ctxSize, maxCtx, maxCtx)
+		logRequestf(arguments.RequestID, "Warning: %s", warning)
+		warnings = append(warnings, warning)
+		ctxSize = maxCtx
+	}
+	if ctxSize > 0 {
+		args = append(args, llamaCliArgs.CtxSizeCmd, fmt.Sprintf("%d", ctxSize))
+	}
+
+	// RoPE scaling type, factor and YaRN original context - use validated overrides or
+	// defaults; the flags may be missing from older configurations
+	if arguments.RopeScaling != "" {
+		if err := validateRopeScaling(arguments.RopeScaling); err != nil {
+			return nil, nil, err
+		}
+		if llamaCliArgs.RopeScalingCmd == "" {
+			return nil, nil, fmt.Errorf("rope_scaling is not supported: RopeScalingCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.RopeScalingCmd, arguments.RopeScaling)
+	} else if llamaCliArgs.RopeScalingCmd != "" && validateRopeScaling(llamaCliArgs.RopeScalingCmdVal) == nil {
+		args = append(args, llamaCliArgs.RopeScalingCmd, llamaCliArgs.RopeScalingCmdVal)
+	}
+	if arguments.RopeScale != 0 {
+		if arguments.RopeScale < 0 || math.IsInf(arguments.RopeScale, 0) {
+			return nil, nil, fmt.Errorf("rope_scale must be a positive number, got %g", arguments.RopeScale)
+		}
+		if llamaCliArgs.RopeScaleCmd == "" {
+			return nil, nil, fmt.Errorf("rope_scale is not supported: RopeScaleCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.RopeScaleCmd, strconv.FormatFloat(arguments.RopeScale, 'g', -1, 64))
+	} else if ropeScaleVal, err := strconv.ParseFloat(llamaCliArgs.RopeScaleVal, 64); llamaCliArgs.RopeScaleCmd != "" && err == nil && ropeScaleVal > 0 {
+		args = append(args, llamaCliArgs.RopeScaleCmd, llamaCliArgs.RopeScaleVal)
+	}
+	if arguments.YarnOrigContext != 0 {
+		if arguments.YarnOrigContext < 0 {
+			return nil, nil, fmt.Errorf("yarn_orig_ctx must be a positive token count, got %d", arguments.YarnOrigContext)
+		}
+		if llamaCliArgs.YarnOrigContextCmd == "" {
+			return nil, nil, fmt.Errorf("yarn_orig_ctx is not supported: YarnOrigContextCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.YarnOrigContextCmd, fmt.Sprintf("%d", arguments.YarnOrigContext))
+	} else if yarnOrigVal, err := strconv.Atoi(llamaCliArgs.YarnOrigContextCmdVal); llamaCliArgs.YarnOrigContextCmd != "" && err == nil && yarnOrigVal > 0 {
+		args = append(args, llamaCliArgs.YarnOrigContextCmd, llamaCliArgs.YarnOrigContextCmdVal)
+	}
+
+	// Tokens kept from the prompt when the context is shifted - use validated override
+	// or default; like MinPCmd, KeepCmd may be missing from older configurations
+	if arguments.Keep != 0 {
+		if arguments.Keep < -1 {
+			return nil, nil, fmt.Errorf("keep must be -1 (the whole prompt) or a token count, got %d", arguments.Keep)
+		}
+		if llamaCliArgs.KeepCmd == "" {
+			return nil, nil, fmt.Errorf("keep is not supported: KeepCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.KeepCmd, fmt.Sprintf("%d", arguments.Keep))
+	} else if keepVal, err := strconv.Atoi(llamaCliArgs.KeepVal); llamaCliArgs.KeepCmd != "" && err == nil && keepVal >= -1 {
+		args = append(args, llamaCliArgs.KeepCmd, llamaCliArgs.KeepVal)
 	}
 
 	// Batch size - use override or default
@@ -360,6 +1393,50 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.BatchCmd, llamaCliArgs.BatchCmdVal)
 	}
 
+	// Micro-batch size - use validated override or default. llama.cpp quietly lowers a
+	// ubatch larger than the batch, so such a request is rejected instead
+	if arguments.UBatchSize > 0 {
+		batchSize := arguments.BatchSize
+		if batchSize <= 0 {
+			batchSize, _ = strconv.Atoi(llamaCliArgs.BatchCmdVal)
+		}
+		if batchSize > 0 && arguments.UBatchSize > batchSize {
+			return nil, nil, fmt.Errorf("ubatch_size %d exceeds the batch size of %d", arguments.UBatchSize, batchSize)
+		}
+		if llamaCliArgs.UBatchCmd == "" {
+			return nil, nil, fmt.Errorf("ubatch_size is not supported: UBatchCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.UBatchCmd, fmt.Sprintf("%d", arguments.UBatchSize))
+	} else if uBatchVal, err := strconv.Atoi(llamaCliArgs.UBatchCmdVal); llamaCliArgs.UBatchCmd != "" && err == nil && uBatchVal > 0 {
+		args = append(args, llamaCliArgs.UBatchCmd, llamaCliArgs.UBatchCmdVal)
+	}
+
+	// CPU affinity mask - use validated override or default
+	if arguments.CpuMask != "" {
+		if err := validateCpuMask(arguments.CpuMask); err != nil {
+			return nil, nil, err
+		}
+		if llamaCliArgs.CpuMaskCmd == "" {
+			return nil, nil, fmt.Errorf("cpu_mask is not supported: CpuMaskCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.CpuMaskCmd, arguments.CpuMask)
+	} else if llamaCliArgs.CpuMaskCmd != "" && llamaCliArgs.CpuMaskVal != "" && validateCpuMask(llamaCliArgs.CpuMaskVal) == nil {
+		args = append(args, llamaCliArgs.CpuMaskCmd, llamaCliArgs.CpuMaskVal)
+	}
+
+	// CPU affinity range - use validated override or default
+	if arguments.CpuRange != "" {
+		if err := validateCpuRange(arguments.CpuRange); err != nil {
+			return nil, nil, err
+		}
+		if llamaCliArgs.CpuRangeCmd == "" {
+			return nil, nil, fmt.Errorf("cpu_range is not supported: CpuRangeCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.CpuRangeCmd, arguments.CpuRange)
+	} else if llamaCliArgs.CpuRangeCmd != "" && llamaCliArgs.CpuRangeVal != "" && validateCpuRange(llamaCliArgs.CpuRangeVal) == nil {
+		args = append(args, llamaCliArgs.CpuRangeCmd, llamaCliArgs.CpuRangeVal)
+	}
+
 	// Generation Control Parameters
 
 	// Predict/tokens to generate - use override or default
@@ -376,6 +1453,33 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.TemperatureCmd, llamaCliArgs.TemperatureVal)
 	}
 
+	// Dynamic temperature - use validated override or default; nothing is passed unless
+	// the range is nonzero, and the exponent only with it. The default needs its flag, so
+	// a DynatempRangeVal without DynatempRangeCmd is ignored rather than failing requests
+	if err := validateDynatemp(arguments.DynatempRange, arguments.DynatempExp); err != nil {
+		return nil, nil, err
+	}
+	dynatempRange := arguments.DynatempRange
+	if dynatempRange == 0 && llamaCliArgs.DynatempRangeCmd != "" {
+		if rangeVal, err := strconv.ParseFloat(llamaCliArgs.DynatempRangeVal, 64); err == nil && validateDynatemp(rangeVal, 0) == nil {
+			dynatempRange = rangeVal
+		}
+	}
+	if dynatempRange > 0 {
+		if llamaCliArgs.DynatempRangeCmd == "" {
+			return nil, nil, fmt.Errorf("dynatemp_range is not supported: DynatempRangeCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.DynatempRangeCmd, strconv.FormatFloat(dynatempRange, 'g', -1, 64))
+		if arguments.DynatempExp > 0 {
+			if llamaCliArgs.DynatempExpCmd == "" {
+				return nil, nil, fmt.Errorf("dynatemp_exp is not supported: DynatempExpCmd is not configured")
+			}
+			args = append(args, llamaCliArgs.DynatempExpCmd, strconv.FormatFloat(arguments.DynatempExp, 'g', -1, 64))
+		} else if expVal, err := strconv.ParseFloat(llamaCliArgs.DynatempExpVal, 64); llamaCliArgs.DynatempExpCmd != "" && err == nil && expVal > 0 {
+			args = append(args, llamaCliArgs.DynatempExpCmd, llamaCliArgs.DynatempExpVal)
+		}
+	}
+
 	// Top-K sampling - use override or default
 	if arguments.TopK > 0 {
 		args = append(args, llamaCliArgs.TopKCmd, fmt.Sprintf("%d", arguments.TopK))
@@ -390,6 +1494,48 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.TopPCmd, llamaCliArgs.TopPVal)
 	}
 
+	// Min-P sampling - use validated override or default. The default is passed even when
+	// 0 since llama-cli otherwise applies its own non-zero min-p; configurations from
+	// before MinPCmd was used may not set it, so nothing is passed then
+	if arguments.MinP != 0 {
+		if arguments.MinP < 0 || arguments.MinP > 1 {
+			return nil, nil, fmt.Errorf("min_p must be in [0, 1], got %g", arguments.MinP)
+		}
+		if llamaCliArgs.MinPCmd == "" {
+			return nil, nil, fmt.Errorf("min_p is not supported: MinPCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.MinPCmd, strconv.FormatFloat(arguments.MinP, 'g', -1, 64))
+	} else if minPVal, err := strconv.ParseFloat(llamaCliArgs.MinPVal, 64); llamaCliArgs.MinPCmd != "" && err == nil && minPVal >= 0 && minPVal <= 1 {
+		args = append(args, llamaCliArgs.MinPCmd, llamaCliArgs.MinPVal)
+	}
+
+	// Locally typical sampling - use validated override or default
+	if arguments.TypicalP != 0 {
+		if arguments.TypicalP < 0 || arguments.TypicalP > 1 {
+			return nil, nil, fmt.Errorf("typical_p must be in (0, 1], got %g", arguments.TypicalP)
+		}
+		if llamaCliArgs.TypicalPCmd == "" {
+			return nil, nil, fmt.Errorf("typical_p is not supported: TypicalPCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.TypicalPCmd, strconv.FormatFloat(arguments.TypicalP, 'g', -1, 64))
+	} else if typicalPVal, err := strconv.ParseFloat(llamaCliArgs.TypicalPVal, 64); llamaCliArgs.TypicalPCmd != "" && err == nil && typicalPVal > 0 && typicalPVal <= 1 {
+		args = append(args, llamaCliArgs.TypicalPCmd, llamaCliArgs.TypicalPVal)
+	}
+
+	// Tail free sampling - use validated override or default. Recent llama-cli builds
+	// dropped --tfs, so TfsCmd is left empty for them and nothing is passed
+	if arguments.Tfs != 0 {
+		if arguments.Tfs < 0 || arguments.Tfs > 1 {
+			return nil, nil, fmt.Errorf("tfs must be in (0, 1], got %g", arguments.Tfs)
+		}
+		if llamaCliArgs.TfsCmd == "" {
+			return nil, nil, fmt.Errorf("tfs is not supported: TfsCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.TfsCmd, strconv.FormatFloat(arguments.Tfs, 'g', -1, 64))
+	} else if tfsVal, err := strconv.ParseFloat(llamaCliArgs.TfsVal, 64); llamaCliArgs.TfsCmd != "" && err == nil && tfsVal > 0 && tfsVal <= 1 {
+		args = append(args, llamaCliArgs.TfsCmd, llamaCliArgs.TfsVal)
+	}
+
 	// Repeat penalty - use override or default
 	if arguments.RepeatPenalty > 0 {
 		args = append(args, llamaCliArgs.RepeatPenaltyCmd, fmt.Sprintf("%.2f", arguments.RepeatPenalty))
@@ -397,12 +1543,116 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.RepeatPenaltyCmd, llamaCliArgs.RepeatPenaltyVal)
 	}
 
+	// Repeat penalty window - use validated override or default; RepeatLastPenaltyCmd may
+	// be missing from older configurations
+	if arguments.RepeatLastN != 0 {
+		if arguments.RepeatLastN < -1 {
+			return nil, nil, fmt.Errorf("repeat_last_n must be -1 (the whole context) or a token count, got %d", arguments.RepeatLastN)
+		}
+		if llamaCliArgs.RepeatLastPenaltyCmd == "" {
+			return nil, nil, fmt.Errorf("repeat_last_n is not supported: RepeatLastPenaltyCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.RepeatLastPenaltyCmd, fmt.Sprintf("%d", arguments.RepeatLastN))
+	} else if repeatLastNVal, err := strconv.Atoi(llamaCliArgs.RepeatLastPenaltyVal); llamaCliArgs.RepeatLastPenaltyCmd != "" && err == nil && repeatLastNVal >= -1 {
+		args = append(args, llamaCliArgs.RepeatLastPenaltyCmd, llamaCliArgs.RepeatLastPenaltyVal)
+	}
+
+	// Mirostat - use validated override or default; tau and eta are passed only when
+	// mirostat is on
+	if err := validateMirostat(arguments.Mirostat, arguments.MirostatTau, arguments.MirostatEta); err != nil {
+		return nil, nil, err
+	}
+	mirostat := arguments.Mirostat
+	if mirostat != 0 && llamaCliArgs.MirostatCmd == "" {
+		return nil, nil, fmt.Errorf("mirostat is not supported: MirostatCmd is not configured")
+	}
+	if mirostat == 0 && llamaCliArgs.MirostatCmd != "" {
+		if mirostatVal, err := strconv.Atoi(llamaCliArgs.MirostatVal); err == nil && validateMirostat(mirostatVal, 0, 0) == nil {
+			mirostat = mirostatVal
+		}
+	}
+	if mirostat != 0 {
+		args = append(args, llamaCliArgs.MirostatCmd, fmt.Sprintf("%d", mirostat))
+		if arguments.MirostatTau > 0 {
+			if llamaCliArgs.MirostatTauCmd == "" {
+				return nil, nil, fmt.Errorf("mirostat_tau is not supported: MirostatTauCmd is not configured")
+			}
+			args = append(args, llamaCliArgs.MirostatTauCmd, strconv.FormatFloat(arguments.MirostatTau, 'g', -1, 64))
+		} else if tauVal, err := strconv.ParseFloat(llamaCliArgs.MirostatTauVal, 64); llamaCliArgs.MirostatTauCmd != "" && err == nil && tauVal > 0 {
+			args = append(args, llamaCliArgs.MirostatTauCmd, llamaCliArgs.MirostatTauVal)
+		}
+		if arguments.MirostatEta > 0 {
+			if llamaCliArgs.MirostatEtaCmd == "" {
+				return nil, nil, fmt.Errorf("mirostat_eta is not supported: MirostatEtaCmd is not configured")
+			}
+			args = append(args, llamaCliArgs.MirostatEtaCmd, strconv.FormatFloat(arguments.MirostatEta, 'g', -1, 64))
+		} else if etaVal, err := strconv.ParseFloat(llamaCliArgs.MirostatEtaVal, 64); llamaCliArgs.MirostatEtaCmd != "" && err == nil && etaVal > 0 {
+			args = append(args, llamaCliArgs.MirostatEtaCmd, llamaCliArgs.MirostatEtaVal)
+		}
+	}
+
+	// Sampler chain - use validated override or default
+	if len(arguments.Samplers) > 0 {
+		if err := validateSamplers(arguments.Samplers); err != nil {
+			return nil, nil, err
+		}
+		if llamaCliArgs.SamplersCmd == "" {
+			return nil, nil, fmt.Errorf("samplers is not supported: SamplersCmd is not configured")
+		}
+		args = append(args, llamaCliArgs.SamplersCmd, strings.Join(arguments.Samplers, ";"))
+	} else if samplers := parseSamplers(llamaCliArgs.SamplersVal); llamaCliArgs.SamplersCmd != "" && len(samplers) > 0 && validateSamplers(samplers) == nil {
+		args = append(args, llamaCliArgs.SamplersCmd, strings.Join(samplers, ";"))
+	}
+
+	// Logit bias - one flag per biased token
+	logitBias, err := logitBiasArgs(arguments)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = append(args, logitBias...)
+
+	// GBNF grammar constraining the output
+	grammar, err := grammarArgs(arguments)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = append(args, grammar...)
+
+	// Stop sequences - each passed as a reverse prompt
+	for _, stop := range passedStopSequences(arguments) {
+		args = append(args, llamaCliArgs.ReversePromptCmd, stop)
+	}
+
+	// Random seed - explicit, or derived per turn so a conversation replays identically
+	if arguments.Seed != nil && *arguments.Seed >= 0 {
+		if err := validateSeed(arguments); err != nil {
+			return nil, nil, err
+		}
+		args = append(args, llamaCliArgs.RandomSeedCmd, fmt.Sprintf("%d", *arguments.Seed))
+	} else if arguments.ConversationID != "" {
+		if arguments.Turn < 0 {
+			return nil, nil, fmt.Errorf("turn must not be negative")
+		}
+		if llamaCliArgs.RandomSeedCmd == "" {
+			return nil, nil, fmt.Errorf("conversation_id is not supported: RandomSeedCmd is not configured")
+		}
+		seed := conversationSeed(arguments.ConversationID, arguments.Turn)
+		logRequestf(arguments.RequestID, "Using seed %d for conversation %q turn %d", seed, arguments.ConversationID, arguments.Turn)
+		args = append(args, llamaCliArgs.RandomSeedCmd, fmt.Sprintf("%d", seed))
+	}
+
 	// Prompt file - use override or check if prompt should be from file
 	if arguments.PromptFile != "" {
+		if arguments.AssistantPrefix != "" {
+			return nil, nil, fmt.Errorf("assistant_prefix cannot be combined with prompt_file")
+		}
 		args = append(args, llamaCliArgs.PromptFileCmd, arguments.PromptFile)
 	} else if arguments.Prompt != "" {
-		// Direct prompt input
-		args = append(args, llamaCliArgs.PromptCmd, arguments.Prompt)
+		// Direct prompt input, ending with the assistant prefix so generation continues from it.
+		// exec passes argv without a shell and llama-cli takes the argument after PromptCmd as
+		// its value verbatim, so prompts that look like flags ("--model x") stay prompt text.
+		// PromptCmd defaults to --prompt so the prompt is never a stray positional argument
+		args = append(args, llamaCliArgs.PromptCmd, arguments.Prompt+arguments.AssistantPrefix)
 	}
 
 	// Log file - use override or default
@@ -417,11 +1667,30 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.MultilineInputCmd)
 	}
 
-	if llamaCliArgs.FlashAttentionCmdEnabled {
+	// Flash attention - use override or default
+	flashAttention := llamaCliArgs.FlashAttentionCmdEnabled
+	if arguments.FlashAttention != nil {
+		flashAttention = *arguments.FlashAttention
+	}
+	if flashAttention {
 		args = append(args, llamaCliArgs.FlashAttentionCmd)
 	}
 
-	if llamaCliArgs.PromptCacheVal != "" {
+	// Prompt cache - prompts starting with the base KV cache prefix open it read-only.
+	// Otherwise caching is skipped entirely while the cache volume is below the free space
+	// minimum. Prompts sharing the configured system prefix use a stable cache file keyed
+	// by the prefix hash so the prefix is only evaluated once
+	if baseCache := baseCacheFile(arguments); baseCache != "" {
+		args = append(args, llamaCliArgs.PromptCacheCmd, baseCache, llamaCliArgs.PromptCacheROCmd)
+	} else if cacheWritesDisabled.Load() {
+		logRequestf(arguments.RequestID, "Skipping prompt cache: cache volume is low on disk space")
+	} else if cacheFile, readOnly := sharedPrefixCacheFile(arguments.Prompt); cacheFile != "" {
+		logRequestf(arguments.RequestID, "Using shared prefix prompt cache %s", cacheFile)
+		args = append(args, llamaCliArgs.PromptCacheCmd, cacheFile)
+		if readOnly && llamaCliArgs.PromptCacheROCmd != "" {
+			args = append(args, llamaCliArgs.PromptCacheROCmd)
+		}
+	} else if llamaCliArgs.PromptCacheVal != "" {
 		args = append(args, llamaCliArgs.PromptCacheCmd, llamaCliArgs.PromptCacheVal)
 	}
 
@@ -441,5 +1710,5 @@ func prepareLlamaArgs(arguments CompletionArguments) []string {
 		args = append(args, llamaCliArgs.NoContextShiftCmd)
 	}
 
-	return args
+	return args, warnings, nil
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// setLlamaCliArgs replaces the llama-cli configuration for the duration of a test.
+func setLlamaCliArgs(t *testing.T, args LlamaCliArgs) {
+	t.Helper()
+	saved := llamaCliArgs
+	llamaCliArgs = args
+	t.Cleanup(func() { llamaCliArgs = saved })
+}
+
+// flagValue returns the argument following the last occurrence of flag in args.
+func flagValue(args []string, flag string) (string, bool) {
+	for i := len(args) - 2; i >= 0; i-- {
+		if args[i] == flag {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+func TestPrepareLlamaArgsFlashAttention(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name       string
+		envDefault bool
+		override   *bool
+		expect     bool
+	}{
+		{name: "enabled overrides disabled default", envDefault: false, override: &enabled, expect: true},
+		{name: "disabled overrides enabled default", envDefault: true, override: &disabled, expect: false},
+		{name: "unset uses enabled default", envDefault: true, override: nil, expect: true},
+		{name: "unset uses disabled default", envDefault: false, override: nil, expect: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLlamaCliArgs(t, LlamaCliArgs{
+				PromptCmd:                "--prompt",
+				FlashAttentionCmd:        "--flash-attn",
+				FlashAttentionCmdEnabled: tt.envDefault,
+			})
+			args, _, err := prepareLlamaArgs(CompletionArguments{Prompt: "Hello", FlashAttention: tt.override})
+			if err != nil {
+				t.Fatalf("prepareLlamaArgs() error = %v", err)
+			}
+			if got := slices.Contains(args, "--flash-attn"); got != tt.expect {
+				t.Errorf("--flash-attn present = %v, want %v (args %q)", got, tt.expect, args)
+			}
+		})
+	}
+}
+
+func TestPrepareLlamaArgsFlagLikePrompt(t *testing.T) {
+	setLlamaCliArgs(t, LlamaCliArgs{PromptCmd: "--prompt"})
+
+	for _, prompt := range []string{"--help", "-n 5", "--model /tmp/other.gguf", "-"} {
+		t.Run(prompt, func(t *testing.T) {
+			args, _, err := prepareLlamaArgs(CompletionArguments{Prompt: prompt})
+			if err != nil {
+				t.Fatalf("prepareLlamaArgs() error = %v", err)
+			}
+			if got, ok := flagValue(args, "--prompt"); !ok || got != prompt {
+				t.Fatalf("argument after --prompt = %q, want %q (args %q)", got, prompt, args)
+			}
+			if i, got := slices.Index(args, "--prompt"), slices.Index(args, prompt); got != i+1 {
+				t.Errorf("prompt found at argv[%d], want only argv[%d] (args %q)", got, i+1, args)
+			}
+		})
+	}
+}
+
+func TestPrepareLlamaArgsTypicalP(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmd      string
+		val      string
+		typicalP float64
+		expect   string // Expected value after --typical; "" when the flag must be absent
+		wantErr  bool
+	}{
+		{name: "request value", cmd: "--typical", val: "1.0", typicalP: 0.95, expect: "0.95"},
+		{name: "request value is not rounded", cmd: "--typical", typicalP: 0.333, expect: "0.333"},
+		{name: "configured default", cmd: "--typical", val: "0.9", expect: "0.9"},
+		{name: "invalid default is ignored", cmd: "--typical", val: "1.5", expect: ""},
+		{name: "out of range", cmd: "--typical", typicalP: 1.5, wantErr: true},
+		{name: "not configured", typicalP: 0.95, wantErr: true},
+		{name: "default without a command", val: "0.9", expect: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLlamaCliArgs(t, LlamaCliArgs{PromptCmd: "--prompt", TypicalPCmd: tt.cmd, TypicalPVal: tt.val})
+			args, _, err := prepareLlamaArgs(CompletionArguments{Prompt: "Hello", TypicalP: tt.typicalP})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareLlamaArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, ok := flagValue(args, "--typical")
+			if tt.expect == "" {
+				if ok || (tt.val != "" && slices.Contains(args, tt.val)) {
+					t.Errorf("typical_p passed, want it absent (args %q)", args)
+				}
+				return
+			}
+			if got != tt.expect {
+				t.Errorf("--typical = %q, want %q (args %q)", got, tt.expect, args)
+			}
+		})
+	}
+}
+
+func TestPrepareLlamaArgsKeep(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		val     string
+		keep    int
+		expect  string // Expected value after --keep; "" when the flag must be absent
+		wantErr bool
+	}{
+		{name: "request value", cmd: "--keep", val: "0", keep: 256, expect: "256"},
+		{name: "whole prompt", cmd: "--keep", keep: -1, expect: "-1"},
+		{name: "configured default", cmd: "--keep", val: "64", expect: "64"},
+		{name: "no default", cmd: "--keep", expect: ""},
+		{name: "invalid", cmd: "--keep", keep: -2, wantErr: true},
+		{name: "not configured", keep: 256, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLlamaCliArgs(t, LlamaCliArgs{PromptCmd: "--prompt", KeepCmd: tt.cmd, KeepVal: tt.val})
+			args, _, err := prepareLlamaArgs(CompletionArguments{Prompt: "Hello", Keep: tt.keep})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareLlamaArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, ok := flagValue(args, "--keep")
+			if tt.expect == "" {
+				if ok {
+					t.Errorf("--keep = %q, want it absent (args %q)", got, args)
+				}
+				return
+			}
+			if got != tt.expect {
+				t.Errorf("--keep = %q, want %q (args %q)", got, tt.expect, args)
+			}
+		})
+	}
+}
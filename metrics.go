@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// completionOutcome classifies how a completion request finished for metrics purposes
+type completionOutcome int
+
+const (
+	outcomeError    completionOutcome = iota // Request failed during generation
+	outcomeSuccess                           // Completion generated successfully
+	outcomeTimeout                           // Request exceeded its timeout
+	outcomeAccepted                          // Request handed off to an asynchronous job
+	outcomeCanceled                          // Request canceled by the client or cancel_completion
+	outcomeBusy                              // Request turned away because no slot freed up in time
+	outcomeInvalid                           // Request rejected for its arguments before running
+)
+
+// metricsDurationBuckets are the upper bounds, in seconds, of the request duration
+// histogram exposed by the Prometheus endpoint
+var metricsDurationBuckets = [...]float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// recentOutcome is a finished request kept for the rolling error rate
+type recentOutcome struct {
+	at     time.Time // When the request finished
+	failed bool      // Whether it ended in an error or timeout
+}
+
+// Server-wide completion statistics shared by all requests
+var (
+	metrics        CompletionMetrics // Accumulated counters for the server's lifetime
+	recentOutcomes []recentOutcome   // Requests finished within HealthWindowSeconds, oldest first
+	metricsMu      sync.Mutex        // Guards metrics and recentOutcomes
+)
+
+// metricsRequestStarted counts a newly received completion request
+func metricsRequestStarted() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.RequestCount++
+}
+
+// metricsRequestFinished records the outcome, duration, and generated tokens of a
+// completion request and returns a snapshot of the updated counters.
+//
+// Parameters:
+//   - outcome: How the request finished
+//   - duration: Wall-clock time spent on the request
+//   - tokens: Approximate number of tokens generated (zero on failure)
+//
+// Returns:
+//   - CompletionMetrics: Snapshot of the counters after recording
+func metricsRequestFinished(outcome completionOutcome, duration time.Duration, tokens int) CompletionMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	switch outcome {
+	case outcomeSuccess:
+		metrics.SuccessCount++
+		metrics.TotalTokens += int64(tokens)
+		metrics.AverageTokens = float64(metrics.TotalTokens) / float64(metrics.SuccessCount)
+	case outcomeTimeout:
+		metrics.TimeoutCount++
+	case outcomeError:
+		metrics.ErrorCount++
+	case outcomeCanceled:
+		metrics.CanceledCount++
+	case outcomeInvalid:
+		metrics.InvalidCount++
+	default:
+		// Busy requests are counted as rejected when turned away and never ran
+		return metrics
+	}
+	metrics.TotalDuration += duration
+	for i, bound := range metricsDurationBuckets {
+		if duration.Seconds() <= bound {
+			metrics.DurationBuckets[i]++
+			break
+		}
+	}
+
+	// Only requests the server ran count toward the health error rate; canceled and
+	// invalid requests say nothing about whether generation works
+	if outcome == outcomeSuccess || outcome == outcomeError || outcome == outcomeTimeout {
+		recentOutcomes = append(recentOutcomes, recentOutcome{at: time.Now(), failed: outcome != outcomeSuccess})
+	}
+	pruneRecentOutcomes()
+	return metrics
+}
+
+// pruneRecentOutcomes drops outcomes older than HealthWindowSeconds. Callers must hold metricsMu.
+func pruneRecentOutcomes() {
+	cutoff := time.Now().Add(-time.Duration(appArgs.HealthWindowSeconds) * time.Second)
+	i := 0
+	for i < len(recentOutcomes) && recentOutcomes[i].at.Before(cutoff) {
+		i++
+	}
+	recentOutcomes = recentOutcomes[i:]
+}
+
+// recentErrorRate returns the fraction of requests that failed or timed out within
+// the last HealthWindowSeconds. Canceled, busy and invalid requests are left out.
+//
+// Returns:
+//   - float64: The error rate between 0 and 1 (0 when no requests finished)
+//   - int: The number of requests the rate is based on
+func recentErrorRate() (float64, int) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	pruneRecentOutcomes()
+	if len(recentOutcomes) == 0 {
+		return 0, 0
+	}
+	failed := 0
+	for _, outcome := range recentOutcomes {
+		if outcome.failed {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(recentOutcomes)), len(recentOutcomes)
+}
+
+// metricsCacheLookup counts a response cache hit or miss.
+//
+// Parameters:
+//   - hit: Whether the request was answered from the cache
+func metricsCacheLookup(hit bool) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if hit {
+		metrics.CacheHits++
+	} else {
+		metrics.CacheMisses++
+	}
+}
+
+// metricsRequestQueued counts a request that had to wait for a MaxConcurrentRequests slot
+func metricsRequestQueued() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.QueuedCount++
+}
+
+// metricsRequestRejected counts a request turned away because no slot freed up in time
+func metricsRequestRejected() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.RejectedCount++
+}
+
+// metricsLlamaRetry counts a llama-cli relaunch after a transient failure
+func metricsLlamaRetry() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.RetryCount++
+}
+
+// metricsRequestCoalesced counts a request that waited for an identical request in flight
+func metricsRequestCoalesced() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.CoalescedCount++
+}
+
+// metricsRequestThrottled counts a tool call rejected by the per-client rate limit
+func metricsRequestThrottled() {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.ThrottledCount++
+}
+
+// metricsCacheEvicted counts response cache entries removed by LRU pressure or expiry.
+//
+// Parameters:
+//   - count: The number of entries removed
+func metricsCacheEvicted(count int) {
+	if count == 0 {
+		return
+	}
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics.CacheEvictions += int64(count)
+}
+
+// metricsSnapshot returns a consistent copy of the server-wide counters
+//
+// Returns:
+//   - CompletionMetrics: Snapshot of the current counters
+func metricsSnapshot() CompletionMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	return metrics
+}
+
+// FinishedCount returns the number of finished requests whose duration was recorded
+func (m CompletionMetrics) FinishedCount() int64 {
+	return m.SuccessCount + m.ErrorCount + m.TimeoutCount + m.CanceledCount + m.InvalidCount
+}
+
+// AverageDuration returns the mean wall-clock time per finished request
+func (m CompletionMetrics) AverageDuration() time.Duration {
+	finished := m.FinishedCount()
+	if finished == 0 {
+		return 0
+	}
+	return time.Duration(int64(m.TotalDuration) / finished)
+}
+
+// TokensPerSecond returns the approximate generation throughput across all requests
+func (m CompletionMetrics) TokensPerSecond() float64 {
+	if m.TotalDuration <= 0 {
+		return 0
+	}
+	return float64(m.TotalTokens) / m.TotalDuration.Seconds()
+}
+
+// outcomeForError maps an executeCompletion error to a metrics outcome.
+//
+// Parameters:
+//   - err: The error returned by executeCompletion, or nil on success
+//
+// Returns:
+//   - completionOutcome: The matching outcome
+func outcomeForError(err error) completionOutcome {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case errors.Is(err, ErrServerBusy):
+		// Checked first: a request turned away after its timeout never ran
+		return outcomeBusy
+	case errors.Is(err, context.DeadlineExceeded):
+		return outcomeTimeout
+	case errors.Is(err, context.Canceled):
+		return outcomeCanceled
+	case errors.Is(err, ErrInvalidArguments):
+		return outcomeInvalid
+	default:
+		return outcomeError
+	}
+}
+
+// estimateTokens approximates the token count of text using the common
+// four-characters-per-token heuristic. It is used when llama-cli's own token
+// statistics are unavailable.
+//
+// Parameters:
+//   - text: The text to estimate
+//
+// Returns:
+//   - int: The approximate token count
+func estimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
+
+// logSlowRequest logs a WARN line for requests slower than SlowRequestThresholdSeconds,
+// including the prompt length and the request parameters (without the prompt text)
+// so latency outliers can be traced to their inputs. A non-positive threshold disables it.
+//
+// Parameters:
+//   - requestID: The request or job id
+//   - arguments: The completion request
+//   - duration: Wall-clock time the request took
+func logSlowRequest(requestID string, arguments CompletionArguments, duration time.Duration) {
+	threshold := time.Duration(appArgs.SlowRequestThresholdSeconds) * time.Second
+	if threshold <= 0 || duration <= threshold {
+		return
+	}
+
+	promptLength := len(arguments.Prompt)
+	arguments.Prompt = ""
+	params, _ := json.Marshal(arguments)
+	logWithFields(map[string]any{"request_id": requestID, "model": filepath.Base(effectiveModel(arguments)), "duration_ms": duration.Milliseconds()},
+		"WARN: Slow request %s took %v (threshold %v): prompt_length=%d params=%s", requestID, duration, threshold, promptLength, params)
+}
+
+// startMetricsLogger logs a metrics summary every MetricsLogIntervalSeconds until
+// the context is canceled. A non-positive interval disables periodic logging.
+//
+// Parameters:
+//   - ctx: Context whose cancellation stops the logger
+func startMetricsLogger(ctx context.Context) {
+	if appArgs.MetricsLogIntervalSeconds <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(appArgs.MetricsLogIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m := metricsSnapshot()
+				logger.Printf("Metrics: requests=%d success=%d errors=%d timeouts=%d canceled=%d invalid=%d avg_latency=%v avg_tokens=%.1f tokens_per_sec=%.1f queued=%d queue_depth=%d rejected=%d retries=%d coalesced=%d throttled=%d",
+					m.RequestCount, m.SuccessCount, m.ErrorCount, m.TimeoutCount, m.CanceledCount, m.InvalidCount, m.AverageDuration(), m.AverageTokens, m.TokensPerSecond(), m.QueuedCount, requestQueueDepth(), m.RejectedCount, m.RetryCount, m.CoalescedCount, m.ThrottledCount)
+			}
+		}
+	}()
+}
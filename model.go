@@ -1,10 +1,42 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
 )
 
+// activeProcesses counts llama.cpp child processes (llama-cli, llama-tokenize) currently running
+var activeProcesses atomic.Int64
+
+// LlamaExecError describes a llama-cli process that exited unsuccessfully,
+// carrying the captured stderr so callers can diagnose the failure.
+type LlamaExecError struct {
+	Err    error    // Underlying execution error (usually *exec.ExitError)
+	Stderr string   // Standard error output captured from llama-cli
+	Argv   []string // Full command line (binary followed by arguments) that failed
+}
+
+// Error implements the error interface, adding the last lines of stderr where
+// llama.cpp reports why it failed (e.g. a model that could not be loaded)
+func (e *LlamaExecError) Error() string {
+	if summary := stderrSummary(e.Stderr); summary != "" {
+		return e.Err.Error() + ": " + summary
+	}
+	return e.Err.Error()
+}
+
+// Unwrap exposes the underlying execution error to errors.Is/As
+func (e *LlamaExecError) Unwrap() error {
+	return e.Err
+}
+
 // GenerateSingleCompletionWithCancel executes a LLama.cpp command with cancellation support.
 // It runs the command in a separate goroutine to allow for context cancellation and timeouts.
 //
@@ -17,27 +49,103 @@ import (
 //   - []byte: The output from the LLama.cpp command
 //   - error: Any error that occurred during execution or context cancellation
 func GenerateSingleCompletionWithCancel(ctx context.Context, appArgs DefaultAppArgs, args []string) ([]byte, error) {
+	output, _, err := runLlamaCommand(ctx, appArgs, args, nil)
+	return output, err
+}
+
+// GenerateStreamingCompletion executes a LLama.cpp command and reports its standard
+// output incrementally as it is produced, for callers that expose partial results.
+// Cancellation and timeouts are handled through the context, which kills the process.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - appArgs: Application configuration containing the path to llama-cli
+//   - args: Command-line arguments to pass to llama-cli
+//   - onChunk: Called with each chunk of output as it is read; must not retain the slice
+//
+// Returns:
+//   - []byte: The complete output from the LLama.cpp command
+//   - error: Any error that occurred during execution or context cancellation
+func GenerateStreamingCompletion(ctx context.Context, appArgs DefaultAppArgs, args []string, onChunk func([]byte)) ([]byte, error) {
+	output, _, err := runLlamaCommand(ctx, appArgs, args, onChunk)
+	return output, err
+}
+
+// runLlamaCommand executes a LLama.cpp command and returns both its output and its
+// stderr, which carries the performance statistics printed after generation. With
+// onChunk set the output is streamed; otherwise it is buffered and the call returns
+// as soon as the context is done.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - appArgs: Application configuration containing the path to llama-cli
+//   - args: Command-line arguments to pass to llama-cli
+//   - onChunk: Optional callback receiving output chunks as they are read
+//
+// Returns:
+//   - []byte: The output from the LLama.cpp command
+//   - string: The captured standard error
+//   - error: Any error that occurred during execution or context cancellation
+func runLlamaCommand(ctx context.Context, appArgs DefaultAppArgs, args []string, onChunk func([]byte)) ([]byte, string, error) {
+	// Don't spawn a doomed process for a request canceled or timed out while queued
+	if err := ctx.Err(); err != nil {
+		logRequestf(requestIDFromContext(ctx), "Not starting %s: request already done (%v)", filepath.Base(appArgs.LLamaCliPath), err)
+		return nil, "", err
+	}
+
+	// Only one run at a time may write a given prompt cache file
+	releaseCacheFile, err := acquirePromptCacheWrite(ctx, args)
+	if err != nil {
+		return nil, "", err
+	}
+	defer releaseCacheFile()
+
+	// Pass prompts too long for a single argument through a temporary file
+	args, removePromptFile, err := withLongPromptFile(args)
+	if err != nil {
+		return nil, "", err
+	}
+	defer removePromptFile()
+
+	if onChunk != nil {
+		return runLlamaStreaming(ctx, appArgs, args, onChunk)
+	}
+
 	// Create a child context with cancel to ensure proper cleanup
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	// Create a channel to capture the command execution result
-	// Using an anonymous struct to bundle output and error together
+	// Using an anonymous struct to bundle output, stderr and error together
 	result := make(chan struct {
 		output []byte
+		stderr string
 		err    error
 	})
 
 	// Execute the command in a separate goroutine to enable cancellation
 	go func() {
-		// Run llama-cli with the provided arguments and context
-		out, err := exec.CommandContext(ctx, appArgs.LLamaCliPath, args...).Output()
+		// Run llama-cli with the provided arguments and context, capturing stdout (the
+		// completion) and stderr (logs, statistics and errors) separately
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, appArgs.LLamaCliPath, args...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		activeProcesses.Add(1)
+		err := cmd.Run()
+		activeProcesses.Add(-1)
+		out := stdout.Bytes()
+		if err != nil {
+			err = &LlamaExecError{Err: err, Stderr: stderr.String(), Argv: cmd.Args}
+			logFailedStderr(ctx, cmd.Args[0], stderr.String())
+		}
 
 		// Send the result back through the channel
 		result <- struct {
 			output []byte
+			stderr string
 			err    error
-		}{output: out, err: err}
+		}{output: out, stderr: stderr.String(), err: err}
 
 		// Close the channel to signal completion
 		close(result)
@@ -47,9 +155,182 @@ func GenerateSingleCompletionWithCancel(ctx context.Context, appArgs DefaultAppA
 	select {
 	case res := <-result:
 		// Command completed successfully or with an error
-		return res.output, res.err
+		return res.output, res.stderr, res.err
 	case <-ctx.Done():
 		// Context was canceled or timed out
-		return nil, ctx.Err()
+		return nil, "", ctx.Err()
+	}
+}
+
+// runLlamaStreaming is the streaming half of runLlamaCommand.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - appArgs: Application configuration containing the path to llama-cli
+//   - args: Command-line arguments to pass to llama-cli
+//   - onChunk: Called with each chunk of output as it is read
+//
+// Returns:
+//   - []byte: The complete output from the LLama.cpp command
+//   - string: The captured standard error
+//   - error: Any error that occurred during execution or context cancellation
+func runLlamaStreaming(ctx context.Context, appArgs DefaultAppArgs, args []string, onChunk func([]byte)) ([]byte, string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, appArgs.LLamaCliPath, args...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, "", &LlamaExecError{Err: err, Argv: cmd.Args}
+	}
+	activeProcesses.Add(1)
+	defer activeProcesses.Add(-1)
+
+	// Read until llama-cli closes stdout, forwarding each chunk as it arrives. Once the
+	// request is canceled or times out nothing more is forwarded; the killed process
+	// closes stdout and ends the loop
+	var output bytes.Buffer
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := stdout.Read(buf)
+		if n > 0 && ctx.Err() == nil {
+			output.Write(buf[:n])
+			onChunk(buf[:n])
+		}
+		if readErr != nil {
+			break
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return output.Bytes(), stderr.String(), ctx.Err()
+		}
+		logFailedStderr(ctx, cmd.Args[0], stderr.String())
+		return output.Bytes(), stderr.String(), &LlamaExecError{Err: err, Stderr: stderr.String(), Argv: cmd.Args}
+	}
+	return output.Bytes(), stderr.String(), nil
+}
+
+// formatArgv renders a command line so it can be pasted into a shell, quoting any
+// argument that contains whitespace or shell metacharacters.
+//
+// Parameters:
+//   - argv: The binary followed by its arguments
+//
+// Returns:
+//   - string: The command line
+func formatArgv(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`|&;<>()*?[]{}!#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// stderrTail returns at most the last n bytes of captured stderr, trimmed of
+// surrounding whitespace, since llama.cpp prints the actual failure last.
+//
+// Parameters:
+//   - stderr: The captured standard error
+//   - n: Maximum number of bytes to keep
+//
+// Returns:
+//   - string: The tail of stderr
+func stderrTail(stderr string, n int) string {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) > n {
+		stderr = "..." + stderr[len(stderr)-n:]
+	}
+	return stderr
+}
+
+// stderrSummary returns the last few lines of captured stderr, bounded to
+// ErrorStderrSummaryBytes, for error messages.
+//
+// Parameters:
+//   - stderr: The captured standard error
+//
+// Returns:
+//   - string: The final lines joined with "; ", or "" when stderr is empty
+func stderrSummary(stderr string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(stderr), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > ErrorStderrSummaryLines {
+		lines = lines[len(lines)-ErrorStderrSummaryLines:]
+	}
+	return stderrTail(strings.Join(lines, "; "), ErrorStderrSummaryBytes)
+}
+
+// logFailedStderr records the full stderr of a failed llama.cpp process: in the app
+// log when LogLlamaStderr is enabled, and in the request's debug log if it has one.
+//
+// Parameters:
+//   - ctx: The request context
+//   - binary: Path of the executable that failed
+//   - stderr: The captured standard error
+func logFailedStderr(ctx context.Context, binary, stderr string) {
+	if strings.TrimSpace(stderr) == "" {
+		return
+	}
+	message := fmt.Sprintf("%s stderr:\n%s", filepath.Base(binary), strings.TrimRight(stderr, "\n"))
+	if appArgs.LogLlamaStderr {
+		logRequestf(requestIDFromContext(ctx), "DEBUG: %s", redactText(message))
+	}
+	debugLogf(ctx, "%s", message)
+}
+
+// flashAttentionFailurePattern matches the llama.cpp error reporting that flash attention
+// is not supported by the loaded model or backend. Startup lines that merely mention the
+// setting, such as "flash_attn = 1", do not match.
+var flashAttentionFailurePattern = regexp.MustCompile(`(?im)flash[_ ]?att(?:n|ention)\b[^\n]*\b(?:not supported|unsupported)\b`)
+
+// isFlashAttentionFailure reports whether a llama-cli failure was caused by flash
+// attention being unsupported, based on the stderr signature of the failed process.
+//
+// Parameters:
+//   - err: The error returned by GenerateSingleCompletionWithCancel
+//
+// Returns:
+//   - bool: True if the failure looks flash-attention related
+func isFlashAttentionFailure(err error) bool {
+	var execErr *LlamaExecError
+	if !errors.As(err, &execErr) {
+		return false
+	}
+	return flashAttentionFailurePattern.MatchString(execErr.Stderr)
+}
+
+// removeLastArg returns a copy of args without the last occurrence of the given flag.
+// The last occurrence is used because server-controlled switches are appended after
+// user-supplied values such as the prompt.
+//
+// Parameters:
+//   - args: The llama-cli argument list
+//   - flag: The flag to remove
+//
+// Returns:
+//   - []string: The filtered argument list
+//   - bool: Whether the flag was found and removed
+func removeLastArg(args []string, flag string) ([]string, bool) {
+	if flag == "" {
+		return args, false
+	}
+	for i := len(args) - 1; i >= 0; i-- {
+		if args[i] == flag {
+			out := make([]string, 0, len(args)-1)
+			out = append(out, args[:i]...)
+			return append(out, args[i+1:]...), true
+		}
 	}
+	return args, false
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// startupStderr is the context setup llama-cli logs on every run with -fa, trimmed from
+// a real session. It mentions flash_attn without reporting a failure.
+const startupStderr = `llama_model_loader: loaded meta data with 29 key-value pairs and 291 tensors from models/Meta-Llama-3-8B-Instruct-Q4_K_M.gguf (version GGUF V3 (latest))
+llm_load_tensors: offloading 32 repeating layers to GPU
+llm_load_tensors: offloaded 33/33 layers to GPU
+llama_new_context_with_model: n_ctx      = 8192
+llama_new_context_with_model: n_batch    = 2048
+llama_new_context_with_model: n_ubatch   = 512
+llama_new_context_with_model: flash_attn = 1
+llama_new_context_with_model: freq_base  = 500000.0
+llama_new_context_with_model: freq_scale = 1
+llama_kv_cache_init:      CUDA0 KV buffer size =  1024.00 MiB
+`
+
+func TestIsFlashAttentionFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{
+			name:   "startup log of an unrelated failure",
+			err:    &LlamaExecError{Err: errors.New("exit status 1"), Stderr: startupStderr + "main: error: unable to load model\n"},
+			expect: false,
+		},
+		{
+			name:   "flash_attn not supported",
+			err:    &LlamaExecError{Err: errors.New("exit status 1"), Stderr: startupStderr + "llama_init_from_model: flash_attn is not supported by this model\n"},
+			expect: true,
+		},
+		{
+			name:   "flash attention unsupported by backend",
+			err:    &LlamaExecError{Err: errors.New("exit status 1"), Stderr: "ggml_metal_init: flash attention unsupported on this device\n"},
+			expect: true,
+		},
+		{
+			name:   "not an exec error",
+			err:    errors.New("flash_attn is not supported"),
+			expect: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFlashAttentionFailure(tt.err); got != tt.expect {
+				t.Errorf("isFlashAttentionFailure() = %v, want %v", got, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// buildCompletionContent applies the post-processing requested in the arguments to
+// a successful completion and assembles the response content blocks. Without any
+// formatting options the plain completion text is returned unchanged.
+//
+// Parameters:
+//   - arguments: The completion request and its formatting options
+//   - output: The raw completion text
+//
+// Returns:
+//   - []*mcpgolang.Content: The response content blocks
+//   - error: Any error that occurred while encoding structured output
+func buildCompletionContent(arguments CompletionArguments, output string) ([]*mcpgolang.Content, error) {
+	var content []*mcpgolang.Content
+
+	// llama-cli only returns the continuation when the prompt isn't displayed, so the
+	// prefill must be restored here; with the prompt echoed it is already present
+	if arguments.IncludePrefix && arguments.AssistantPrefix != "" && llamaCliArgs.NoDisplayPromptEnabled {
+		output = arguments.AssistantPrefix + output
+	}
+
+	// Split off the reasoning block first so later steps only see the final answer
+	if arguments.SeparateReasoning {
+		startTag, endTag := reasoningTagsFor(effectiveModel(arguments))
+		reasoning, answer := splitReasoning(output, startTag, endTag)
+		data, err := json.Marshal(ReasoningOutput{Reasoning: reasoning, Answer: answer})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode reasoning: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+		output = answer
+	}
+
+	// Return the output split into marker-delimited sections when requested
+	if arguments.OutputSections {
+		sections, err := sectionsContent(output, arguments.IncludeRaw)
+		if err != nil {
+			return nil, err
+		}
+		return append(content, sections...), nil
+	}
+
+	if content != nil {
+		return content, nil
+	}
+	return []*mcpgolang.Content{mcpgolang.NewTextContent(output)}, nil
+}
+
+// llamaLogLinePrefixes start the informational lines llama.cpp builds may print to
+// standard output around the generated text (model loading, sampler setup, timings)
+var llamaLogLinePrefixes = []string{
+	"llama_", "llm_", "ggml_", "gguf_", "load_tensors:", "load:", "print_info:", "build:",
+	"main:", "system_info:", "sampler ", "sampler seed:", "generate:", "common_", "clip_",
+}
+
+// endOfTextMarkers are control markers llama-cli may print after the completion
+var endOfTextMarkers = []string{"[end of text]", "</s>", "<|endoftext|>", "<|im_end|>", "<|eot_id|>", "<|end|>"}
+
+// isLlamaLogLine reports whether a line is one of llama.cpp's informational lines.
+//
+// Parameters:
+//   - line: The output line without its newline
+//
+// Returns:
+//   - bool: Whether the line starts with a known llama.cpp log prefix
+func isLlamaLogLine(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, prefix := range llamaLogLinePrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanOutput removes what llama-cli prints around the completion itself: llama.cpp
+// log lines before the text, the echoed prompt, and end-of-text markers and log lines
+// after it. Only leading and trailing lines are considered, so completions that discuss
+// llama.cpp keep their text, and a prompt that itself begins with log-like text is
+// matched as the echo before any line is dropped.
+//
+// Parameters:
+//   - output: The raw llama-cli output
+//   - prompt: The echoed prompt (see echoedPrompt), removed from the start of the output
+//
+// Returns:
+//   - string: The cleaned completion text
+func cleanOutput(output, prompt string) string {
+	// Drop leading log lines (and the blank lines between them) until the text or the
+	// prompt echo begins
+	for inLog := false; !(prompt != "" && strings.HasPrefix(output, prompt)); {
+		line, rest, found := strings.Cut(output, "\n")
+		if !found || !(isLlamaLogLine(line) || inLog && strings.TrimSpace(line) == "") {
+			break
+		}
+		inLog = true
+		output = rest
+	}
+
+	// The prompt is echoed unless NoDisplayPromptEnabled; a model repeating it is left alone
+	if !llamaCliArgs.NoDisplayPromptEnabled && prompt != "" {
+		output = strings.TrimPrefix(output, prompt)
+	}
+
+	// Drop trailing log lines and end-of-text markers, in any order
+	for {
+		trimmed := strings.TrimRightFunc(output, unicode.IsSpace)
+		if i := strings.LastIndexByte(trimmed, '\n'); i >= 0 && isLlamaLogLine(trimmed[i+1:]) {
+			output = trimmed[:i+1]
+			continue
+		}
+		marker := ""
+		for _, candidate := range endOfTextMarkers {
+			if strings.HasSuffix(trimmed, candidate) {
+				marker = candidate
+				break
+			}
+		}
+		if marker == "" {
+			return output
+		}
+		output = strings.TrimSuffix(trimmed, marker)
+	}
+}
+
+// completionText turns a finished completion's raw llama-cli output into the completion
+// text: log lines, the prompt echo and end-of-text markers are removed (unless
+// clean_output is false) and generation is cut at the request's stop sequences.
+//
+// Parameters:
+//   - arguments: The completion request
+//   - result: The completion
+//
+// Returns:
+//   - string: The completion text
+func completionText(arguments CompletionArguments, result CompletionResult) string {
+	output := string(result.Output)
+	if arguments.CleanOutput == nil || *arguments.CleanOutput {
+		output = cleanOutput(output, echoedPrompt(arguments, result))
+	}
+	if stops := stopSequences(arguments); len(stops) > len(passedStopSequences(arguments)) {
+		output = truncateAtStop(output, stops, arguments.IncludeStopInOutput)
+	} else if !arguments.IncludeStopInOutput {
+		output = trimStopSequence(output, stops)
+	}
+	return output
+}
+
+// completionContent applies the output post-processing shared by synchronous calls,
+// background jobs and callbacks: completionText, then max_output_chars, then the
+// formatting options of buildCompletionContent, followed by the truncation block when
+// the text was capped.
+//
+// Parameters:
+//   - arguments: The completion request and its formatting options
+//   - result: The completion
+//
+// Returns:
+//   - []*mcpgolang.Content: The completion's response content blocks
+//   - string: The completion text after max_output_chars and before formatting, for logging
+//   - error: Any error that occurred while encoding structured output
+func completionContent(arguments CompletionArguments, result CompletionResult) ([]*mcpgolang.Content, string, error) {
+	output := completionText(arguments, result)
+
+	// Cap the returned text for display; generation length is controlled by predict
+	var truncation *TruncationInfo
+	if arguments.MaxOutputChars > 0 {
+		var info TruncationInfo
+		output, info = truncateOutput(output, arguments.MaxOutputChars)
+		truncation = &info
+	}
+
+	content, err := buildCompletionContent(arguments, output)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Report the full length so clients know whether the text was cut
+	if truncation != nil {
+		data, err := json.Marshal(map[string]*TruncationInfo{"truncation": truncation})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to encode truncation info: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+	}
+	return content, output, nil
+}
+
+// contentText joins the text of content blocks, one block per line, for places that
+// carry a completion as a single string.
+//
+// Parameters:
+//   - content: The content blocks
+//
+// Returns:
+//   - string: The blocks' text
+func contentText(content []*mcpgolang.Content) string {
+	texts := make([]string, 0, len(content))
+	for _, block := range content {
+		if block.TextContent != nil {
+			texts = append(texts, block.TextContent.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// echoedPrompt returns the text llama-cli echoes before the completion when the prompt
+// is displayed: the prompt it actually ran with, after templates and variables, and the
+// assistant prefix unless the request keeps it with include_prefix.
+//
+// Parameters:
+//   - arguments: The completion request and its formatting options
+//   - result: The completion, carrying the prompt llama-cli ran with
+//
+// Returns:
+//   - string: The text to remove from the start of the output
+func echoedPrompt(arguments CompletionArguments, result CompletionResult) string {
+	if arguments.IncludePrefix {
+		return result.Prompt
+	}
+	return result.Prompt + result.AssistantPrefix
+}
+
+// stopSequences returns the stop sequences a request ends generation at: the request's
+// stop strings, plus a blank line when stop_on_double_newline (or the
+// StopOnDoubleNewline default) is set. Empty and repeated strings are dropped.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - []string: The stop sequences in request order, possibly none
+func stopSequences(arguments CompletionArguments) []string {
+	stops := append([]string(nil), arguments.Stop...)
+	stopOnDoubleNewline := appArgs.StopOnDoubleNewline
+	if arguments.StopOnDoubleNewline != nil {
+		stopOnDoubleNewline = *arguments.StopOnDoubleNewline
+	}
+	if stopOnDoubleNewline {
+		stops = append(stops, "\n\n")
+	}
+
+	var unique []string
+	for _, stop := range stops {
+		if stop != "" && !slices.Contains(unique, stop) {
+			unique = append(unique, stop)
+		}
+	}
+	return unique
+}
+
+// passedStopSequences returns the stop sequences handed to llama-cli as reverse
+// prompts: all of them, or only the first when ReversePromptRepeatable is off because
+// the binary keeps just one. None are passed without a ReversePromptCmd.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - []string: The stop sequences llama-cli stops at itself
+func passedStopSequences(arguments CompletionArguments) []string {
+	stops := stopSequences(arguments)
+	if llamaCliArgs.ReversePromptCmd == "" {
+		return nil
+	}
+	if !llamaCliArgs.ReversePromptRepeatable && len(stops) > 1 {
+		return stops[:1]
+	}
+	return stops
+}
+
+// truncateAtStop cuts the output at the earliest occurrence of any stop sequence. It
+// handles the stop sequences llama-cli was not given, which it generated past.
+//
+// Parameters:
+//   - output: The completion text
+//   - stops: The request's stop sequences
+//   - includeStop: Keep the matched stop sequence at the end of the output
+//
+// Returns:
+//   - string: The output up to the first stop sequence, or unchanged if none occurs
+func truncateAtStop(output string, stops []string, includeStop bool) string {
+	cut, matched := -1, ""
+	for _, stop := range stops {
+		if i := strings.Index(output, stop); i >= 0 && (cut < 0 || i < cut || (i == cut && len(stop) > len(matched))) {
+			cut, matched = i, stop
+		}
+	}
+	if cut < 0 {
+		return output
+	}
+	if includeStop {
+		return output[:cut+len(matched)]
+	}
+	return output[:cut]
+}
+
+// trimStopSequence removes the stop sequence that ended generation from the end of the
+// output. Depending on version, llama-cli may or may not print the matched reverse
+// prompt, so it is stripped here for consistent output. Trailing whitespace printed
+// after the stop sequence is dropped with it; the longest matching sequence wins.
+//
+// Parameters:
+//   - output: The completion text
+//   - stops: The request's stop sequences
+//
+// Returns:
+//   - string: The output without a trailing stop sequence
+func trimStopSequence(output string, stops []string) string {
+	stops = append([]string(nil), stops...)
+	sort.Slice(stops, func(i, j int) bool { return len(stops[i]) > len(stops[j]) })
+
+	trimmed := strings.TrimRightFunc(output, unicode.IsSpace)
+	for _, candidate := range []string{output, trimmed} {
+		for _, stop := range stops {
+			if stop != "" && strings.HasSuffix(candidate, stop) {
+				return strings.TrimSuffix(candidate, stop)
+			}
+		}
+	}
+	return output
+}
+
+// TruncationInfo describes how max_output_chars affected the returned text
+type TruncationInfo struct {
+	Truncated      bool `json:"truncated"`       // Whether the text was cut
+	FullLength     int  `json:"full_length"`     // Length of the generated text in characters
+	ReturnedLength int  `json:"returned_length"` // Characters kept, excluding the marker
+}
+
+// truncateOutput cuts the output to at most limit characters (runes, so multi-byte
+// text is never split mid-character) and appends TruncationMarker when it was cut.
+//
+// Parameters:
+//   - output: The completion text
+//   - limit: Maximum number of characters to keep
+//
+// Returns:
+//   - string: The possibly truncated text
+//   - TruncationInfo: The full and returned lengths
+func truncateOutput(output string, limit int) (string, TruncationInfo) {
+	runes := []rune(output)
+	info := TruncationInfo{FullLength: len(runes), ReturnedLength: len(runes)}
+	if len(runes) <= limit {
+		return output, info
+	}
+
+	info.Truncated = true
+	info.ReturnedLength = limit
+	return string(runes[:limit]) + appArgs.TruncationMarker, info
+}
+
+// warningsContent renders non-fatal request warnings as a JSON content block.
+//
+// Parameters:
+//   - warnings: The warnings raised for the request
+//
+// Returns:
+//   - *mcpgolang.Content: A {"warnings": [...]} block, or nil when there are none
+//   - error: Any error that occurred while encoding the warnings
+func warningsContent(warnings []string) (*mcpgolang.Content, error) {
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(map[string][]string{"warnings": warnings})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode warnings: %w", err)
+	}
+	return mcpgolang.NewTextContent(string(data)), nil
+}
+
+// ReasoningOutput is the response shape for separate_reasoning requests
+type ReasoningOutput struct {
+	Reasoning string `json:"reasoning"` // Content of the model's thinking block
+	Answer    string `json:"answer"`    // Final answer following the thinking block
+}
+
+// splitReasoning separates a reasoning model's thinking block from its final answer.
+// Missing tags are handled gracefully: without a start tag, text before an end tag is
+// treated as reasoning (templates often open the block inside the prompt); without an
+// end tag, everything after the start tag is reasoning; with neither, the whole
+// output is the answer.
+//
+// Parameters:
+//   - output: The completion text
+//   - startTag: Tag opening the reasoning block (e.g., "<think>")
+//   - endTag: Tag closing the reasoning block (e.g., "</think>")
+//
+// Returns:
+//   - string: The reasoning text
+//   - string: The answer text
+func splitReasoning(output, startTag, endTag string) (string, string) {
+	before, afterStart, hasStart := strings.Cut(output, startTag)
+	if !hasStart || startTag == "" {
+		if reasoning, answer, hasEnd := strings.Cut(output, endTag); hasEnd && endTag != "" {
+			return strings.TrimSpace(reasoning), strings.TrimSpace(answer)
+		}
+		return "", strings.TrimSpace(output)
+	}
+
+	reasoning, answer, hasEnd := strings.Cut(afterStart, endTag)
+	if !hasEnd {
+		return strings.TrimSpace(afterStart), strings.TrimSpace(before)
+	}
+	return strings.TrimSpace(reasoning), strings.TrimSpace(before + answer)
+}
+
+// reasoningTagsFor returns the reasoning delimiter tags for a model. The first entry in
+// ReasoningModelTags whose model fragment appears in the model file name
+// (case-insensitive) takes precedence over the global ReasoningStartTag/ReasoningEndTag.
+//
+// Parameters:
+//   - model: The model path used for the request
+//
+// Returns:
+//   - string: The start tag
+//   - string: The end tag
+func reasoningTagsFor(model string) (string, string) {
+	name := strings.ToLower(filepath.Base(model))
+	for _, tags := range appArgs.ReasoningModelTags {
+		if strings.Contains(name, strings.ToLower(tags.Model)) {
+			return tags.Start, tags.End
+		}
+	}
+	return appArgs.ReasoningStartTag, appArgs.ReasoningEndTag
+}
+
+// OutputSection is one marker-delimited section of a completion
+type OutputSection struct {
+	Title string `json:"title"` // Heading text following the marker; empty for content before the first marker
+	Body  string `json:"body"`  // Section content up to the next marker
+}
+
+// splitSections splits completion output into sections at lines that begin with one
+// of the configured markers (e.g., "##"). A marker only matches when followed by
+// whitespace or the end of the line, so "##" does not split on "###" headings.
+// Non-blank content before the first marker is kept as an untitled section.
+//
+// Parameters:
+//   - output: The completion text
+//   - markers: Section markers to split on
+//
+// Returns:
+//   - []OutputSection: The parsed sections in order
+func splitSections(output string, markers []string) []OutputSection {
+	var sections []OutputSection
+	current := &OutputSection{}
+	var body []string
+
+	flush := func() {
+		current.Body = strings.TrimSpace(strings.Join(body, "\n"))
+		if current.Title != "" || current.Body != "" {
+			sections = append(sections, *current)
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if title, ok := matchSectionMarker(line, markers); ok {
+			flush()
+			current = &OutputSection{Title: title}
+			body = nil
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return sections
+}
+
+// matchSectionMarker checks whether a line starts a new section.
+//
+// Parameters:
+//   - line: The output line to inspect
+//   - markers: Section markers to match
+//
+// Returns:
+//   - string: The section title following the marker
+//   - bool: Whether the line starts a section
+func matchSectionMarker(line string, markers []string) (string, bool) {
+	for _, marker := range markers {
+		if !strings.HasPrefix(line, marker) {
+			continue
+		}
+		rest := line[len(marker):]
+		if rest == "" || unicode.IsSpace(rune(rest[0])) {
+			return strings.TrimSpace(rest), true
+		}
+	}
+	return "", false
+}
+
+// sectionsContent renders completion output as a JSON array of sections, optionally
+// preceded by the raw text so simple clients still get the plain completion first.
+//
+// Parameters:
+//   - output: The completion text
+//   - includeRaw: Whether to include the unparsed output as well
+//
+// Returns:
+//   - []*mcpgolang.Content: The response content blocks
+//   - error: Any error that occurred while encoding the sections
+func sectionsContent(output string, includeRaw bool) ([]*mcpgolang.Content, error) {
+	sections := splitSections(output, appArgs.SectionMarkers)
+	if sections == nil {
+		sections = []OutputSection{}
+	}
+
+	data, err := json.Marshal(map[string][]OutputSection{"sections": sections})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sections: %w", err)
+	}
+
+	var content []*mcpgolang.Content
+	if includeRaw {
+		content = append(content, mcpgolang.NewTextContent(output))
+	}
+	return append(content, mcpgolang.NewTextContent(string(data))), nil
+}
+
+// isEmptyOutput reports whether llama-cli generated nothing, judged on the output with
+// log lines, end-of-text markers and the echoed prompt and assistant prefix removed, so
+// a run that only echoed its prompt counts as empty.
+//
+// Parameters:
+//   - arguments: The completion request as passed to llama-cli
+//   - output: The raw llama-cli output
+//
+// Returns:
+//   - bool: True when no generated text remains
+func isEmptyOutput(arguments CompletionArguments, output []byte) bool {
+	return strings.TrimSpace(cleanOutput(string(output), arguments.Prompt+arguments.AssistantPrefix)) == ""
+}
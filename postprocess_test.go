@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompletionTextStopSequence(t *testing.T) {
+	noClean := false
+	tests := []struct {
+		name          string
+		reversePrompt string // ReversePromptCmd; "" when llama-cli is not given the stop
+		output        string
+		strip         string // Expected text with include_stop_in_output off (the default)
+		include       string // Expected text with include_stop_in_output on
+	}{
+		{
+			name:          "stop printed by llama-cli",
+			reversePrompt: "--reverse-prompt",
+			output:        "The answer.\nUser:",
+			strip:         "The answer.\n",
+			include:       "The answer.\nUser:",
+		},
+		{
+			name:          "stop printed with trailing whitespace",
+			reversePrompt: "--reverse-prompt",
+			output:        "The answer.\nUser: \n",
+			strip:         "The answer.\n",
+			include:       "The answer.\nUser: \n",
+		},
+		{
+			name:          "stop not printed by llama-cli",
+			reversePrompt: "--reverse-prompt",
+			output:        "The answer.\n",
+			strip:         "The answer.\n",
+			include:       "The answer.\n",
+		},
+		{
+			name:    "stop generated past without a reverse prompt",
+			output:  "The answer.\nUser: and more",
+			strip:   "The answer.\n",
+			include: "The answer.\nUser:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLlamaCliArgs(t, LlamaCliArgs{PromptCmd: "--prompt", ReversePromptCmd: tt.reversePrompt, ReversePromptRepeatable: true})
+			arguments := CompletionArguments{Prompt: "Question?", Stop: []string{"User:"}, CleanOutput: &noClean}
+
+			args, _, err := prepareLlamaArgs(arguments)
+			if err != nil {
+				t.Fatalf("prepareLlamaArgs() error = %v", err)
+			}
+			if got, ok := flagValue(args, "--reverse-prompt"); tt.reversePrompt != "" && (!ok || got != "User:") {
+				t.Errorf("--reverse-prompt = %q, want %q (args %q)", got, "User:", args)
+			}
+
+			result := CompletionResult{Output: []byte(tt.output)}
+			if got := completionText(arguments, result); got != tt.strip {
+				t.Errorf("completionText() = %q, want %q", got, tt.strip)
+			}
+			arguments.IncludeStopInOutput = true
+			if got := completionText(arguments, result); got != tt.include {
+				t.Errorf("completionText() with include_stop_in_output = %q, want %q", got, tt.include)
+			}
+		})
+	}
+}
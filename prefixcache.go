@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// sharedPrefix holds the configured shared system prompt and the hash that names its cache file
+type sharedPrefix struct {
+	text string // Shared system content that requests may start with
+	hash string // Hex SHA-256 of text, used to tie the cache file to the content
+}
+
+var (
+	sharedPrefixValue sharedPrefix // Loaded shared prefix, empty when not configured
+	sharedPrefixOnce  sync.Once    // Guards the one-time load of SharedPrefixFile
+)
+
+// loadSharedPrefix reads SharedPrefixFile once and caches its content and hash.
+// A missing or unreadable file disables the shared-prefix cache with a logged warning.
+//
+// Returns:
+//   - sharedPrefix: The loaded prefix; text is empty when the feature is disabled
+func loadSharedPrefix() sharedPrefix {
+	sharedPrefixOnce.Do(func() {
+		if appArgs.SharedPrefixFile == "" {
+			return
+		}
+
+		data, err := os.ReadFile(appArgs.SharedPrefixFile)
+		if err != nil {
+			logger.Printf("Warning: shared prefix cache disabled, cannot read %s: %v", appArgs.SharedPrefixFile, err)
+			return
+		}
+		if len(data) == 0 {
+			return
+		}
+
+		sum := sha256.Sum256(data)
+		sharedPrefixValue = sharedPrefix{text: string(data), hash: hex.EncodeToString(sum[:])}
+		logger.Printf("Loaded shared system prefix (%d bytes, hash %.12s)", len(data), sharedPrefixValue.hash)
+	})
+	return sharedPrefixValue
+}
+
+// sharedPrefixCacheFile returns the stable prompt cache file for prompts that start with
+// the configured shared system prefix. The file name is derived from the prefix hash so
+// that editing the system content automatically starts a fresh cache.
+//
+// Parameters:
+//   - prompt: The request prompt
+//
+// Returns:
+//   - string: The cache file path, or "" if the prompt doesn't share the prefix
+//   - bool: Whether the cache file already exists and should be opened read-only
+func sharedPrefixCacheFile(prompt string) (string, bool) {
+	prefix := loadSharedPrefix()
+	if prefix.text == "" || appArgs.PromptCachePath == "" || !strings.HasPrefix(prompt, prefix.text) {
+		return "", false
+	}
+
+	cacheFile := filepath.Join(appArgs.PromptCachePath, "shared-prefix-"+prefix.hash[:16]+".bin")
+	_, err := os.Stat(cacheFile)
+	return cacheFile, err == nil
+}
+
+// Per-file locks serializing llama-cli runs that write a prompt cache file
+var (
+	promptCacheWriters   = make(map[string]chan struct{}) // Cache file path -> single-slot lock
+	promptCacheWritersMu sync.Mutex                       // Guards promptCacheWriters
+)
+
+// acquirePromptCacheWrite waits until no other llama-cli run is writing the prompt cache
+// file an argument list names. llama-cli rewrites the file it is given unless it is opened
+// read-only, so concurrent requests sharing one (the shared prefix cache before it exists
+// or without PromptCacheROCmd, or PromptCacheVal) would otherwise write it at the same time.
+//
+// Parameters:
+//   - ctx: Context whose cancellation abandons the wait
+//   - args: The llama-cli argument list
+//
+// Returns:
+//   - func(): Releases the file; a no-op when the run writes no prompt cache
+//   - error: The context error if the request ended while waiting
+func acquirePromptCacheWrite(ctx context.Context, args []string) (func(), error) {
+	if llamaCliArgs.PromptCacheCmd == "" || (llamaCliArgs.PromptCacheROCmd != "" && slices.Contains(args, llamaCliArgs.PromptCacheROCmd)) {
+		return func() {}, nil
+	}
+	i := slices.Index(args, llamaCliArgs.PromptCacheCmd)
+	if i < 0 || i+1 >= len(args) {
+		return func() {}, nil
+	}
+	cacheFile := filepath.Clean(args[i+1])
+
+	promptCacheWritersMu.Lock()
+	lock, ok := promptCacheWriters[cacheFile]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		promptCacheWriters[cacheFile] = lock
+	}
+	promptCacheWritersMu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	default:
+	}
+	logRequestf(requestIDFromContext(ctx), "Waiting for another request writing prompt cache %s", cacheFile)
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
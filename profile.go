@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// ProfileParametersArguments defines the input structure for the MCP profile_parameters tool
+type ProfileParametersArguments struct {
+	Prompt     string   `json:"prompt" description:"The prompt to profile"`
+	Model      string   `json:"model,omitempty" description:"Model path or registry name (overrides default)"`
+	Predict    int      `json:"predict,omitempty" description:"Tokens to generate per run"`
+	Parameters []string `json:"parameters,omitempty" description:"Parameters to vary: temperature, top_k, top_p, repeat_penalty (default all)"`
+	MaxRuns    int      `json:"max_runs,omitempty" description:"Maximum generations including the baseline (capped by ProfileMaxRuns)"`
+	RequestID  string   `json:"request_id,omitempty" description:"Id for cancel_completion, which stops the remaining runs (letters, digits, - and _); generated when omitted"`
+}
+
+// ProfileRun is one generation with a single parameter moved away from the baseline
+type ProfileRun struct {
+	Value        float64 `json:"value"`           // Parameter value used
+	OutputLength int     `json:"output_length"`   // Output length in characters
+	Similarity   float64 `json:"similarity"`      // Word overlap with the baseline output (Jaccard, 0-1)
+	Error        string  `json:"error,omitempty"` // Failure description, if the run failed
+}
+
+// ParameterProfile summarizes how varying one parameter changed the output
+type ParameterProfile struct {
+	Name                string       `json:"name"`                   // Parameter name
+	Baseline            float64      `json:"baseline"`               // Baseline value
+	Runs                []ProfileRun `json:"runs"`                   // Runs below and above the baseline
+	MeanSimilarity      float64      `json:"mean_similarity"`        // Average similarity of successful runs to the baseline
+	MeanLengthChangePct float64      `json:"mean_length_change_pct"` // Average absolute output length change, in percent
+}
+
+// ProfileReport is the JSON document returned by the profile_parameters tool
+type ProfileReport struct {
+	BaselineOutputLength int                `json:"baseline_output_length"` // Baseline output length in characters
+	Parameters           []ParameterProfile `json:"parameters"`             // Per-parameter results, in the requested order
+	MostSensitive        string             `json:"most_sensitive"`         // Parameter with the lowest mean similarity
+	Runs                 int                `json:"runs"`                   // Generations performed, including the baseline
+	Skipped              []string           `json:"skipped,omitempty"`      // Parameters not profiled because max_runs was reached
+}
+
+// profiledParameter describes how to read, vary and apply one sampling parameter
+type profiledParameter struct {
+	configured func() string                              // Configured default, as a string
+	fallback   float64                                    // llama.cpp default when not configured
+	variants   func(base float64) []float64               // Values to try around the baseline
+	apply      func(args *CompletionArguments, v float64) // Sets the value on a request
+}
+
+// profiledParameters lists the parameters profile_parameters can vary
+var profiledParameters = map[string]profiledParameter{
+	"temperature": {
+		configured: func() string { return llamaCliArgs.TemperatureVal },
+		fallback:   0.8,
+		variants:   func(base float64) []float64 { return []float64{base * 0.5, base * 1.5} },
+		apply:      func(args *CompletionArguments, v float64) { args.Temperature = v },
+	},
+	"top_k": {
+		configured: func() string { return llamaCliArgs.TopKVal },
+		fallback:   40,
+		variants:   func(base float64) []float64 { return []float64{math.Max(1, math.Round(base/2)), base * 2} },
+		apply:      func(args *CompletionArguments, v float64) { args.TopK = int(v) },
+	},
+	"top_p": {
+		configured: func() string { return llamaCliArgs.TopPVal },
+		fallback:   0.95,
+		variants:   func(base float64) []float64 { return []float64{math.Max(0.05, base-0.2), math.Min(1, base+0.05)} },
+		apply:      func(args *CompletionArguments, v float64) { args.TopP = v },
+	},
+	"repeat_penalty": {
+		configured: func() string { return llamaCliArgs.RepeatPenaltyVal },
+		fallback:   1.0,
+		variants:   func(base float64) []float64 { return []float64{math.Max(0.5, base-0.1), base + 0.2} },
+		apply:      func(args *CompletionArguments, v float64) { args.RepeatPenalty = v },
+	},
+}
+
+// profiledParameterOrder is the default order parameters are profiled in
+var profiledParameterOrder = []string{"temperature", "top_k", "top_p", "repeat_penalty"}
+
+// parameterBaseline returns the configured default for a parameter, or llama.cpp's default.
+//
+// Parameters:
+//   - param: The parameter definition
+//
+// Returns:
+//   - float64: The baseline value
+func parameterBaseline(param profiledParameter) float64 {
+	if value, err := strconv.ParseFloat(param.configured(), 64); err == nil && value > 0 {
+		return value
+	}
+	return param.fallback
+}
+
+// wordSimilarity returns the Jaccard similarity of the word sets of two texts.
+//
+// Parameters:
+//   - a: The first text
+//   - b: The second text
+//
+// Returns:
+//   - float64: 1 for identical word sets, 0 for disjoint ones
+func wordSimilarity(a, b string) float64 {
+	wordsA, wordsB := make(map[string]bool), make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(a)) {
+		wordsA[word] = true
+	}
+	for _, word := range strings.Fields(strings.ToLower(b)) {
+		wordsB[word] = true
+	}
+	if len(wordsA) == 0 && len(wordsB) == 0 {
+		return 1
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wordsA)+len(wordsB)-shared)
+}
+
+// handleProfileParametersTool runs a baseline generation and then varies one sampling
+// parameter at a time below and above its default, reporting how output length and
+// content moved. All runs share one fixed seed so differences come from the parameter.
+// Runs are sequential, each taking a MaxConcurrentRequests slot and going through the
+// per-model concurrency limit like any request, and outputs are compared after the same
+// cleanup as generate_completion responses.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token
+//   - arguments: The prompt, parameters to vary and run budget
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON profile report, or an error message
+//   - error: Any error that occurred while encoding the response
+func handleProfileParametersTool(ctx context.Context, arguments ProfileParametersArguments) (*mcpgolang.ToolResponse, error) {
+	if arguments.Prompt == "" {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: Prompt cannot be empty")), nil
+	}
+	if err := validateRequestID(arguments.RequestID); err != nil {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err))), nil
+	}
+	if requestIDActive(arguments.RequestID) {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: request_id %q is already used by a request in flight", arguments.RequestID))), nil
+	}
+	names := arguments.Parameters
+	if len(names) == 0 {
+		names = profiledParameterOrder
+	}
+	for _, name := range names {
+		if _, ok := profiledParameters[name]; !ok {
+			return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: cannot profile parameter %q", name))), nil
+		}
+	}
+	maxRuns := appArgs.ProfileMaxRuns
+	if arguments.MaxRuns > 0 && arguments.MaxRuns < maxRuns {
+		maxRuns = arguments.MaxRuns
+	}
+
+	requestID := arguments.RequestID
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	// A fixed per-profile seed keeps sampling noise out of the comparison
+	base := CompletionArguments{
+		Prompt:         arguments.Prompt,
+		Model:          arguments.Model,
+		Predict:        arguments.Predict,
+		ConversationID: "profile_parameters:" + requestID,
+		RequestID:      requestID,
+	}
+
+	// Enforce the authenticated token's model allowlist
+	if token, model := authTokenFromContext(ctx), effectiveModel(base); !modelAllowedForToken(token, model) {
+		logRequestf(requestID, "Token %q is not permitted to use model %q", token.Name, model)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: model %q is not permitted for this token", filepath.Base(model)))), nil
+	}
+
+	// Count the profile as in flight so shutdown drains it; refuse it once draining
+	finishCompletion, err := trackCompletion()
+	if err != nil {
+		return completionErrorResponse(err, base), nil
+	}
+	defer finishCompletion()
+
+	requestCtx, release := registerActiveRequest(context.Background(), requestID, arguments.Prompt, requestOwner(ctx))
+	defer release()
+	logger.Printf("Profiling parameters %v for request %s (max %d runs)", names, requestID, maxRuns)
+
+	// Each run waits for a server-wide slot of its own, so a profile does not hold one
+	// between runs
+	run := func(arguments CompletionArguments) (string, error) {
+		releaseRequestSlot, err := acquireRequestSlot(requestCtx, requestTimeoutSeconds(arguments))
+		if err != nil {
+			return "", err
+		}
+		defer releaseRequestSlot()
+		result, err := executeCompletion(requestCtx, arguments)
+		if err != nil {
+			return "", err
+		}
+		return completionText(arguments, result), nil
+	}
+
+	baselineOutput, err := run(base)
+	if err != nil {
+		return completionErrorResponse(err, base), nil
+	}
+
+	report := ProfileReport{BaselineOutputLength: len(baselineOutput), Runs: 1}
+	lowestSimilarity := 2.0
+	for _, name := range names {
+		param := profiledParameters[name]
+		baseValue := parameterBaseline(param)
+		variants := param.variants(baseValue)
+		if report.Runs+len(variants) > maxRuns {
+			report.Skipped = append(report.Skipped, name)
+			continue
+		}
+
+		profile := ParameterProfile{Name: name, Baseline: baseValue}
+		succeeded := 0
+		for _, value := range variants {
+			value = math.Round(value*100) / 100 // llama-cli receives two decimals
+			variant := base
+			param.apply(&variant, value)
+			output, err := run(variant)
+			report.Runs++
+
+			// A canceled profile stops instead of recording every remaining run as failed
+			if requestCtx.Err() != nil {
+				return completionErrorResponse(requestCtx.Err(), base), nil
+			}
+
+			profileRun := ProfileRun{Value: value}
+			if err != nil {
+				profileRun.Error = err.Error()
+			} else {
+				profileRun.OutputLength = len(output)
+				profileRun.Similarity = wordSimilarity(baselineOutput, output)
+				profile.MeanSimilarity += profileRun.Similarity
+				if len(baselineOutput) > 0 {
+					profile.MeanLengthChangePct += math.Abs(float64(len(output)-len(baselineOutput))) / float64(len(baselineOutput)) * 100
+				}
+				succeeded++
+			}
+			profile.Runs = append(profile.Runs, profileRun)
+		}
+		if succeeded > 0 {
+			profile.MeanSimilarity /= float64(succeeded)
+			profile.MeanLengthChangePct /= float64(succeeded)
+			if profile.MeanSimilarity < lowestSimilarity {
+				lowestSimilarity, report.MostSensitive = profile.MeanSimilarity, name
+			}
+		}
+		report.Parameters = append(report.Parameters, profile)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profile report: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SamplingProfile is a named bundle of model and sampling parameters loaded from
+// ProfilesPath. Keys match the generate_completion arguments they stand in for, and
+// zero or missing values leave the server default in place.
+type SamplingProfile struct {
+	Model         string   `json:"model,omitempty"`          // Model path or registry name
+	Predict       int      `json:"predict,omitempty"`        // Number of tokens to generate
+	Temperature   float64  `json:"temperature,omitempty"`    // Creativity/randomness control
+	TopK          int      `json:"top_k,omitempty"`          // Top-K sampling
+	TopP          float64  `json:"top_p,omitempty"`          // Top-P (nucleus) sampling
+	MinP          float64  `json:"min_p,omitempty"`          // Min-P sampling
+	TypicalP      float64  `json:"typical_p,omitempty"`      // Locally typical sampling
+	Tfs           float64  `json:"tfs,omitempty"`            // Tail free sampling
+	RepeatPenalty float64  `json:"repeat_penalty,omitempty"` // Repetition penalty
+	RepeatLastN   int      `json:"repeat_last_n,omitempty"`  // Tokens checked for repetition
+	Mirostat      int      `json:"mirostat,omitempty"`       // Mirostat mode
+	MirostatTau   float64  `json:"mirostat_tau,omitempty"`   // Mirostat target entropy
+	MirostatEta   float64  `json:"mirostat_eta,omitempty"`   // Mirostat learning rate
+	DynatempRange float64  `json:"dynatemp_range,omitempty"` // Dynamic temperature range
+	DynatempExp   float64  `json:"dynatemp_exp,omitempty"`   // Dynamic temperature exponent
+	Samplers      []string `json:"samplers,omitempty"`       // Sampler chain, in order
+	Stop          []string `json:"stop,omitempty"`           // Stop sequences
+	Seed          *int     `json:"seed,omitempty"`           // Random seed
+}
+
+// SamplingProfiles is the document in ProfilesPath
+type SamplingProfiles struct {
+	Profiles map[string]SamplingProfile `json:"profiles"` // Profile name -> parameters
+}
+
+var (
+	samplingProfilesValue map[string]SamplingProfile // Loaded profiles by name, empty when not configured
+	samplingProfilesOnce  sync.Once                  // Guards the one-time load of ProfilesPath
+)
+
+// loadSamplingProfiles reads ProfilesPath once and caches the profiles. A missing or
+// malformed file, including one with a key profiles do not support, leaves no profiles
+// with a logged warning.
+//
+// Returns:
+//   - map[string]SamplingProfile: Profile name -> parameters
+func loadSamplingProfiles() map[string]SamplingProfile {
+	samplingProfilesOnce.Do(func() {
+		if appArgs.ProfilesPath == "" {
+			return
+		}
+
+		data, err := os.ReadFile(appArgs.ProfilesPath)
+		if err != nil {
+			logger.Printf("Warning: profiles disabled, cannot read %s: %v", appArgs.ProfilesPath, err)
+			return
+		}
+
+		var profiles SamplingProfiles
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&profiles); err != nil {
+			logger.Printf("Warning: profiles disabled, cannot parse %s: %v", appArgs.ProfilesPath, err)
+			return
+		}
+
+		samplingProfilesValue = profiles.Profiles
+		logger.Printf("Loaded %d profile(s) from %s", len(profiles.Profiles), appArgs.ProfilesPath)
+	})
+	return samplingProfilesValue
+}
+
+// applySamplingProfile fills the parameters a request leaves unset from its named
+// profile, so an explicit argument beats the profile and the profile beats the server
+// defaults applied later. Requests without a profile are returned unchanged.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - CompletionArguments: The request with the profile applied and no profile name
+//   - error: An error for an unknown profile
+func applySamplingProfile(arguments CompletionArguments) (CompletionArguments, error) {
+	if arguments.Profile == "" {
+		return arguments, nil
+	}
+
+	profiles := loadSamplingProfiles()
+	profile, ok := profiles[arguments.Profile]
+	if !ok {
+		if len(profiles) == 0 {
+			return arguments, fmt.Errorf("unknown profile %q: no profiles are configured", arguments.Profile)
+		}
+		return arguments, fmt.Errorf("unknown profile %q, must be one of %s", arguments.Profile, strings.Join(slices.Sorted(maps.Keys(profiles)), ", "))
+	}
+
+	if arguments.Model == "" {
+		arguments.Model = profile.Model
+	}
+	if arguments.Predict == 0 {
+		arguments.Predict = profile.Predict
+	}
+	if arguments.Temperature == 0 {
+		arguments.Temperature = profile.Temperature
+	}
+	if arguments.TopK == 0 {
+		arguments.TopK = profile.TopK
+	}
+	if arguments.TopP == 0 {
+		arguments.TopP = profile.TopP
+	}
+	if arguments.MinP == 0 {
+		arguments.MinP = profile.MinP
+	}
+	if arguments.TypicalP == 0 {
+		arguments.TypicalP = profile.TypicalP
+	}
+	if arguments.Tfs == 0 {
+		arguments.Tfs = profile.Tfs
+	}
+	if arguments.RepeatPenalty == 0 {
+		arguments.RepeatPenalty = profile.RepeatPenalty
+	}
+	if arguments.RepeatLastN == 0 {
+		arguments.RepeatLastN = profile.RepeatLastN
+	}
+	if arguments.Mirostat == 0 {
+		arguments.Mirostat = profile.Mirostat
+	}
+	if arguments.MirostatTau == 0 {
+		arguments.MirostatTau = profile.MirostatTau
+	}
+	if arguments.MirostatEta == 0 {
+		arguments.MirostatEta = profile.MirostatEta
+	}
+	if arguments.DynatempRange == 0 {
+		arguments.DynatempRange = profile.DynatempRange
+	}
+	if arguments.DynatempExp == 0 {
+		arguments.DynatempExp = profile.DynatempExp
+	}
+	if len(arguments.Samplers) == 0 {
+		arguments.Samplers = slices.Clone(profile.Samplers)
+	}
+	if len(arguments.Stop) == 0 {
+		arguments.Stop = slices.Clone(profile.Stop)
+	}
+	if arguments.Seed == nil && profile.Seed != nil {
+		seed := *profile.Seed
+		arguments.Seed = &seed
+	}
+	arguments.Profile = ""
+	return arguments, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prometheusMetrics renders the server-wide completion metrics in the Prometheus
+// text exposition format.
+//
+// Parameters:
+//   - m: Snapshot of the counters
+//
+// Returns:
+//   - string: The exposition text
+func prometheusMetrics(m CompletionMetrics) string {
+	var b strings.Builder
+	counter := func(name, help string, value int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+
+	counter("byte_vision_requests_total", "Completion requests received.", m.RequestCount)
+	counter("byte_vision_success_total", "Completion requests that succeeded.", m.SuccessCount)
+	counter("byte_vision_error_total", "Completion requests that failed.", m.ErrorCount)
+	counter("byte_vision_timeout_total", "Completion requests that timed out.", m.TimeoutCount)
+	counter("byte_vision_canceled_total", "Completion requests canceled before finishing.", m.CanceledCount)
+	counter("byte_vision_invalid_total", "Completion requests rejected for invalid arguments.", m.InvalidCount)
+	counter("byte_vision_generated_tokens_total", "Tokens generated by successful requests (partly estimated).", m.TotalTokens)
+	counter("byte_vision_cache_hits_total", "Requests answered from the response cache.", m.CacheHits)
+	counter("byte_vision_cache_misses_total", "Cacheable requests that had to be generated.", m.CacheMisses)
+	counter("byte_vision_cache_evictions_total", "Response cache entries evicted by size or age.", m.CacheEvictions)
+	counter("byte_vision_queued_total", "Completion requests that waited for a MaxConcurrentRequests slot.", m.QueuedCount)
+	counter("byte_vision_rejected_total", "Completion requests rejected because the server stayed busy.", m.RejectedCount)
+	counter("byte_vision_retries_total", "llama-cli relaunches after a transient failure.", m.RetryCount)
+	counter("byte_vision_coalesced_total", "Completion requests that shared an identical in-flight request's execution.", m.CoalescedCount)
+	counter("byte_vision_throttled_total", "Tool calls rejected by the per-client rate limit.", m.ThrottledCount)
+
+	fmt.Fprintf(&b, "# HELP byte_vision_active_processes Running llama.cpp processes.\n# TYPE byte_vision_active_processes gauge\nbyte_vision_active_processes %d\n", activeProcesses.Load())
+	fmt.Fprintf(&b, "# HELP byte_vision_queue_depth Completion requests waiting for a MaxConcurrentRequests slot.\n# TYPE byte_vision_queue_depth gauge\nbyte_vision_queue_depth %d\n", requestQueueDepth())
+
+	// Buckets are stored per interval; Prometheus expects cumulative counts
+	name := "byte_vision_request_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Wall-clock time of finished completion requests.\n# TYPE %s histogram\n", name, name)
+	var cumulative int64
+	for i, bound := range metricsDurationBuckets {
+		cumulative += m.DurationBuckets[i]
+		fmt.Fprintf(&b, "%s_bucket{le=\"%g\"} %d\n", name, bound, cumulative)
+	}
+	finished := m.FinishedCount()
+	fmt.Fprintf(&b, "%s_bucket{le=\"+Inf\"} %d\n", name, finished)
+	fmt.Fprintf(&b, "%s_sum %g\n", name, m.TotalDuration.Seconds())
+	fmt.Fprintf(&b, "%s_count %d\n", name, finished)
+	return b.String()
+}
+
+// handlePrometheusMetrics serves the Prometheus metrics endpoint.
+//
+// Parameters:
+//   - c: The request context
+func handlePrometheusMetrics(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(prometheusMetrics(metricsSnapshot())))
+}
+
+// prometheusPath returns the path of the Prometheus endpoint: MetricsEndpoint, or
+// /metrics when only MetricsPort is set.
+//
+// Returns:
+//   - string: The endpoint path, or "" when the endpoint is disabled
+func prometheusPath() string {
+	if appArgs.MetricsEndpoint == "" && appArgs.MetricsPort != "" {
+		return "/metrics"
+	}
+	return appArgs.MetricsEndpoint
+}
+
+// newMetricsServer builds a separate HTTP server for the Prometheus endpoint when
+// MetricsPort is set. Without MetricsPort the endpoint is mounted on HttpPort instead.
+//
+// Returns:
+//   - *http.Server: The configured, not yet started server, or nil when not needed
+func newMetricsServer() *http.Server {
+	if appArgs.MetricsPort == "" || appArgs.MetricsPort == appArgs.HttpPort {
+		return nil
+	}
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.GET(prometheusPath(), handlePrometheusMetrics)
+	return &http.Server{
+		Addr:    appArgs.MetricsPort,
+		Handler: router,
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+)
+
+// withLongPromptFile moves a prompt longer than PromptFileThresholdBytes out of the
+// command line into a temporary file passed with PromptFileCmd, since exec fails with
+// "argument list too long" once a single argument passes the OS limit (128KB on Linux).
+// The arguments are left unchanged when the prompt is short or PromptFileCmd is unset.
+//
+// Parameters:
+//   - args: The llama-cli argument list
+//
+// Returns:
+//   - []string: The argument list, reading the prompt from the file when it was moved
+//   - func(): Removes the temporary file; a no-op when none was written
+//   - error: Any error writing the file
+func withLongPromptFile(args []string) ([]string, func(), error) {
+	threshold := appArgs.PromptFileThresholdBytes
+	if threshold <= 0 || llamaCliArgs.PromptFileCmd == "" || llamaCliArgs.PromptCmd == "" {
+		return args, func() {}, nil
+	}
+	i := -1
+	for j := 0; j+1 < len(args); j++ {
+		if args[j] == llamaCliArgs.PromptCmd && len(args[j+1]) > threshold {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		return args, func() {}, nil
+	}
+
+	file, err := os.CreateTemp("", "byte-vision-prompt-*.txt")
+	if err != nil {
+		return args, nil, fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	// llama-cli drops one trailing newline from a prompt file; add one so the prompt
+	// reaches the model exactly as it was sent
+	_, err = file.WriteString(args[i+1] + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return args, nil, fmt.Errorf("failed to write prompt file: %w", err)
+	}
+
+	moved := slices.Clone(args)
+	moved[i], moved[i+1] = llamaCliArgs.PromptFileCmd, file.Name()
+	return moved, func() { os.Remove(file.Name()) }, nil
+}
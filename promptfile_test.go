@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithLongPromptFile(t *testing.T) {
+	setLlamaCliArgs(t, LlamaCliArgs{PromptCmd: "--prompt", PromptFileCmd: "--file"})
+	savedAppArgs := appArgs
+	appArgs.PromptFileThresholdBytes = 100 * 1024
+	t.Cleanup(func() { appArgs = savedAppArgs })
+
+	// About 500KB, well past the 128KB Linux limit on a single argument
+	prompt := strings.Repeat("Summarize the following log line. ", 15000)
+	args, _, err := prepareLlamaArgs(CompletionArguments{Prompt: prompt})
+	if err != nil {
+		t.Fatalf("prepareLlamaArgs() error = %v", err)
+	}
+
+	moved, cleanup, err := withLongPromptFile(args)
+	if err != nil {
+		t.Fatalf("withLongPromptFile() error = %v", err)
+	}
+	defer cleanup()
+
+	if slices.Contains(moved, "--prompt") {
+		t.Errorf("--prompt still passed on the command line")
+	}
+	for _, arg := range moved {
+		if len(arg) > appArgs.PromptFileThresholdBytes {
+			t.Fatalf("argument of %d bytes left on the command line", len(arg))
+		}
+	}
+	path, ok := flagValue(moved, "--file")
+	if !ok {
+		t.Fatalf("--file missing from args %q", moved)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read prompt file: %v", err)
+	}
+	// llama-cli drops the trailing newline added to the file
+	if string(data) != prompt+"\n" {
+		t.Errorf("prompt file holds %d bytes, want the %d-byte prompt plus a newline", len(data), len(prompt))
+	}
+
+	// Linux refuses to exec the original command line but runs the moved one
+	if truePath, err := exec.LookPath("true"); err == nil && runtime.GOOS == "linux" {
+		if err := exec.Command(truePath, args...).Run(); err == nil {
+			t.Errorf("expected exec with the %d-byte prompt argument to fail", len(prompt))
+		}
+		if err := exec.Command(truePath, moved...).Run(); err != nil {
+			t.Errorf("exec with the prompt file failed: %v", err)
+		}
+	}
+
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("prompt file %s not removed: %v", path, err)
+	}
+}
+
+func TestWithLongPromptFileShortPrompt(t *testing.T) {
+	setLlamaCliArgs(t, LlamaCliArgs{PromptCmd: "--prompt", PromptFileCmd: "--file"})
+	savedAppArgs := appArgs
+	appArgs.PromptFileThresholdBytes = 100 * 1024
+	t.Cleanup(func() { appArgs = savedAppArgs })
+
+	args := []string{"--prompt", "Hello"}
+	moved, cleanup, err := withLongPromptFile(args)
+	if err != nil {
+		t.Fatalf("withLongPromptFile() error = %v", err)
+	}
+	defer cleanup()
+	if !slices.Equal(moved, args) {
+		t.Errorf("withLongPromptFile() = %q, want %q unchanged", moved, args)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitSweepInterval is how often idle client buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// rateLimitBucket is one client's token bucket. It holds up to RateLimitPerMinute
+// tokens and refills continuously at RateLimitPerMinute per minute.
+type rateLimitBucket struct {
+	tokens float64   // Tokens left, fractional while refilling
+	last   time.Time // When tokens was last brought up to date
+}
+
+// Token buckets by client key (auth token name or client IP)
+var (
+	rateLimitBuckets   = make(map[string]*rateLimitBucket)
+	rateLimitBucketsMu sync.Mutex // Guards rateLimitBuckets
+)
+
+// rateLimitKey identifies the client of a request: its auth token when auth is
+// enabled, so clients behind one proxy are told apart, otherwise its IP address.
+//
+// Parameters:
+//   - c: The request context, after authMiddleware
+//
+// Returns:
+//   - string: The client key
+func rateLimitKey(c *gin.Context) string {
+	if value, ok := c.Get(authTokenKey); ok {
+		if token, _ := value.(*AuthToken); token != nil {
+			return "token:" + token.Name
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// takeRateLimitToken takes one token from a client's bucket, creating a full bucket for
+// a client not seen recently.
+//
+// Parameters:
+//   - key: The client key from rateLimitKey
+//   - now: The current time
+//
+// Returns:
+//   - bool: Whether the request may proceed
+//   - time.Duration: With a false result, how long until a token is available
+func takeRateLimitToken(key string, now time.Time) (bool, time.Duration) {
+	capacity := float64(appArgs.RateLimitPerMinute)
+	perSecond := capacity / 60
+
+	rateLimitBucketsMu.Lock()
+	defer rateLimitBucketsMu.Unlock()
+
+	bucket, ok := rateLimitBuckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: capacity, last: now}
+		rateLimitBuckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*perSecond)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// isToolCall reports whether an MCP request body calls a tool. Protocol traffic such as
+// initialize and tools/list never launches llama-cli and is not rate limited.
+//
+// Parameters:
+//   - body: The JSON-RPC request body
+//
+// Returns:
+//   - bool: True for tools/call requests, including ones inside a batch
+func isToolCall(body []byte) bool {
+	var envelope struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &envelope) == nil {
+		return envelope.Method == "tools/call"
+	}
+	var batch []struct {
+		Method string `json:"method"`
+	}
+	if json.Unmarshal(body, &batch) == nil {
+		for _, request := range batch {
+			if request.Method == "tools/call" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rateLimitMiddleware throttles tool calls per client with a token bucket when
+// RateLimitPerMinute is set. Throttled requests get HTTP 429 with a Retry-After header
+// before the transport sees them, so no llama-cli process is started.
+//
+// Returns:
+//   - gin.HandlerFunc: The middleware
+func rateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if appArgs.RateLimitPerMinute <= 0 {
+			c.Next()
+			return
+		}
+
+		// Peek at the JSON-RPC method, then restore the body for the transport
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if !isToolCall(body) {
+			c.Next()
+			return
+		}
+
+		key := rateLimitKey(c)
+		allowed, retryAfter := takeRateLimitToken(key, time.Now())
+		if allowed {
+			c.Next()
+			return
+		}
+
+		metricsRequestThrottled()
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		logger.Printf("Throttled request from %s: over %d tool calls per minute", key, appArgs.RateLimitPerMinute)
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": fmt.Sprintf("rate limit exceeded: at most %d tool calls per minute, retry in %d seconds", appArgs.RateLimitPerMinute, seconds),
+		})
+	}
+}
+
+// sweepRateLimitBuckets drops buckets that have been idle long enough to refill
+// completely; such a client gets a fresh full bucket on its next request anyway.
+//
+// Parameters:
+//   - now: The current time
+func sweepRateLimitBuckets(now time.Time) {
+	rateLimitBucketsMu.Lock()
+	defer rateLimitBucketsMu.Unlock()
+
+	for key, bucket := range rateLimitBuckets {
+		if now.Sub(bucket.last) >= time.Minute {
+			delete(rateLimitBuckets, key)
+		}
+	}
+}
+
+// startRateLimitSweeper drops idle client buckets every rateLimitSweepInterval until
+// the context is canceled, so clients that stop calling don't hold memory.
+//
+// Parameters:
+//   - ctx: Context whose cancellation stops the sweeper
+func startRateLimitSweeper(ctx context.Context) {
+	if appArgs.RateLimitPerMinute <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(rateLimitSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				sweepRateLimitBuckets(now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Readiness states reported by the readiness endpoint
+const (
+	ReadinessReady    = "ready"
+	ReadinessNotReady = "not_ready"
+)
+
+// ReadinessCheck is the outcome of one readiness check
+type ReadinessCheck struct {
+	Name  string `json:"name"`            // What was checked
+	OK    bool   `json:"ok"`              // Whether the check passed
+	Error string `json:"error,omitempty"` // Why the check failed
+}
+
+// ReadinessStatus is the JSON document returned by the readiness endpoint
+type ReadinessStatus struct {
+	Status     string           `json:"status"`      // ready or not_ready
+	Checks     []ReadinessCheck `json:"checks"`      // Every check, in the order run
+	QueueDepth int              `json:"queue_depth"` // Requests waiting for a MaxConcurrentRequests slot
+}
+
+// Result of the most recent deep health check, refreshed in the background
+var (
+	deepHealthErr     error     // Failure of the last one-token completion, nil when it succeeded
+	deepHealthChecked time.Time // When the last check finished; zero before the first one
+	deepHealthMu      sync.Mutex
+)
+
+// checkExecutable verifies a path is a regular file the server can execute.
+//
+// Parameters:
+//   - path: The executable path
+//
+// Returns:
+//   - error: Why the file can't be executed, or nil
+func checkExecutable(path string) error {
+	if path == "" {
+		return errors.New("not configured")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	// Windows has no execute permission bit
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
+
+// checkReadable verifies a path is a regular file the server can open for reading.
+//
+// Parameters:
+//   - path: The file path
+//
+// Returns:
+//   - error: Why the file can't be read, or nil
+func checkReadable(path string) error {
+	if path == "" {
+		return errors.New("not configured")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	return nil
+}
+
+// runDeepHealthCheck generates a single token with the default model to confirm it
+// actually loads, and records the result.
+func runDeepHealthCheck() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(completionTimeoutSeconds(PriorityNormal))*time.Second)
+	defer cancel()
+
+	err := func() error {
+		args, _, err := prepareLlamaArgs(CompletionArguments{Prompt: "Hello", Predict: 1})
+		if err != nil {
+			return err
+		}
+		releaseSlot, err := acquireModelSlot(ctx, llamaCliArgs.ModelFullPathVal, completionTimeoutSeconds(PriorityNormal))
+		if err != nil {
+			return err
+		}
+		defer releaseSlot()
+		_, _, err = runLlamaCommand(ctx, appArgs, args, nil)
+		return err
+	}()
+	if err != nil {
+		logger.Printf("Deep health check failed: %v", err)
+	}
+
+	deepHealthMu.Lock()
+	defer deepHealthMu.Unlock()
+	deepHealthErr, deepHealthChecked = err, time.Now()
+}
+
+// startDeepHealthCheck runs the deep health check at startup and then every
+// DeepHealthCheckIntervalSeconds until the context is canceled, so readiness probes
+// read the latest result instead of each starting a completion.
+//
+// Parameters:
+//   - ctx: Context whose cancellation stops the checks
+func startDeepHealthCheck(ctx context.Context) {
+	if !appArgs.DeepHealthCheck {
+		return
+	}
+
+	go func() {
+		runDeepHealthCheck()
+		if appArgs.DeepHealthCheckIntervalSeconds <= 0 {
+			return
+		}
+		ticker := time.NewTicker(time.Duration(appArgs.DeepHealthCheckIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runDeepHealthCheck()
+			}
+		}
+	}()
+}
+
+// currentReadiness checks that the server is not draining for shutdown, that llama-cli
+// and the default model file are usable and, with DeepHealthCheck, that the last
+// one-token completion succeeded.
+//
+// Returns:
+//   - ReadinessStatus: The readiness document
+//   - int: The HTTP status code (503 when any check fails, otherwise 200)
+func currentReadiness() (ReadinessStatus, int) {
+	status := ReadinessStatus{Status: ReadinessReady, QueueDepth: requestQueueDepth()}
+	add := func(name string, err error) {
+		check := ReadinessCheck{Name: name, OK: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			status.Status = ReadinessNotReady
+		}
+		status.Checks = append(status.Checks, check)
+	}
+
+	var accepting error
+	if draining.Load() {
+		accepting = ErrShuttingDown
+	}
+	add("accepting_requests", accepting)
+	add("llama_cli_executable", checkExecutable(appArgs.LLamaCliPath))
+	add("model_readable", checkReadable(llamaCliArgs.ModelFullPathVal))
+	if appArgs.DeepHealthCheck {
+		deepHealthMu.Lock()
+		err, checked := deepHealthErr, deepHealthChecked
+		deepHealthMu.Unlock()
+		if checked.IsZero() {
+			err = errors.New("first check still running")
+		}
+		add("model_loads", err)
+	}
+
+	if status.Status != ReadinessReady {
+		return status, http.StatusServiceUnavailable
+	}
+	return status, http.StatusOK
+}
+
+// handleReadiness serves the readiness endpoint.
+//
+// Parameters:
+//   - c: The request context
+func handleReadiness(c *gin.Context) {
+	status, code := currentReadiness()
+	if code != http.StatusOK {
+		for _, check := range status.Checks {
+			if !check.OK {
+				logger.Printf("Readiness check %s failed: %s", check.Name, check.Error)
+			}
+		}
+	}
+	c.JSON(code, status)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redactionPresets are the built-in patterns selectable with RedactionPresets
+var redactionPresets = map[string]string{
+	"email":       `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"ssn":         `\b\d{3}-\d{2}-\d{4}\b`,
+	"credit_card": `\b(?:\d[ -]?){12,18}\d\b`,
+	"api_key":     `\b(?:sk|pk|rk|api|key|token)[-_][A-Za-z0-9_-]{16,}\b`,
+}
+
+var (
+	redactionPatterns []*regexp.Regexp // Compiled presets and file patterns
+	redactionBroken   bool             // Configuration failed to load; redact everything
+	redactionOnce     sync.Once        // Guards the one-time load
+)
+
+// loadRedactionPatterns compiles RedactionPresets and the patterns in
+// RedactionPatternsFile (one regular expression per line, # for comments) once.
+// An unknown preset, unreadable file or invalid pattern is logged and makes
+// redaction fail closed: every logged prompt is replaced entirely.
+//
+// Returns:
+//   - []*regexp.Regexp: The compiled patterns
+//   - bool: Whether the configuration is broken
+func loadRedactionPatterns() ([]*regexp.Regexp, bool) {
+	redactionOnce.Do(func() {
+		sources := make([]string, 0, len(appArgs.RedactionPresets))
+		for _, preset := range appArgs.RedactionPresets {
+			pattern, ok := redactionPresets[preset]
+			if !ok {
+				logger.Printf("Error: unknown redaction preset %q, redacting prompts entirely", preset)
+				redactionBroken = true
+				return
+			}
+			sources = append(sources, pattern)
+		}
+
+		if appArgs.RedactionPatternsFile != "" {
+			file, err := os.Open(appArgs.RedactionPatternsFile)
+			if err != nil {
+				logger.Printf("Error: cannot read %s, redacting prompts entirely: %v", appArgs.RedactionPatternsFile, err)
+				redactionBroken = true
+				return
+			}
+			defer file.Close()
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+					sources = append(sources, line)
+				}
+			}
+		}
+
+		for _, source := range sources {
+			pattern, err := regexp.Compile(source)
+			if err != nil {
+				logger.Printf("Error: invalid redaction pattern %q, redacting prompts entirely: %v", source, err)
+				redactionBroken = true
+				return
+			}
+			redactionPatterns = append(redactionPatterns, pattern)
+		}
+		if len(redactionPatterns) > 0 {
+			logger.Printf("Loaded %d prompt redaction patterns", len(redactionPatterns))
+		}
+	})
+	return redactionPatterns, redactionBroken
+}
+
+// redactText replaces every redaction pattern match in text with RedactionPlaceholder.
+//
+// Parameters:
+//   - text: Prompt text (or text that may contain it) about to be logged or stored
+//
+// Returns:
+//   - string: The redacted text
+func redactText(text string) string {
+	patterns, broken := loadRedactionPatterns()
+	if broken && text != "" {
+		return appArgs.RedactionPlaceholder
+	}
+	for _, pattern := range patterns {
+		text = pattern.ReplaceAllLiteralString(text, appArgs.RedactionPlaceholder)
+	}
+	return text
+}
+
+// redactArgv returns a copy of a command line with every argument redacted.
+//
+// Parameters:
+//   - argv: The command line, which contains the prompt
+//
+// Returns:
+//   - []string: The redacted copy
+func redactArgv(argv []string) []string {
+	if argv == nil {
+		return nil
+	}
+	redacted := make([]string, len(argv))
+	for i, arg := range argv {
+		redacted[i] = redactText(arg)
+	}
+	return redacted
+}
+
+// redactArguments returns a copy of a request with its prompt-bearing fields redacted.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - CompletionArguments: The redacted copy
+func redactArguments(arguments CompletionArguments) CompletionArguments {
+	arguments.Prompt = redactText(arguments.Prompt)
+	arguments.AssistantPrefix = redactText(arguments.AssistantPrefix)
+	arguments.SplitInstruction = redactText(arguments.SplitInstruction)
+	return arguments
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ModelRegistry maps client-facing model names to model files, plus aliases for
+// renamed or retired names. It is loaded from the JSON file named by ModelRegistryFile.
+type ModelRegistry struct {
+	Models  map[string]ModelEntry `json:"models"`  // Model name -> model definition
+	Aliases map[string]ModelAlias `json:"aliases"` // Deprecated name -> replacement
+}
+
+// ModelEntry describes a model available by name
+type ModelEntry struct {
+	Path        string `json:"path"`                  // Model file path; relative paths resolve against ModelPath
+	Parallelism int    `json:"parallelism,omitempty"` // Concurrent requests allowed on this model; 0 uses DefaultModelParallelism
+	MaxContext  int    `json:"max_ctx,omitempty"`     // Largest context the model was trained for; 0 means no cap
+}
+
+// ModelAlias redirects a deprecated model name to its replacement
+type ModelAlias struct {
+	Target  string `json:"target"`            // Registry model name or model path the alias resolves to
+	Message string `json:"message,omitempty"` // Optional migration note appended to the deprecation warning
+}
+
+var (
+	modelRegistryValue ModelRegistry // Loaded registry, empty when not configured
+	modelRegistryOnce  sync.Once     // Guards the one-time load of ModelRegistryFile
+)
+
+// loadModelRegistry reads ModelRegistryFile once and caches the parsed registry.
+// A missing or malformed file leaves the registry empty with a logged warning, so
+// model names fall back to being treated as paths.
+//
+// Returns:
+//   - ModelRegistry: The loaded registry
+func loadModelRegistry() ModelRegistry {
+	modelRegistryOnce.Do(func() {
+		if appArgs.ModelRegistryFile == "" {
+			return
+		}
+
+		data, err := os.ReadFile(appArgs.ModelRegistryFile)
+		if err != nil {
+			logger.Printf("Warning: model registry disabled, cannot read %s: %v", appArgs.ModelRegistryFile, err)
+			return
+		}
+
+		var registry ModelRegistry
+		if err := json.Unmarshal(data, &registry); err != nil {
+			logger.Printf("Warning: model registry disabled, cannot parse %s: %v", appArgs.ModelRegistryFile, err)
+			return
+		}
+
+		modelRegistryValue = registry
+		logger.Printf("Loaded model registry (%d models, %d aliases)", len(registry.Models), len(registry.Aliases))
+	})
+	return modelRegistryValue
+}
+
+// resolveModel maps a requested model name to the model file to run. Aliases are
+// followed to their target first and produce a deprecation warning; registry names
+// map to their configured path; anything else is used as a path, relative to ModelPath
+// when it is not absolute. It does not confine paths; see resolveModelPath.
+//
+// Parameters:
+//   - name: The requested model name or path
+//
+// Returns:
+//   - string: The model file path
+//   - string: A deprecation warning when an alias was used, otherwise ""
+func resolveModel(name string) (string, string) {
+	registry := loadModelRegistry()
+
+	var warning string
+	if alias, ok := registry.Aliases[name]; ok && alias.Target != "" {
+		warning = fmt.Sprintf("model %q is deprecated, use %q instead", name, alias.Target)
+		if alias.Message != "" {
+			warning += ": " + alias.Message
+		}
+		name = alias.Target
+	}
+
+	if entry, ok := registry.Models[name]; ok && entry.Path != "" {
+		if filepath.IsAbs(entry.Path) || appArgs.ModelPath == "" {
+			return entry.Path, warning
+		}
+		return filepath.Join(appArgs.ModelPath, entry.Path), warning
+	}
+	if filepath.IsAbs(name) || appArgs.ModelPath == "" {
+		return name, warning
+	}
+	return filepath.Join(appArgs.ModelPath, name), warning
+}
+
+// resolveModelPath resolves a requested model like resolveModel and rejects paths a
+// client could use to reach files outside ModelPath. Registry names and aliases are
+// configured by the operator and may point anywhere; any other value must be a file
+// name or relative path inside ModelPath, or an absolute path inside it.
+//
+// Parameters:
+//   - name: The requested model name or path
+//
+// Returns:
+//   - string: The model file path
+//   - error: An error if the path escapes ModelPath or ModelPath is not configured
+func resolveModelPath(name string) (string, error) {
+	path, _ := resolveModel(name)
+
+	registry := loadModelRegistry()
+	if alias, ok := registry.Aliases[name]; ok && alias.Target != "" {
+		return path, nil
+	}
+	if entry, ok := registry.Models[name]; ok && entry.Path != "" {
+		return path, nil
+	}
+
+	if appArgs.ModelPath == "" {
+		return "", fmt.Errorf("model %q is not a registered model name and ModelPath is not configured", name)
+	}
+	root, err := filepath.Abs(appArgs.ModelPath)
+	if err != nil {
+		return "", fmt.Errorf("invalid ModelPath: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid model %q: %w", name, err)
+	}
+	if rel, err := filepath.Rel(root, abs); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("model %q is outside ModelPath", name)
+	}
+	return path, nil
+}
+
+// registryEntriesFor returns every registry entry whose resolved path is the given
+// model file, so settings apply however the model was requested.
+//
+// Parameters:
+//   - model: The resolved model path
+//
+// Returns:
+//   - []ModelEntry: The matching entries, empty when the model is not registered
+func registryEntriesFor(model string) []ModelEntry {
+	var entries []ModelEntry
+	for name, entry := range loadModelRegistry().Models {
+		if path, _ := resolveModel(name); filepath.Clean(path) == filepath.Clean(model) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// modelMaxContext returns the configured maximum context for a model file.
+//
+// Parameters:
+//   - model: The resolved model path
+//
+// Returns:
+//   - int: The maximum context, or 0 when uncapped
+func modelMaxContext(model string) int {
+	for _, entry := range registryEntriesFor(model) {
+		if entry.MaxContext > 0 {
+			return entry.MaxContext
+		}
+	}
+	return 0
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// requestHash computes a stable cache key for a completion request: the hex SHA-256
+// of the JSON encoding of its normalized arguments. Normalization resolves the model
+// to the file that will run (registry names, aliases and the default model all map to
+// the same key) and clears fields that do not change the result: callback_url, async,
+// priority, timeout_seconds, log_file, stream, echo_request, echo_prompt,
+// include_metadata and include_request_hash itself.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - string: A 64-character hexadecimal hash
+func requestHash(arguments CompletionArguments) string {
+	normalized := arguments
+	normalized.Model = effectiveModel(arguments)
+	normalized.CallbackURL = ""
+	normalized.Async = false
+	normalized.Priority = ""
+	normalized.TimeoutSeconds = 0
+	normalized.LogFile = ""
+	normalized.Stream = false
+	normalized.IncludeRequestHash = false
+	normalized.EchoRequest = false
+	normalized.EchoPrompt = false
+	normalized.IncludeMetadata = false
+	normalized.IdempotencyKey = ""
+	normalized.RequestID = ""
+
+	// Struct fields encode in declaration order, so the encoding is deterministic
+	data, _ := json.Marshal(normalized)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// resolvedRequestHash returns the requestHash of a request after its prompt transforms,
+// so it keys the prompt llama-cli runs with: requests that render the same template with
+// different template_vars, or use {{date}} on different days, get different keys.
+//
+// Parameters:
+//   - arguments: The completion request as received
+//
+// Returns:
+//   - string: A 64-character hexadecimal hash
+//   - CompletionArguments: The transformed request the hash was computed from
+//   - error: The transform error for a prompt that cannot be resolved
+func resolvedRequestHash(arguments CompletionArguments) (string, CompletionArguments, error) {
+	transformed, err := applyPromptTransforms(arguments)
+	if err != nil {
+		return "", arguments, err
+	}
+	return requestHash(transformed), transformed, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// procClockTicks is the Linux USER_HZ used for CPU times in /proc/<pid>/stat
+const procClockTicks = 100
+
+// ResourceStatus is the JSON document returned by the resource_status tool. Fields
+// that cannot be read on the current platform are omitted and listed in Unavailable.
+type ResourceStatus struct {
+	Platform        string   `json:"platform"`                    // GOOS/GOARCH of the server
+	CPUSeconds      *float64 `json:"cpu_seconds,omitempty"`       // User+system CPU time of the server process
+	ChildCPUSeconds *float64 `json:"child_cpu_seconds,omitempty"` // CPU time of finished llama.cpp child processes
+	RSSBytes        *int64   `json:"rss_bytes,omitempty"`         // Resident set size of the server process
+	OpenFDs         *int     `json:"open_fds,omitempty"`          // Open file descriptors of the server process
+	ActiveProcesses int64    `json:"active_processes"`            // Running llama-cli/llama-tokenize child processes
+	Goroutines      int      `json:"goroutines"`                  // Running goroutines
+	HeapBytes       uint64   `json:"heap_bytes"`                  // Go heap in use
+	Unavailable     []string `json:"unavailable,omitempty"`       // Fields that could not be read here
+}
+
+// currentResourceStatus gathers a best-effort resource snapshot. Process figures come
+// from /proc on Linux; runtime figures are available everywhere.
+//
+// Returns:
+//   - ResourceStatus: The snapshot
+func currentResourceStatus() ResourceStatus {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	status := ResourceStatus{
+		Platform:        runtime.GOOS + "/" + runtime.GOARCH,
+		ActiveProcesses: activeProcesses.Load(),
+		Goroutines:      runtime.NumGoroutine(),
+		HeapBytes:       mem.HeapInuse,
+	}
+
+	if cpu, childCPU, err := readProcCPU(); err == nil {
+		status.CPUSeconds, status.ChildCPUSeconds = &cpu, &childCPU
+	} else {
+		status.Unavailable = append(status.Unavailable, "cpu_seconds", "child_cpu_seconds")
+	}
+	if rss, err := readProcRSS(); err == nil {
+		status.RSSBytes = &rss
+	} else {
+		status.Unavailable = append(status.Unavailable, "rss_bytes")
+	}
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		fds := len(entries)
+		status.OpenFDs = &fds
+	} else {
+		status.Unavailable = append(status.Unavailable, "open_fds")
+	}
+	return status
+}
+
+// readProcCPU reads the process and reaped-children CPU times from /proc/self/stat.
+//
+// Returns:
+//   - float64: User+system seconds of this process
+//   - float64: User+system seconds of waited-for children
+//   - error: An error if the file is missing or malformed
+func readProcCPU() (float64, float64, error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The command name may contain spaces, so fields are counted after its closing paren;
+	// utime, stime, cutime and cstime are fields 14-17, i.e. 11-14 after it
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 15 {
+		return 0, 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	ticks := make([]float64, 4)
+	for i := range ticks {
+		if ticks[i], err = strconv.ParseFloat(fields[11+i], 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return (ticks[0] + ticks[1]) / procClockTicks, (ticks[2] + ticks[3]) / procClockTicks, nil
+}
+
+// readProcRSS reads the resident set size from /proc/self/status.
+//
+// Returns:
+//   - int64: Resident memory in bytes
+//   - error: An error if the file is missing or has no VmRSS line
+func readProcRSS() (int64, error) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, "VmRSS:"); found {
+			kb, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "kB")), 10, 64)
+			return kb * 1024, err
+		}
+	}
+	return 0, fmt.Errorf("VmRSS not found in /proc/self/status")
+}
+
+// ResourceStatusArguments defines the input structure for the MCP resource_status tool.
+// The tool takes no parameters; the struct exists to satisfy the tool handler signature.
+type ResourceStatusArguments struct{}
+
+// handleResourceStatusTool returns the server's resource usage for on-the-box diagnostics.
+//
+// Parameters:
+//   - ctx: The tool call context
+//   - arguments: Unused; the tool takes no arguments
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON resource snapshot, or an error message for non-admin callers
+//   - error: Any error that occurred while encoding the response
+func handleResourceStatusTool(ctx context.Context, arguments ResourceStatusArguments) (*mcpgolang.ToolResponse, error) {
+	if denied := requireAdmin(ctx); denied != nil {
+		return denied, nil
+	}
+
+	data, err := json.MarshalIndent(currentResourceStatus(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode resource status: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// cachedResponse is a completed request kept in the response cache
+type cachedResponse struct {
+	key     string           // requestHash of the transformed request
+	result  CompletionResult // The completion as first generated
+	expires time.Time        // When the entry stops being served
+}
+
+// Response cache state: entries in least-recently-used order (front is newest) and
+// indexed by key. The cache is only used when ResponseCacheSize is positive.
+var (
+	responseCacheOrder = list.New()
+	responseCacheIndex = make(map[string]*list.Element)
+	responseCacheMu    sync.Mutex // Guards responseCacheOrder and responseCacheIndex
+)
+
+// responseCacheKey returns the cache key for a request: its resolvedRequestHash, so
+// prompts using variables such as {{date}} don't share stale entries.
+// Requests whose sampling is random are not cached unless ForceCache is set.
+//
+// Parameters:
+//   - arguments: The completion request as received
+//
+// Returns:
+//   - string: The key, or "" when the request must not be cached
+func responseCacheKey(arguments CompletionArguments) string {
+	if appArgs.ResponseCacheSize <= 0 {
+		return ""
+	}
+	hash, transformed, err := resolvedRequestHash(arguments)
+	if err != nil {
+		return ""
+	}
+	if !appArgs.ForceCache && !isDeterministic(resolveArguments(transformed)) {
+		return ""
+	}
+	return hash
+}
+
+// isDeterministic reports whether a request always produces the same output: sampling
+// is greedy (temperature 0 without a dynamic range, or top_k 1, with mirostat off), or
+// the seed is fixed. An unset temperature resolves to llama-cli's default, not 0, so
+// such a request needs top_k 1 or a seed.
+//
+// Parameters:
+//   - resolved: The request with server defaults filled in (see resolveArguments)
+//
+// Returns:
+//   - bool: True if a cached answer is the answer the request would produce
+func isDeterministic(resolved CompletionArguments) bool {
+	if resolved.Seed != nil && *resolved.Seed >= 0 {
+		return true
+	}
+	return resolved.Mirostat == 0 && ((resolved.Temperature <= 0 && resolved.DynatempRange <= 0) || resolved.TopK == 1)
+}
+
+// cachedCompletion looks up a cached completion, refreshing its recency on a hit.
+// Expired entries are treated as misses and removed.
+//
+// Parameters:
+//   - key: The cache key from responseCacheKey
+//
+// Returns:
+//   - CompletionResult: The cached completion
+//   - bool: Whether there was a fresh entry
+func cachedCompletion(key string) (CompletionResult, bool) {
+	if key == "" {
+		return CompletionResult{}, false
+	}
+
+	responseCacheMu.Lock()
+	element, ok := responseCacheIndex[key]
+	expired := ok && time.Now().After(element.Value.(*cachedResponse).expires)
+	if expired {
+		removeCachedResponse(element)
+		ok = false
+	}
+	var result CompletionResult
+	if ok {
+		responseCacheOrder.MoveToFront(element)
+		result = element.Value.(*cachedResponse).result
+	}
+	responseCacheMu.Unlock()
+
+	if expired {
+		metricsCacheEvicted(1)
+	}
+	metricsCacheLookup(ok)
+	return result, ok
+}
+
+// storeCompletion caches a successful completion, evicting the least recently used
+// entries beyond ResponseCacheSize.
+//
+// Parameters:
+//   - key: The cache key from responseCacheKey
+//   - result: The completion to cache
+func storeCompletion(key string, result CompletionResult) {
+	if key == "" {
+		return
+	}
+
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+
+	entry := &cachedResponse{
+		key:     key,
+		result:  result,
+		expires: time.Now().Add(time.Duration(appArgs.ResponseCacheTTLSeconds) * time.Second),
+	}
+	if element, ok := responseCacheIndex[key]; ok {
+		element.Value = entry
+		responseCacheOrder.MoveToFront(element)
+		return
+	}
+	responseCacheIndex[key] = responseCacheOrder.PushFront(entry)
+
+	evicted := 0
+	for responseCacheOrder.Len() > appArgs.ResponseCacheSize {
+		removeCachedResponse(responseCacheOrder.Back())
+		evicted++
+	}
+	metricsCacheEvicted(evicted)
+}
+
+// removeCachedResponse drops an entry. Callers must hold responseCacheMu.
+//
+// Parameters:
+//   - element: The entry's list element
+func removeCachedResponse(element *list.Element) {
+	responseCacheOrder.Remove(element)
+	delete(responseCacheIndex, element.Value.(*cachedResponse).key)
+}
+
+// sweepResponseCache removes every expired entry.
+//
+// Returns:
+//   - int: The number of entries removed
+func sweepResponseCache() int {
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for element := responseCacheOrder.Back(); element != nil; {
+		prev := element.Prev()
+		if now.After(element.Value.(*cachedResponse).expires) {
+			removeCachedResponse(element)
+			removed++
+		}
+		element = prev
+	}
+	return removed
+}
+
+// startResponseCacheSweeper evicts expired cache entries every
+// ResponseCacheSweepSeconds until the context is canceled, so entries that are never
+// requested again don't hold memory until LRU pressure pushes them out.
+//
+// Parameters:
+//   - ctx: Context whose cancellation stops the sweeper
+func startResponseCacheSweeper(ctx context.Context) {
+	if appArgs.ResponseCacheSize <= 0 || appArgs.ResponseCacheSweepSeconds <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(appArgs.ResponseCacheSweepSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if removed := sweepResponseCache(); removed > 0 {
+					metricsCacheEvicted(removed)
+					logger.Printf("Response cache sweep evicted %d expired entries", removed)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os/exec"
+	"regexp"
+	"time"
+)
+
+// deterministicFailurePattern matches llama.cpp stderr output for failures that a
+// relaunch would only repeat: rejected arguments and files that cannot be read
+var deterministicFailurePattern = regexp.MustCompile(`(?i)unknown argument|invalid argument|error while handling argument|usage:|no such file or directory|failed to open|invalid magic`)
+
+// isTransientLaunchFailure reports whether a failed llama-cli run is worth relaunching:
+// the process ran and exited with an error before producing any output, the request is
+// still live, and stderr does not show an argument, missing file or flash attention
+// failure.
+//
+// Parameters:
+//   - ctx: The request context
+//   - err: The error returned by runLlamaCommand
+//   - output: The output the failed run produced
+//
+// Returns:
+//   - bool: True if the run should be retried
+func isTransientLaunchFailure(ctx context.Context, err error, output []byte) bool {
+	var execErr *LlamaExecError
+	if err == nil || ctx.Err() != nil || len(output) > 0 || !errors.As(err, &execErr) {
+		return false
+	}
+
+	// A binary that cannot be started will not start on the next attempt either
+	var startErr *exec.Error
+	if errors.As(err, &startErr) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return false
+	}
+	return !isFlashAttentionFailure(err) && !deterministicFailurePattern.MatchString(execErr.Stderr)
+}
+
+// retryBackoff returns the delay before the given relaunch, starting at RetryBackoffMs
+// and doubling per retry.
+//
+// Parameters:
+//   - retry: The relaunch about to happen, starting at 1
+//
+// Returns:
+//   - time.Duration: How long to wait first
+func retryBackoff(retry int) time.Duration {
+	return time.Duration(appArgs.RetryBackoffMs) * time.Millisecond << (retry - 1)
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+//
+// Parameters:
+//   - ctx: Context whose cancellation or deadline cuts the wait short
+//   - d: How long to wait
+//
+// Returns:
+//   - error: ctx.Err() if the context ended the wait, nil otherwise
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
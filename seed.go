@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+// conversationSeed derives a deterministic llama-cli seed for one turn of a
+// conversation: the first four bytes of SHA-256("<conversation_id>:<turn>"),
+// big-endian, masked to 31 bits so it is never negative (negative means random).
+//
+// Parameters:
+//   - conversationID: The client-chosen conversation identifier
+//   - turn: The turn number within the conversation
+//
+// Returns:
+//   - uint32: The seed for this turn
+func conversationSeed(conversationID string, turn int) uint32 {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", conversationID, turn)))
+	return binary.BigEndian.Uint32(sum[:4]) & 0x7fffffff
+}
+
+// maxSeed is the largest seed llama-cli accepts; 0xFFFFFFFF asks it for a random seed
+const maxSeed = 0xFFFFFFFE
+
+// validateSeed checks a request's explicit seed.
+//
+// Parameters:
+//   - arguments: The completion request, with a non-negative seed
+//
+// Returns:
+//   - error: An error if the seed is out of range, conflicts with conversation_id, or
+//     RandomSeedCmd is not configured
+func validateSeed(arguments CompletionArguments) error {
+	if llamaCliArgs.RandomSeedCmd == "" {
+		return fmt.Errorf("seed is not supported: RandomSeedCmd is not configured")
+	}
+	if *arguments.Seed > maxSeed {
+		return fmt.Errorf("seed must be at most %d, got %d", maxSeed, *arguments.Seed)
+	}
+	if arguments.ConversationID != "" {
+		return fmt.Errorf("seed cannot be combined with conversation_id")
+	}
+	return nil
+}
+
+// withRandomSeed gives a request without a seed or conversation_id a random seed, so
+// llama-cli is passed it explicitly and the response can report it. Nothing is chosen
+// when RandomSeedCmd is not configured.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - CompletionArguments: The request with Seed set when one was chosen
+func withRandomSeed(arguments CompletionArguments) CompletionArguments {
+	if (arguments.Seed != nil && *arguments.Seed >= 0) || arguments.ConversationID != "" || llamaCliArgs.RandomSeedCmd == "" {
+		return arguments
+	}
+	seed := int(rand.Int31())
+	arguments.Seed = &seed
+	return arguments
+}
+
+// nudgeSeed returns a copy of args whose seed is moved by offset. A seed already in
+// the arguments is incremented so retries stay reproducible; otherwise a random seed
+// is added. It reports false, leaving args unchanged, when RandomSeedCmd is not
+// configured.
+//
+// Parameters:
+//   - args: The llama-cli arguments of the previous attempt
+//   - offset: How far to move the seed (the retry number)
+//
+// Returns:
+//   - []string: The arguments with the new seed
+//   - uint32: The seed used
+//   - bool: Whether the seed could be changed
+func nudgeSeed(args []string, offset int) ([]string, uint32, bool) {
+	if llamaCliArgs.RandomSeedCmd == "" {
+		return args, 0, false
+	}
+	nudged := append([]string(nil), args...)
+	for i := len(nudged) - 2; i >= 0; i-- {
+		if nudged[i] != llamaCliArgs.RandomSeedCmd {
+			continue
+		}
+		if seed, err := strconv.ParseInt(nudged[i+1], 10, 64); err == nil && seed >= 0 {
+			next := uint32(seed+int64(offset)) & 0x7fffffff
+			nudged[i+1] = strconv.FormatUint(uint64(next), 10)
+			return nudged, next, true
+		}
+	}
+
+	seed := uint32(rand.Int31())
+	return append(nudged, llamaCliArgs.RandomSeedCmd, strconv.FormatUint(uint64(seed), 10)), seed, true
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// Split strategies for prompts larger than the context window
+const (
+	SplitStrategyWindows  = "windows"  // Return each window's output separately
+	SplitStrategyCombined = "combined" // Return the window outputs joined into one text
+)
+
+// SplitWindow is the labeled result of one prompt window
+type SplitWindow struct {
+	Index      int    `json:"index"`       // Window number, starting at 0
+	StartToken int    `json:"start_token"` // First prompt token in the window
+	EndToken   int    `json:"end_token"`   // One past the last prompt token in the window
+	Output     string `json:"output"`      // Completion for this window
+
+	result CompletionResult // Full result, for warnings and token accounting
+}
+
+// validateSplitStrategy checks that a split strategy is supported.
+//
+// Parameters:
+//   - strategy: The requested strategy; empty disables splitting
+//
+// Returns:
+//   - error: A descriptive error if the strategy is unknown
+func validateSplitStrategy(strategy string) error {
+	switch strategy {
+	case "", SplitStrategyWindows, SplitStrategyCombined:
+		return nil
+	default:
+		return fmt.Errorf("invalid split_strategy %q: must be windows or combined", strategy)
+	}
+}
+
+// executeSplitCompletion splits the prompt into overlapping token windows of
+// SplitWindowTokens (SplitOverlapTokens shared between neighbours), prefixes each with
+// split_instruction, and runs a completion per window. Prompt templates and variables
+// are applied before splitting, so windows are cut from the prompt that would have run.
+// Windows run one after another under the caller's completion slot, so a split request
+// never holds more than its share of MaxConcurrentRequests.
+//
+// Parameters:
+//   - ctx: Context for cancellation of all windows
+//   - arguments: The completion request with a split strategy
+//
+// Returns:
+//   - []SplitWindow: The windows in prompt order
+//   - error: ErrInvalidArguments for bad settings, otherwise the first window error
+func executeSplitCompletion(ctx context.Context, arguments CompletionArguments) ([]SplitWindow, error) {
+	if err := validateSplitStrategy(arguments.SplitStrategy); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	if arguments.PromptFile != "" {
+		return nil, fmt.Errorf("%w: split_strategy cannot be combined with prompt_file", ErrInvalidArguments)
+	}
+	size, overlap := appArgs.SplitWindowTokens, appArgs.SplitOverlapTokens
+	if size <= 0 || overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("%w: SplitWindowTokens must be positive and larger than SplitOverlapTokens", ErrInvalidArguments)
+	}
+
+	arguments, err := applyPromptTransforms(arguments)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+
+	// Window on token boundaries, rebuilding each window's text from the token pieces
+	noBos := false
+	pieces, err := tokenizePieces(ctx, CountTokensArguments{Prompt: arguments.Prompt, Model: arguments.Model, AddBos: &noBos})
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenize prompt for splitting: %w", err)
+	}
+
+	var windows []SplitWindow
+	for start := 0; ; start += size - overlap {
+		end := min(start+size, len(pieces))
+		windows = append(windows, SplitWindow{Index: len(windows), StartToken: start, EndToken: end})
+		if end == len(pieces) {
+			break
+		}
+	}
+	logger.Printf("Splitting %d-token prompt into %d windows of %d tokens (overlap %d)", len(pieces), len(windows), size, overlap)
+
+	for i := range windows {
+		window := &windows[i]
+		var text strings.Builder
+		for _, piece := range pieces[window.StartToken:window.EndToken] {
+			text.WriteString(piece.Piece)
+		}
+
+		windowArgs := arguments
+		windowArgs.SplitStrategy = ""
+		windowArgs.Prompt = arguments.SplitInstruction + text.String()
+
+		window.result, err = executeCompletion(ctx, windowArgs)
+		if err != nil {
+			return windows, fmt.Errorf("window %d: %w", i, err)
+		}
+		window.Output = string(window.result.Output)
+	}
+	return windows, nil
+}
+
+// splitResponse builds the tool response for a split completion: a {"windows": [...]}
+// document, or the window outputs joined by blank lines for the combined strategy.
+// Warnings from all windows follow, deduplicated.
+//
+// Parameters:
+//   - arguments: The completion request
+//   - windows: The completed windows
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The response
+//   - error: Any error that occurred while encoding the response
+func splitResponse(arguments CompletionArguments, windows []SplitWindow) (*mcpgolang.ToolResponse, error) {
+	var content []*mcpgolang.Content
+	if arguments.SplitStrategy == SplitStrategyCombined {
+		outputs := make([]string, len(windows))
+		for i, window := range windows {
+			outputs[i] = strings.TrimSpace(window.Output)
+		}
+		content = append(content, mcpgolang.NewTextContent(strings.Join(outputs, "\n\n")))
+	} else {
+		data, err := json.Marshal(map[string][]SplitWindow{"windows": windows})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode windows: %w", err)
+		}
+		content = append(content, mcpgolang.NewTextContent(string(data)))
+	}
+
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, window := range windows {
+		for _, warning := range window.result.Warnings {
+			if !seen[warning] {
+				seen[warning] = true
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+	if block, err := warningsContent(warnings); err != nil {
+		return nil, err
+	} else if block != nil {
+		content = append(content, block)
+	}
+	return &mcpgolang.ToolResponse{Content: content}, nil
+}
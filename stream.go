@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamTokenKey is the gin context key holding the progress token for streamed output
+const streamTokenKey = "streamProgressToken"
+
+// sseResponseWriter lets a tool handler switch an MCP response to Server-Sent Events.
+// Until streaming starts it passes writes through; afterwards every write (including the
+// final JSON-RPC response written by the transport) is framed as an SSE "message" event.
+type sseResponseWriter struct {
+	gin.ResponseWriter
+	mu        sync.Mutex // Serializes events
+	streaming bool       // Whether the response has switched to text/event-stream
+}
+
+// Write frames data as an SSE event once streaming has started.
+//
+// Parameters:
+//   - data: A complete JSON-RPC message, or any body before streaming starts
+//
+// Returns:
+//   - int: The number of bytes of data written
+//   - error: Any error from the underlying writer
+func (w *sseResponseWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.streaming {
+		return w.ResponseWriter.Write(data)
+	}
+	if _, err := w.ResponseWriter.Write([]byte("event: message\ndata: ")); err != nil {
+		return 0, err
+	}
+	n, err := w.ResponseWriter.Write(data)
+	if err != nil {
+		return n, err
+	}
+	if _, err := w.ResponseWriter.Write([]byte("\n\n")); err != nil {
+		return n, err
+	}
+	w.ResponseWriter.Flush()
+	return n, nil
+}
+
+// writeEvent writes one SSE event with a name other than "message", once streaming has
+// started.
+//
+// Parameters:
+//   - event: The SSE event name
+//   - data: A complete JSON-RPC message
+//
+// Returns:
+//   - error: Any error from the underlying writer
+func (w *sseResponseWriter) writeEvent(event string, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.streaming {
+		return nil
+	}
+	if _, err := w.ResponseWriter.Write([]byte("event: " + event + "\ndata: ")); err != nil {
+		return err
+	}
+	if _, err := w.ResponseWriter.Write(data); err != nil {
+		return err
+	}
+	if _, err := w.ResponseWriter.Write([]byte("\n\n")); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
+
+// start switches the response to text/event-stream.
+func (w *sseResponseWriter) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.streaming {
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.WriteHeaderNow()
+	w.streaming = true
+}
+
+// streamingMiddleware prepares MCP requests from clients that accept
+// text/event-stream so a tool handler can stream partial output. It records the
+// progress token (the request's _meta.progressToken, or its JSON-RPC id) for the
+// notifications and wraps the response writer.
+//
+// Returns:
+//   - gin.HandlerFunc: The middleware
+func streamingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+			c.Next()
+			return
+		}
+
+		// Peek at the JSON-RPC envelope, then restore the body for the transport
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var envelope struct {
+			ID     json.RawMessage `json:"id"`
+			Params struct {
+				Meta struct {
+					ProgressToken json.RawMessage `json:"progressToken"`
+				} `json:"_meta"`
+			} `json:"params"`
+		}
+		if json.Unmarshal(body, &envelope) == nil {
+			token := envelope.Params.Meta.ProgressToken
+			if len(token) == 0 {
+				token = envelope.ID
+			}
+			if len(token) > 0 {
+				c.Set(streamTokenKey, token)
+			}
+		}
+
+		c.Writer = &sseResponseWriter{ResponseWriter: c.Writer}
+		c.Next()
+	}
+}
+
+// outputStream forwards completion output to the client one line at a time as MCP
+// progress notifications.
+type outputStream struct {
+	writer  *sseResponseWriter // Response writer switched to SSE
+	token   json.RawMessage    // Progress token identifying the request
+	pending []byte             // Output received after the last newline
+	count   int                // Notifications sent so far
+
+	done <-chan struct{} // Closed when the client disconnects
+}
+
+// newOutputStream switches the current tool call's HTTP response to text/event-stream.
+//
+// Parameters:
+//   - ctx: The tool handler context
+//
+// Returns:
+//   - *outputStream: The stream, or nil if the client did not accept text/event-stream
+func newOutputStream(ctx context.Context) *outputStream {
+	c, ok := ctx.Value("ginContext").(*gin.Context)
+	if !ok {
+		return nil
+	}
+	writer, ok := c.Writer.(*sseResponseWriter)
+	if !ok {
+		return nil
+	}
+	value, ok := c.Get(streamTokenKey)
+	if !ok {
+		return nil
+	}
+	token, _ := value.(json.RawMessage)
+
+	writer.start()
+	return &outputStream{writer: writer, token: token, done: c.Request.Context().Done()}
+}
+
+// write buffers an output chunk and sends every complete line it finishes.
+//
+// Parameters:
+//   - chunk: Output read from llama-cli; not retained
+func (s *outputStream) write(chunk []byte) {
+	s.pending = append(s.pending, chunk...)
+	for {
+		i := bytes.IndexByte(s.pending, '\n')
+		if i < 0 {
+			return
+		}
+		s.send(string(s.pending[:i+1]))
+		s.pending = s.pending[i+1:]
+	}
+}
+
+// flush sends any output left after the last newline.
+func (s *outputStream) flush() {
+	if len(s.pending) > 0 {
+		s.send(string(s.pending))
+		s.pending = nil
+	}
+}
+
+// send writes one notifications/progress message whose message field is the text.
+//
+// Parameters:
+//   - text: The output text to forward
+func (s *outputStream) send(text string) {
+	s.count++
+	data, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "notifications/progress",
+		"params": map[string]any{
+			"progressToken": s.token,
+			"progress":      s.count,
+			"message":       text,
+		},
+	})
+	if err != nil {
+		return
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		logger.Printf("Warning: failed to stream output: %v", err)
+	}
+}
+
+// cancelled tells the client that the request was canceled on purpose, so it can tell
+// an honored cancel_completion from a failure. It writes an SSE "cancelled" event
+// carrying a notifications/cancelled message; the tool result still follows.
+//
+// Parameters:
+//   - reason: Why the request stopped
+func (s *outputStream) cancelled(reason string) {
+	data, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "notifications/cancelled",
+		"params": map[string]any{
+			"progressToken": s.token,
+			"reason":        reason,
+		},
+	})
+	if err != nil {
+		return
+	}
+	if err := s.writer.writeEvent(JobEventCancelled, data); err != nil {
+		logger.Printf("Warning: failed to stream output: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// PromptTemplateExt is the file extension of prompt templates in PromptTemplatePath
+const PromptTemplateExt = ".tmpl"
+
+var (
+	promptTemplatesValue map[string]*template.Template // Loaded templates by name, empty when not configured
+	promptTemplatesOnce  sync.Once                     // Guards the one-time load of PromptTemplatePath
+)
+
+// loadPromptTemplates parses the *.tmpl files in PromptTemplatePath once and caches
+// them by file name without the extension. A missing directory leaves the registry
+// empty with a logged warning; a file that does not parse is skipped with a warning.
+//
+// Returns:
+//   - map[string]*template.Template: Template name -> parsed template
+func loadPromptTemplates() map[string]*template.Template {
+	promptTemplatesOnce.Do(func() {
+		if appArgs.PromptTemplatePath == "" {
+			return
+		}
+
+		files, err := filepath.Glob(filepath.Join(appArgs.PromptTemplatePath, "*"+PromptTemplateExt))
+		if err == nil && len(files) == 0 {
+			_, err = os.Stat(appArgs.PromptTemplatePath)
+		}
+		if err != nil {
+			logger.Printf("Warning: prompt templates disabled, cannot read %s: %v", appArgs.PromptTemplatePath, err)
+			return
+		}
+
+		templates := make(map[string]*template.Template, len(files))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				logger.Printf("Warning: skipping prompt template %s: %v", file, err)
+				continue
+			}
+			name := strings.TrimSuffix(filepath.Base(file), PromptTemplateExt)
+			parsed, err := template.New(name).Option("missingkey=error").Parse(string(data))
+			if err != nil {
+				logger.Printf("Warning: skipping prompt template %s: %v", file, err)
+				continue
+			}
+			templates[name] = parsed
+		}
+
+		promptTemplatesValue = templates
+		logger.Printf("Loaded %d prompt template(s) from %s", len(templates), appArgs.PromptTemplatePath)
+	})
+	return promptTemplatesValue
+}
+
+// renderPromptTemplate replaces a request's prompt with its named template rendered
+// against the request's template variables. The variables are the prompt variables
+// (see promptVariables), then prompt holding the request's own prompt text when it has
+// one, then TemplateVars, each overriding the ones before. Requests without a template
+// are returned unchanged.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - CompletionArguments: The request with the rendered prompt and no template
+//   - error: An error for an unknown template or a variable the template needs but
+//     the request does not define
+func renderPromptTemplate(arguments CompletionArguments) (CompletionArguments, error) {
+	if arguments.Template == "" {
+		return arguments, nil
+	}
+
+	templates := loadPromptTemplates()
+	tmpl, ok := templates[arguments.Template]
+	if !ok {
+		if len(templates) == 0 {
+			return arguments, fmt.Errorf("unknown template %q: no prompt templates are configured", arguments.Template)
+		}
+		return arguments, fmt.Errorf("unknown template %q, must be one of %s", arguments.Template, strings.Join(slices.Sorted(maps.Keys(templates)), ", "))
+	}
+
+	vars := promptVariables()
+	if arguments.Prompt != "" {
+		vars["prompt"] = arguments.Prompt
+	}
+	maps.Copy(vars, arguments.TemplateVars)
+
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, vars); err != nil {
+		return arguments, fmt.Errorf("cannot render template %q: %v", arguments.Template, err)
+	}
+	arguments.Prompt = prompt.String()
+	arguments.Template, arguments.TemplateVars = "", nil
+	return arguments, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// CountTokensArguments defines the input structure for the MCP count_tokens tool
+type CountTokensArguments struct {
+	Prompt        string `json:"prompt" description:"The text to tokenize"`
+	Model         string `json:"model,omitempty" description:"Model path or registry name whose vocabulary to use (overrides default)"`
+	AddBos        *bool  `json:"add_bos,omitempty" description:"Prepend the BOS token as generation would (default true)"`
+	ParseSpecial  *bool  `json:"parse_special,omitempty" description:"Parse special tokens such as <|im_start|> in the text (default true)"`
+	IncludeTokens bool   `json:"include_tokens,omitempty" description:"Also return the token ids"`
+}
+
+// TokenizeResult is the JSON document returned by the count_tokens tool
+type TokenizeResult struct {
+	TokenCount int   `json:"token_count"`      // Number of tokens in the prompt
+	Tokens     []int `json:"tokens,omitempty"` // Token ids, when requested
+}
+
+// tokenizeCliPath returns the llama-tokenize executable to use: TokenizeCliPath when
+// configured, otherwise llama-tokenize next to llama-cli.
+//
+// Returns:
+//   - string: Path to the tokenizer executable
+func tokenizeCliPath() string {
+	if appArgs.TokenizeCliPath != "" {
+		return appArgs.TokenizeCliPath
+	}
+	name := "llama-tokenize"
+	if strings.EqualFold(filepath.Ext(appArgs.LLamaCliPath), ".exe") {
+		name += ".exe"
+	}
+	return filepath.Join(filepath.Dir(appArgs.LLamaCliPath), name)
+}
+
+// prepareTokenizeArgs builds the llama-tokenize arguments for a request. By default
+// only the token id list is requested so the count can be derived from it.
+//
+// Parameters:
+//   - arguments: The tokenize request
+//   - withPieces: List each token with its text piece instead of the bare id list
+//
+// Returns:
+//   - []string: The llama-tokenize argument list
+//   - error: An error if the model override escapes ModelPath
+func prepareTokenizeArgs(arguments CountTokensArguments, withPieces bool) ([]string, error) {
+	model := llamaCliArgs.ModelFullPathVal
+	if arguments.Model != "" {
+		var err error
+		if model, err = resolveModelPath(arguments.Model); err != nil {
+			return nil, err
+		}
+	}
+
+	args := []string{"--model", model, "--prompt", arguments.Prompt, "--log-disable"}
+	if !withPieces {
+		args = append(args, "--ids")
+	}
+	if arguments.AddBos != nil && !*arguments.AddBos {
+		args = append(args, "--no-bos")
+	}
+	if arguments.ParseSpecial != nil && !*arguments.ParseSpecial {
+		args = append(args, "--no-parse-special")
+	}
+	return args, nil
+}
+
+// parseTokenIds parses the "[1, 2, 3]" token id list printed by llama-tokenize --ids.
+// Any log lines before the list are ignored.
+//
+// Parameters:
+//   - output: The llama-tokenize standard output
+//
+// Returns:
+//   - []int: The token ids
+//   - error: An error if no id list could be found
+func parseTokenIds(output string) ([]int, error) {
+	start := strings.LastIndex(output, "[")
+	end := strings.LastIndex(output, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("unexpected llama-tokenize output: %.200s", output)
+	}
+
+	var tokens []int
+	if err := json.Unmarshal([]byte(output[start:end+1]), &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token ids: %w", err)
+	}
+	return tokens, nil
+}
+
+// tokenize runs llama-tokenize for a request and returns the token ids.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - arguments: The text to tokenize and tokenization options
+//
+// Returns:
+//   - []int: The token ids
+//   - error: Any execution or parse error
+func tokenize(ctx context.Context, arguments CountTokensArguments) ([]int, error) {
+	// Run llama-tokenize through the same cancellable executor as completions
+	tokenizeArgs := appArgs
+	tokenizeArgs.LLamaCliPath = tokenizeCliPath()
+	args, err := prepareTokenizeArgs(arguments, false)
+	if err != nil {
+		return nil, err
+	}
+	output, err := GenerateSingleCompletionWithCancel(ctx, tokenizeArgs, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokenIds(string(output))
+}
+
+// handleCountTokensTool tokenizes a prompt with the model's vocabulary without
+// generating, so clients can budget context precisely.
+//
+// Parameters:
+//   - ctx: The tool call context, carrying the authenticated token when auth is enabled
+//   - arguments: The text to tokenize and tokenization options
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON {"token_count", "tokens"} or an error message
+//   - error: Any error that occurred while encoding the response
+func handleCountTokensTool(ctx context.Context, arguments CountTokensArguments) (*mcpgolang.ToolResponse, error) {
+	if arguments.Prompt == "" {
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent("Error: Prompt cannot be empty")), nil
+	}
+	if token, model := authTokenFromContext(ctx), effectiveModel(CompletionArguments{Model: arguments.Model}); !modelAllowedForToken(token, model) {
+		logger.Printf("Token %q is not permitted to use model %q", token.Name, model)
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error: model %q is not permitted for this token", filepath.Base(model)))), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(completionTimeoutSeconds(PriorityNormal))*time.Second)
+	defer cancel()
+
+	tokens, err := tokenize(ctx, arguments)
+	if err != nil {
+		logger.Printf("Error tokenizing prompt: %v", redactText(err.Error()))
+		return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(fmt.Sprintf("Error tokenizing prompt: %v", err))), nil
+	}
+
+	result := TokenizeResult{TokenCount: len(tokens)}
+	if arguments.IncludeTokens {
+		result.Tokens = tokens
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode token count: %w", err)
+	}
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPrepareTokenizeArgs(t *testing.T) {
+	setLlamaCliArgs(t, LlamaCliArgs{ModelFullPathVal: "/models/default.gguf"})
+	no := false
+
+	tests := []struct {
+		name       string
+		arguments  CountTokensArguments
+		withPieces bool
+		expect     []string
+	}{
+		{
+			name:      "token ids",
+			arguments: CountTokensArguments{Prompt: "Hello"},
+			expect:    []string{"--model", "/models/default.gguf", "--prompt", "Hello", "--log-disable", "--ids"},
+		},
+		{
+			name:       "pieces",
+			arguments:  CountTokensArguments{Prompt: "Hello"},
+			withPieces: true,
+			expect:     []string{"--model", "/models/default.gguf", "--prompt", "Hello", "--log-disable"},
+		},
+		{
+			name:      "without BOS and special tokens",
+			arguments: CountTokensArguments{Prompt: "-n 5", AddBos: &no, ParseSpecial: &no},
+			expect:    []string{"--model", "/models/default.gguf", "--prompt", "-n 5", "--log-disable", "--ids", "--no-bos", "--no-parse-special"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := prepareTokenizeArgs(tt.arguments, tt.withPieces)
+			if err != nil {
+				t.Fatalf("prepareTokenizeArgs() error = %v", err)
+			}
+			if !slices.Equal(args, tt.expect) {
+				t.Errorf("prepareTokenizeArgs() = %q, want %q", args, tt.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// GetConfigArguments defines the input structure for the MCP get_config tool.
+// The tool takes no parameters; the struct exists to satisfy the tool handler signature.
+type GetConfigArguments struct{}
+
+// ServerConfigSnapshot is the JSON document returned by the get_config tool
+type ServerConfigSnapshot struct {
+	LlamaVersion   LlamaVersion `json:"llama_version"`   // llama.cpp build backing this server
+	LLamaCliPath   string       `json:"llama_cli_path"`  // Path to the llama-cli executable
+	DefaultModel   string       `json:"default_model"`   // Model used when a request doesn't override it
+	ModelPath      string       `json:"model_path"`      // Directory where model files are stored
+	EndPoint       string       `json:"endpoint"`        // MCP endpoint path
+	HttpPort       string       `json:"http_port"`       // MCP listen address
+	TimeOutSeconds int          `json:"timeout_seconds"` // Default completion timeout
+}
+
+// currentConfigSnapshot captures the effective server configuration.
+//
+// Returns:
+//   - ServerConfigSnapshot: The configuration and llama.cpp version in use
+func currentConfigSnapshot() ServerConfigSnapshot {
+	return ServerConfigSnapshot{
+		LlamaVersion:   GetLlamaVersion(appArgs),
+		LLamaCliPath:   appArgs.LLamaCliPath,
+		DefaultModel:   llamaCliArgs.ModelFullPathVal,
+		ModelPath:      appArgs.ModelPath,
+		EndPoint:       appArgs.EndPoint,
+		HttpPort:       appArgs.HttpPort,
+		TimeOutSeconds: appArgs.TimeOutSeconds,
+	}
+}
+
+// handleGetConfigTool returns the effective server configuration together with the
+// llama.cpp version, so generated outputs can be tied to a specific backend build.
+//
+// Parameters:
+//   - arguments: Unused; the tool takes no parameters
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: JSON document describing the server configuration
+//   - error: Any error that occurred while encoding the response
+func handleGetConfigTool(arguments GetConfigArguments) (*mcpgolang.ToolResponse, error) {
+	data, err := json.MarshalIndent(currentConfigSnapshot(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	return mcpgolang.NewToolResponse(mcpgolang.NewTextContent(string(data))), nil
+}
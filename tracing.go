@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TraceExportTimeout bounds a single OTLP span export
+const TraceExportTimeout = 5 * time.Second
+
+// traceClient is shared by all span exports
+var traceClient = &http.Client{Timeout: TraceExportTimeout}
+
+// traceparentPattern matches a W3C traceparent header: version-traceid-spanid-flags
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// traceSpan is a single request span, exported as OTLP/HTTP JSON when it ends.
+// A nil *traceSpan is valid and does nothing, so callers need no enabled checks.
+type traceSpan struct {
+	traceID      string         // 32-hex trace id, inherited from traceparent when present
+	spanID       string         // 16-hex id of this span
+	parentSpanID string         // Span id from traceparent, empty for root spans
+	name         string         // Span name
+	start        time.Time      // When the span started
+	attributes   map[string]any // Span attributes (string, int, float64 or bool)
+}
+
+// startSpan starts a span for a tool call, continuing the trace from the incoming
+// request's traceparent header when present.
+//
+// Parameters:
+//   - ctx: The tool call context carrying the HTTP request
+//   - name: The span name
+//
+// Returns:
+//   - *traceSpan: The started span, or nil when tracing is disabled
+func startSpan(ctx context.Context, name string) *traceSpan {
+	if !appArgs.OtelEnabled {
+		return nil
+	}
+
+	span := &traceSpan{
+		traceID:    randomHex(16),
+		spanID:     randomHex(8),
+		name:       name,
+		start:      time.Now(),
+		attributes: make(map[string]any),
+	}
+	if c, ok := ctx.Value("ginContext").(*gin.Context); ok {
+		if match := traceparentPattern.FindStringSubmatch(c.GetHeader("traceparent")); match != nil &&
+			match[1] != "00000000000000000000000000000000" && match[2] != "0000000000000000" {
+			span.traceID, span.parentSpanID = match[1], match[2]
+		}
+	}
+	return span
+}
+
+// SetAttribute records an attribute on the span.
+//
+// Parameters:
+//   - key: The attribute name
+//   - value: A string, int, float64 or bool value
+func (s *traceSpan) SetAttribute(key string, value any) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// End finishes the span and exports it in the background. A non-nil error marks
+// the span status as failed.
+//
+// Parameters:
+//   - err: The request error, or nil on success
+func (s *traceSpan) End(err error) {
+	if s == nil {
+		return
+	}
+
+	end := time.Now()
+	s.SetAttribute("duration_ms", end.Sub(s.start).Milliseconds())
+	status := map[string]any{"code": 1}
+	if err != nil {
+		status = map[string]any{"code": 2, "message": err.Error()}
+	}
+
+	attributes := make([]map[string]any, 0, len(s.attributes))
+	for key, value := range s.attributes {
+		attributes = append(attributes, map[string]any{"key": key, "value": otlpValue(value)})
+	}
+	span := map[string]any{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              2, // SPAN_KIND_SERVER
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+		"attributes":        attributes,
+		"status":            status,
+	}
+	if s.parentSpanID != "" {
+		span["parentSpanId"] = s.parentSpanID
+	}
+
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": []any{
+				map[string]any{"key": "service.name", "value": otlpValue(appArgs.OtelServiceName)},
+			}},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "byte-vision-mcp"},
+				"spans": []any{span},
+			}},
+		}},
+	}
+	go func() {
+		if err := exportSpan(payload); err != nil {
+			logger.Printf("Failed to export trace span %s: %v", s.spanID, err)
+		}
+	}()
+}
+
+// otlpValue wraps a Go value in the OTLP JSON AnyValue encoding.
+//
+// Parameters:
+//   - value: A string, int, int64, float64 or bool value
+//
+// Returns:
+//   - map[string]any: The encoded value; other types are encoded as strings
+func otlpValue(value any) map[string]any {
+	switch v := value.(type) {
+	case int:
+		return map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		return map[string]any{"doubleValue": v}
+	case bool:
+		return map[string]any{"boolValue": v}
+	case string:
+		return map[string]any{"stringValue": v}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+// exportSpan POSTs an OTLP JSON trace payload to OtelExporterEndpoint.
+//
+// Parameters:
+//   - payload: The ExportTraceServiceRequest document
+//
+// Returns:
+//   - error: Any encoding or transport error, or a non-2xx response status
+func exportSpan(payload map[string]any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode span: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, appArgs.OtelExporterEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range appArgs.OtelExporterHeaders {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := traceClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// randomHex returns n random bytes hex-encoded.
+//
+// Parameters:
+//   - n: Number of random bytes
+//
+// Returns:
+//   - string: A 2n-character hexadecimal string
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// finishReason describes why a completion stopped, for tracing.
+//
+// Parameters:
+//   - arguments: The completion request
+//   - tokens: Generated token count
+//   - err: The completion error, or nil on success
+//
+// Returns:
+//   - string: "stop", "length", "timeout", "canceled" or "error"
+func finishReason(arguments CompletionArguments, tokens int, err error) string {
+	switch outcomeForError(err) {
+	case outcomeSuccess:
+	case outcomeTimeout:
+		return "timeout"
+	default:
+		if errors.Is(err, context.Canceled) {
+			return "canceled"
+		}
+		return "error"
+	}
+
+	predict := arguments.Predict
+	if predict <= 0 {
+		predict, _ = strconv.Atoi(llamaCliArgs.PredictVal)
+	}
+	if predict > 0 && tokens >= predict {
+		return "length"
+	}
+	return "stop"
+}
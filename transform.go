@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+// promptVariablePattern matches {{name}} placeholders, allowing spaces inside the braces
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// applyPromptTransforms runs the server-side prompt transforms (template rendering, then
+// variable substitution) on a request before its llama-cli arguments are built.
+//
+// Parameters:
+//   - arguments: The completion request
+//
+// Returns:
+//   - CompletionArguments: The request with its prompt transformed
+//   - error: An argument error if a transform rejects the prompt
+func applyPromptTransforms(arguments CompletionArguments) (CompletionArguments, error) {
+	arguments, err := renderPromptTemplate(arguments)
+	if err != nil {
+		return arguments, err
+	}
+	if appArgs.VariablesEnabled {
+		prompt, err := substituteVariables(arguments.Prompt)
+		if err != nil {
+			return arguments, err
+		}
+		arguments.Prompt = prompt
+	}
+	return arguments, nil
+}
+
+// promptVariables returns the variables available to prompts: the built-in date,
+// datetime and hostname values, overridden by any configured PromptVariables.
+//
+// Returns:
+//   - map[string]string: Variable name -> value
+func promptVariables() map[string]string {
+	now := time.Now()
+	vars := map[string]string{
+		"date":     now.Format("2006-01-02"),
+		"datetime": now.Format(time.RFC3339),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		vars["hostname"] = hostname
+	}
+	for name, value := range appArgs.PromptVariables {
+		vars[name] = value
+	}
+	return vars
+}
+
+// substituteVariables replaces {{name}} placeholders in a prompt with server-side
+// variable values. Undefined variables are rejected unless UndefinedVariablePolicy
+// is "keep", in which case the placeholder is left untouched.
+//
+// Parameters:
+//   - prompt: The prompt text
+//
+// Returns:
+//   - string: The prompt with variables substituted
+//   - error: An error naming the first undefined variable
+func substituteVariables(prompt string) (string, error) {
+	vars := promptVariables()
+
+	var undefined string
+	result := promptVariablePattern.ReplaceAllStringFunc(prompt, func(placeholder string) string {
+		name := promptVariablePattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		if undefined == "" {
+			undefined = name
+		}
+		return placeholder
+	})
+
+	if undefined != "" && appArgs.UndefinedVariablePolicy != "keep" {
+		return "", fmt.Errorf("undefined prompt variable %q", undefined)
+	}
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+// Accepted values of the Transport setting
+const (
+	TransportHTTP  = "http"  // Streamable HTTP on HttpPort/EndPoint, with the operational endpoints
+	TransportStdio = "stdio" // JSON-RPC over stdin/stdout for clients that launch the server
+)
+
+// eofNotifyingReader wraps stdin for the stdio transport and closes a channel once it
+// reaches end of file, so the server exits when the client that launched it goes away.
+type eofNotifyingReader struct {
+	r      io.Reader     // The wrapped reader
+	closed chan struct{} // Closed on the first read error, including io.EOF
+	once   sync.Once     // Guards closing closed
+}
+
+// Read reads from the wrapped reader, signalling closed on the first error.
+//
+// Parameters:
+//   - p: Buffer to read into
+//
+// Returns:
+//   - int: The number of bytes read
+//   - error: Any error from the wrapped reader
+func (e *eofNotifyingReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil {
+		e.once.Do(func() { close(e.closed) })
+	}
+	return n, err
+}
@@ -6,6 +6,7 @@ package main
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // ParseDefaultLlamaCliEnv parses all LLama.cpp related environment variables
@@ -19,8 +20,12 @@ func ParseDefaultLlamaCliEnv() LlamaCliArgs {
 		ModelCmd:         os.Getenv("ModelCmd"),
 		ModelFullPathVal: os.Getenv("ModelFullPathVal"),
 
+		// Embedding configuration
+		EmbeddingCmd:          getEnvString("EmbeddingCmd", "--embedding"),
+		EmbeddingModelPathVal: os.Getenv("EmbeddingModelPathVal"),
+
 		// Prompt configuration
-		PromptCmd:        os.Getenv("PromptCmd"),
+		PromptCmd:        getEnvString("PromptCmd", "--prompt"),
 		PromptCmdEnabled: getEnvBool(os.Getenv("PromptCmdEnabled"), false),
 		PromptText:       os.Getenv("PromptText"),
 
@@ -42,6 +47,7 @@ func ParseDefaultLlamaCliEnv() LlamaCliArgs {
 		PromptCacheAllCmd: os.Getenv("PromptCacheAllCmd"),
 		PromptCacheCmd:    os.Getenv("PromptCacheCmd"),
 		PromptCacheVal:    os.Getenv("PromptCacheVal"),
+		PromptCacheROCmd:  os.Getenv("PromptCacheROCmd"),
 
 		// File and prompt handling
 		PromptFileCmd:    os.Getenv("PromptFileCmd"),
@@ -53,6 +59,9 @@ func ParseDefaultLlamaCliEnv() LlamaCliArgs {
 		InSuffixCmd:      os.Getenv("InSuffixCmd"),
 		InSuffixVal:      os.Getenv("InSuffixVal"),
 
+		// Stop sequences
+		ReversePromptRepeatable: getEnvBool(os.Getenv("ReversePromptRepeatable"), true),
+
 		// GPU and threading configuration
 		GPULayersCmd:    os.Getenv("GPULayersCmd"),
 		GPULayersVal:    os.Getenv("GPULayersVal"),
@@ -60,6 +69,10 @@ func ParseDefaultLlamaCliEnv() LlamaCliArgs {
 		ThreadsBatchVal: os.Getenv("ThreadsBatchVal"),
 		ThreadsCmd:      os.Getenv("ThreadsCmd"),
 		ThreadsVal:      os.Getenv("ThreadsVal"),
+		CpuMaskCmd:      os.Getenv("CpuMaskCmd"),
+		CpuMaskVal:      os.Getenv("CpuMaskVal"),
+		CpuRangeCmd:     os.Getenv("CpuRangeCmd"),
+		CpuRangeVal:     os.Getenv("CpuRangeVal"),
 
 		// Generation parameters
 		KeepCmd:              os.Getenv("KeepCmd"),
@@ -73,6 +86,36 @@ func ParseDefaultLlamaCliEnv() LlamaCliArgs {
 		RepeatLastPenaltyCmd: os.Getenv("RepeatLastPenaltyCmd"),
 		RepeatLastPenaltyVal: os.Getenv("RepeatLastPenaltyVal"),
 
+		// Token logit bias
+		LogitBiasCmd: os.Getenv("LogitBiasCmd"),
+
+		// Tensor split across GPUs
+		TensorSplitCmd: os.Getenv("TensorSplitCmd"),
+		TensorSplitVal: os.Getenv("TensorSplitVal"),
+
+		// Mirostat sampling
+		MirostatCmd:    os.Getenv("MirostatCmd"),
+		MirostatVal:    os.Getenv("MirostatVal"),
+		MirostatTauCmd: os.Getenv("MirostatTauCmd"),
+		MirostatTauVal: os.Getenv("MirostatTauVal"),
+		MirostatEtaCmd: os.Getenv("MirostatEtaCmd"),
+		MirostatEtaVal: os.Getenv("MirostatEtaVal"),
+
+		// Dynamic temperature
+		DynatempRangeCmd: os.Getenv("DynatempRangeCmd"),
+		DynatempRangeVal: os.Getenv("DynatempRangeVal"),
+		DynatempExpCmd:   os.Getenv("DynatempExpCmd"),
+		DynatempExpVal:   os.Getenv("DynatempExpVal"),
+
+		// Sampler chain
+		SamplersCmd: os.Getenv("SamplersCmd"),
+		SamplersVal: os.Getenv("SamplersVal"),
+
+		// Grammar-constrained output
+		GrammarCmd:     os.Getenv("GrammarCmd"),
+		GrammarFileCmd: os.Getenv("GrammarFileCmd"),
+		JsonSchemaCmd:  os.Getenv("JsonSchemaCmd"),
+
 		// Memory and system configuration
 		MemLockCmd:               os.Getenv("MemLockCmd"),
 		MemLockCmdEnabled:        getEnvBool(os.Getenv("MemLockCmdEnabled"), false),
@@ -96,6 +139,10 @@ func ParseDefaultLlamaCliEnv() LlamaCliArgs {
 		TopPVal:                os.Getenv("TopPVal"),
 		MinPCmd:                os.Getenv("MinPCmd"),
 		MinPVal:                os.Getenv("MinPVal"),
+		TypicalPCmd:            os.Getenv("TypicalPCmd"),
+		TypicalPVal:            os.Getenv("TypicalPVal"),
+		TfsCmd:                 os.Getenv("TfsCmd"),
+		TfsVal:                 os.Getenv("TfsVal"),
 
 		// Logging configuration
 		ModelLogFileCmd:     os.Getenv("ModelLogFileCmd"),
@@ -142,10 +189,172 @@ func ParseDefaultAppEnv() DefaultAppArgs {
 		LLamaCliPath:    os.Getenv("LLamaCliPath"),
 		PromptCachePath: os.Getenv("PromptCachePath"),
 
+		// Log output format
+		LogFormat: getEnvString("LogFormat", LogFormatText),
+
+		// Tokenizer configuration
+		TokenizeCliPath: os.Getenv("TokenizeCliPath"),
+
+		// Embedding configuration
+		EmbeddingCliPath: os.Getenv("EmbeddingCliPath"),
+
+		// Authentication configuration
+		AuthTokensFile: os.Getenv("AuthTokensFile"),
+
 		// Server configuration
+		Transport:      getEnvString("Transport", TransportHTTP),
 		HttpPort:       os.Getenv("HttpPort"),
 		EndPoint:       os.Getenv("EndPoint"),
 		TimeOutSeconds: getEnvInt("TimeOutSeconds", 300),
+
+		// Priority timeout configuration
+		HighPriorityTimeOutSeconds: getEnvInt("HighPriorityTimeOutSeconds", 0),
+		LowPriorityTimeOutSeconds:  getEnvInt("LowPriorityTimeOutSeconds", 0),
+		MaxTimeoutSeconds:          getEnvInt("MaxTimeoutSeconds", 0),
+
+		// Observability configuration
+		MetricsLogIntervalSeconds:   getEnvInt("MetricsLogIntervalSeconds", 0),
+		SlowRequestThresholdSeconds: getEnvInt("SlowRequestThresholdSeconds", 0),
+		DebugErrorDetails:           getEnvBool(os.Getenv("DebugErrorDetails"), false),
+		LogLlamaStderr:              getEnvBool(os.Getenv("LogLlamaStderr"), false),
+
+		// Health endpoint configuration
+		HealthEndpoint:           getEnvString("HealthEndpoint", "/health"),
+		HealthWindowSeconds:      getEnvInt("HealthWindowSeconds", 300),
+		HealthMinRequests:        getEnvInt("HealthMinRequests", 5),
+		HealthDegradedErrorRate:  getEnvFloat("HealthDegradedErrorRate", 0.25),
+		HealthUnhealthyErrorRate: getEnvFloat("HealthUnhealthyErrorRate", 0.5),
+
+		// Readiness endpoint configuration
+		ReadinessEndpoint:              getEnvString("ReadinessEndpoint", "/healthz"),
+		DeepHealthCheck:                getEnvBool(os.Getenv("DeepHealthCheck"), false),
+		DeepHealthCheckIntervalSeconds: getEnvInt("DeepHealthCheckIntervalSeconds", 300),
+
+		// Startup warm-up configuration
+		PreloadModel: getEnvBool(os.Getenv("PreloadModel"), false),
+
+		// Webhook callback configuration
+		CallbackAllowedHosts:   getEnvList("CallbackAllowedHosts"),
+		CallbackMaxRetries:     getEnvInt("CallbackMaxRetries", 3),
+		CallbackRetryBackoffMs: getEnvInt("CallbackRetryBackoffMs", 1000),
+
+		// Model registry configuration
+		ModelRegistryFile:  os.Getenv("ModelRegistryFile"),
+		ModelAliasWarnings: getEnvBool(os.Getenv("ModelAliasWarnings"), true),
+
+		// Concurrency configuration
+		DefaultModelParallelism: getEnvInt("DefaultModelParallelism", 0),
+
+		// Asynchronous job configuration
+		JobTTLSeconds: getEnvInt("JobTTLSeconds", 600),
+
+		// Request history configuration
+		HistorySize:     getEnvInt("HistorySize", 0),
+		HistoryDumpPath: os.Getenv("HistoryDumpPath"),
+
+		// Automatic context sizing
+		AutoContextSize:    getEnvBool(os.Getenv("AutoContextSize"), false),
+		AutoContextSizeMax: getEnvInt("AutoContextSizeMax", 8192),
+
+		// OpenTelemetry tracing configuration
+		OtelEnabled:          getEnvBool(os.Getenv("OtelEnabled"), false),
+		OtelExporterEndpoint: getEnvString("OtelExporterEndpoint", "http://localhost:4318/v1/traces"),
+		OtelExporterHeaders:  parsePromptVariables(os.Getenv("OtelExporterHeaders")),
+		OtelServiceName:      getEnvString("OtelServiceName", "byte-vision-mcp"),
+
+		// Output truncation configuration
+		TruncationMarker: getEnvString("TruncationMarker", "…[truncated]"),
+
+		// Empty output retry configuration
+		EmptyOutputRetries: getEnvInt("EmptyOutputRetries", 0),
+
+		// Transient launch failure retry configuration
+		MaxRetries:     getEnvInt("MaxRetries", 0),
+		RetryBackoffMs: getEnvInt("RetryBackoffMs", 500),
+
+		// Large prompt handling
+		PromptFileThresholdBytes: getEnvInt("PromptFileThresholdBytes", 100*1024),
+
+		// GPU configuration
+		GPUCount: getEnvInt("GPUCount", 0),
+
+		// Oversized prompt splitting
+		SplitWindowTokens:  getEnvInt("SplitWindowTokens", 2048),
+		SplitOverlapTokens: getEnvInt("SplitOverlapTokens", 128),
+
+		// Per-request debug log configuration
+		DebugLogPath:     os.Getenv("DebugLogPath"),
+		DebugLogMaxBytes: int64(getEnvInt("DebugLogMaxBytes", 10*1024*1024)),
+
+		// Stop sequence shortcuts
+		StopOnDoubleNewline: getEnvBool(os.Getenv("StopOnDoubleNewline"), false),
+
+		// Parameter profiling
+		ProfileMaxRuns: getEnvInt("ProfileMaxRuns", 9),
+
+		// Prompt redaction in logs and history
+		RedactionPresets:      getEnvList("RedactionPresets"),
+		RedactionPatternsFile: os.Getenv("RedactionPatternsFile"),
+		RedactionPlaceholder:  getEnvString("RedactionPlaceholder", "[REDACTED]"),
+
+		// Precomputed base KV cache
+		BaseKVCache: os.Getenv("BaseKVCache"),
+
+		// Prometheus metrics endpoint
+		MetricsEndpoint: os.Getenv("MetricsEndpoint"),
+		MetricsPort:     os.Getenv("MetricsPort"),
+
+		// Response cache
+		ResponseCacheSize:         getEnvInt("ResponseCacheSize", 0),
+		ResponseCacheTTLSeconds:   getEnvInt("ResponseCacheTTLSeconds", 3600),
+		ResponseCacheSweepSeconds: getEnvInt("ResponseCacheSweepSeconds", 60),
+		ForceCache:                getEnvBool(os.Getenv("ForceCache"), false),
+
+		// Cost-based admission policy
+		AdmissionMaxCost:      getEnvInt("AdmissionMaxCost", 0),
+		AdmissionBusyLoad:     getEnvInt("AdmissionBusyLoad", 1),
+		AdmissionPolicy:       getEnvString("AdmissionPolicy", AdmissionReject),
+		AdmissionQueueSeconds: getEnvInt("AdmissionQueueSeconds", 60),
+
+		// Server-wide concurrency limit
+		MaxConcurrentRequests: getEnvInt("MaxConcurrentRequests", 1),
+		StreamQueuePosition:   getEnvBool(os.Getenv("StreamQueuePosition"), false),
+
+		// Per-client rate limit
+		RateLimitPerMinute: getEnvInt("RateLimitPerMinute", 0),
+
+		// Cancellation configuration
+		CancelAmbiguousPolicy: getEnvString("CancelAmbiguousPolicy", "error"),
+
+		// Empty output handling
+		EmptyOutputPolicy: getEnvString("EmptyOutputPolicy", "allow"),
+
+		// Prompt variable configuration
+		VariablesEnabled:        getEnvBool(os.Getenv("VariablesEnabled"), false),
+		PromptVariables:         parsePromptVariables(os.Getenv("PromptVariables")),
+		UndefinedVariablePolicy: getEnvString("UndefinedVariablePolicy", "error"),
+
+		// Prompt template configuration
+		PromptTemplatePath: os.Getenv("PromptTemplatePath"),
+
+		// Sampling profile configuration
+		ProfilesPath: os.Getenv("ProfilesPath"),
+
+		// Shared prefix cache configuration
+		SharedPrefixFile: os.Getenv("SharedPrefixFile"),
+
+		// Output formatting configuration
+		SectionMarkers: getEnvListDefault("SectionMarkers", []string{"##"}),
+
+		// Disk space monitoring configuration
+		DiskWarnFreeMB:           getEnvInt("DiskWarnFreeMB", 1024),
+		DiskMinFreeMB:            getEnvInt("DiskMinFreeMB", 256),
+		DiskCheckIntervalSeconds: getEnvInt("DiskCheckIntervalSeconds", 300),
+
+		// Reasoning model configuration
+		ReasoningStartTag:  getEnvString("ReasoningStartTag", "<think>"),
+		ReasoningEndTag:    getEnvString("ReasoningEndTag", "</think>"),
+		ReasoningModelTags: parseReasoningModelTags(os.Getenv("ReasoningModelTags")),
 	}
 	return out
 }
@@ -168,6 +377,73 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+// getEnvFloat parses an environment variable as a float with a fallback value.
+// If the environment variable is empty or cannot be parsed, returns the fallback.
+//
+// Parameters:
+//   - key: The environment variable name to parse
+//   - fallback: The default value to return if parsing fails
+//
+// Returns:
+//   - float64: The parsed float value or fallback
+func getEnvFloat(key string, fallback float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if floatVal, err := strconv.ParseFloat(val, 64); err == nil {
+			return floatVal
+		}
+	}
+	return fallback
+}
+
+// getEnvString returns an environment variable's value, or the fallback if it is empty.
+//
+// Parameters:
+//   - key: The environment variable name to read
+//   - fallback: The default value to return if the variable is empty
+//
+// Returns:
+//   - string: The variable value or fallback
+func getEnvString(key string, fallback string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return fallback
+}
+
+// getEnvList parses a comma-separated environment variable into a slice,
+// trimming whitespace and dropping empty entries.
+//
+// Parameters:
+//   - key: The environment variable name to parse
+//
+// Returns:
+//   - []string: The list entries, or nil if the variable is empty
+func getEnvList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// getEnvListDefault parses a comma-separated environment variable like getEnvList,
+// returning the fallback when the variable is empty.
+//
+// Parameters:
+//   - key: The environment variable name to parse
+//   - fallback: The default list to return if the variable is empty
+//
+// Returns:
+//   - []string: The parsed list or fallback
+func getEnvListDefault(key string, fallback []string) []string {
+	if out := getEnvList(key); out != nil {
+		return out
+	}
+	return fallback
+}
+
 // getEnvBool parses an environment variable as a boolean with a fallback value.
 // Accepts standard boolean representations: "true", "false", "1", "0", etc.
 //
@@ -225,14 +501,16 @@ type LlamaCliArgs struct {
 	PromptCacheAllEnabled bool   `json:"PromptCacheAllEnabled"` // Whether to enable cache all prompts
 	PromptCacheCmd        string `json:"PromptCacheCmd"`        // Command flag for prompt cache (--prompt-cache)
 	PromptCacheVal        string `json:"PromptCacheVal"`        // Prompt cache file path
+	PromptCacheROCmd      string `json:"PromptCacheROCmd"`      // Command flag for read-only prompt cache (--prompt-cache-ro)
 
 	// File input configuration
 	PromptFileCmd string `json:"PromptFileCmd"` // Command flag for prompt file input (--file)
 	PromptFileVal string `json:"PromptFileVal"` // Prompt file path
 
 	// Reverse prompt configuration for interactive mode
-	ReversePromptCmd string `json:"ReversePromptCmd"` // Command flag for reverse prompt (--reverse-prompt)
-	ReversePromptVal string `json:"ReversePromptVal"` // Reverse prompt text
+	ReversePromptCmd        string `json:"ReversePromptCmd"`        // Command flag for reverse prompt (--reverse-prompt)
+	ReversePromptVal        string `json:"ReversePromptVal"`        // Reverse prompt text
+	ReversePromptRepeatable bool   `json:"ReversePromptRepeatable"` // Whether ReversePromptCmd may be repeated; when false only the first stop is passed
 
 	// Input formatting configuration
 	InPrefixCmd string `json:"InPrefixCmd"` // Command flag for input prefix (--in-prefix)
@@ -250,6 +528,12 @@ type LlamaCliArgs struct {
 	ThreadsCmd      string `json:"ThreadsCmd"`      // Command flag for threads (--threads)
 	ThreadsVal      string `json:"ThreadsVal"`      // Number of threads for inference
 
+	// CPU affinity configuration for NUMA / multi-socket systems
+	CpuMaskCmd  string `json:"CpuMaskCmd"`  // Command flag for CPU affinity mask (--cpu-mask)
+	CpuMaskVal  string `json:"CpuMaskVal"`  // Hexadecimal CPU affinity mask
+	CpuRangeCmd string `json:"CpuRangeCmd"` // Command flag for CPU affinity range (--cpu-range)
+	CpuRangeVal string `json:"CpuRangeVal"` // CPU range in lo-hi form
+
 	// Context management configuration
 	KeepCmd string `json:"KeepCmd"` // Command flag for keep tokens (--keep)
 	KeepVal string `json:"KeepVal"` // Number of tokens to keep in context
@@ -262,12 +546,41 @@ type LlamaCliArgs struct {
 	MainGPUCmd string `json:"MainGPUCmd"` // Command flag for main GPU (--main-gpu)
 	MainGPUVal string `json:"MainGPUVal"` // Main GPU index
 
+	TensorSplitCmd string `json:"TensorSplitCmd"` // Command flag for the per-GPU split ratios (--tensor-split)
+	TensorSplitVal string `json:"TensorSplitVal"` // Comma-separated split ratios, e.g. "3,1"
+
 	// Repetition penalty configuration
 	RepeatPenaltyCmd     string `json:"RepeatPenaltyCmd"`     // Command flag for repeat penalty (--repeat-penalty)
 	RepeatPenaltyVal     string `json:"RepeatPenaltyVal"`     // Repeat penalty value
 	RepeatLastPenaltyCmd string `json:"RepeatLastPenaltyCmd"` // Command flag for repeat last n (--repeat-last-n)
 	RepeatLastPenaltyVal string `json:"RepeatLastPenaltyVal"` // Number of last tokens to consider for penalty
 
+	// Token logit bias configuration
+	LogitBiasCmd string `json:"LogitBiasCmd"` // Command flag for a per-token logit bias (--logit-bias), repeated per token
+
+	// Mirostat sampling configuration
+	MirostatCmd    string `json:"MirostatCmd"`    // Command flag for the mirostat mode (--mirostat)
+	MirostatVal    string `json:"MirostatVal"`    // Mirostat mode: 0 off, 1 Mirostat, 2 Mirostat 2.0
+	MirostatTauCmd string `json:"MirostatTauCmd"` // Command flag for the mirostat target entropy (--mirostat-ent)
+	MirostatTauVal string `json:"MirostatTauVal"` // Mirostat target entropy (tau)
+	MirostatEtaCmd string `json:"MirostatEtaCmd"` // Command flag for the mirostat learning rate (--mirostat-lr)
+	MirostatEtaVal string `json:"MirostatEtaVal"` // Mirostat learning rate (eta)
+
+	// Dynamic temperature configuration
+	DynatempRangeCmd string `json:"DynatempRangeCmd"` // Command flag for the dynamic temperature range (--dynatemp-range)
+	DynatempRangeVal string `json:"DynatempRangeVal"` // Dynamic temperature range around the base temperature; 0 disables
+	DynatempExpCmd   string `json:"DynatempExpCmd"`   // Command flag for the dynamic temperature exponent (--dynatemp-exp)
+	DynatempExpVal   string `json:"DynatempExpVal"`   // Dynamic temperature exponent
+
+	// Sampler chain configuration
+	SamplersCmd string `json:"SamplersCmd"` // Command flag for the sampler chain order (--samplers)
+	SamplersVal string `json:"SamplersVal"` // Default sampler chain, names separated by ";"; empty keeps llama.cpp's order
+
+	// Grammar-constrained output
+	GrammarCmd     string `json:"GrammarCmd"`     // Command flag for an inline GBNF grammar (--grammar); empty writes grammars to a temp file
+	GrammarFileCmd string `json:"GrammarFileCmd"` // Command flag for a GBNF grammar file (--grammar-file)
+	JsonSchemaCmd  string `json:"JsonSchemaCmd"`  // Command flag for a JSON schema converted to a grammar (--json-schema)
+
 	// Memory management configuration
 	MemLockCmd        string `json:"MemLockCmd"`        // Command flag for memory lock (--mlock)
 	MemLockCmdEnabled bool   `json:"MemLockCmdEnabled"` // Whether to enable memory locking
@@ -296,6 +609,10 @@ type LlamaCliArgs struct {
 	ModelFullPathVal string `json:"ModelFullPathVal"` // Full path to the model file
 	ModelCmd         string `json:"ModelCmd"`         // Command flag for model (--model)
 
+	// Embedding configuration
+	EmbeddingCmd          string `json:"EmbeddingCmd"`          // Command flag requesting embeddings (--embedding)
+	EmbeddingModelPathVal string `json:"EmbeddingModelPathVal"` // Model used by generate_embedding; empty uses ModelFullPathVal
+
 	// Display configuration
 	NoDisplayPromptCmd     string `json:"NoDisplayPromptCmd"`     // Command flag for no display prompt (--no-display-prompt)
 	NoDisplayPromptEnabled bool   `json:"NoDisplayPromptEnabled"` // Whether to hide prompt in output
@@ -306,6 +623,11 @@ type LlamaCliArgs struct {
 	MinPCmd string `json:"MinPCmd"` // Command flag for min-p sampling (--min-p)
 	MinPVal string `json:"MinPVal"` // Min-p sampling value
 
+	TypicalPCmd string `json:"TypicalPCmd"` // Command flag for locally typical sampling (--typical)
+	TypicalPVal string `json:"TypicalPVal"` // Locally typical sampling value; 1.0 disables
+	TfsCmd      string `json:"TfsCmd"`      // Command flag for tail free sampling (--tfs); empty for builds without it
+	TfsVal      string `json:"TfsVal"`      // Tail free sampling z value; 1.0 disables
+
 	// Model logging configuration
 	ModelLogFileCmd     string `json:"ModelLogFileCmd"`     // Command flag for model log file (--log-file)
 	ModelLogFileNameVal string `json:"ModelLogFileNameVal"` // Model log file path
@@ -368,7 +690,218 @@ type DefaultAppArgs struct {
 	AppLogFileName  string `json:"AppLogFileName"`  // Name of the main application log file
 	PromptCachePath string `json:"PromptCachePath"` // Directory path for prompt cache files
 	LLamaCliPath    string `json:"LlamaCliPath"`    // Full path to the llama-cli executable
+	Transport       string `json:"Transport"`       // MCP transport: "http" (default) or "stdio"
 	HttpPort        string `json:"HttpPort"`        // HTTP port for the MCP server (e.g., ":8080")
 	EndPoint        string `json:"EndPoint"`        // HTTP endpoint path for MCP requests (e.g., "/mcp-completion")
 	TimeOutSeconds  int    `json:"TimeOutSeconds"`  // Timeout in seconds for completion requests
+
+	// Log output format
+	LogFormat string `json:"LogFormat"` // "text" for [APP] lines, "json" for one JSON record per line
+
+	// Priority timeout configuration
+	HighPriorityTimeOutSeconds int `json:"HighPriorityTimeOutSeconds"` // Timeout for priority "high" requests; 0 uses TimeOutSeconds
+	LowPriorityTimeOutSeconds  int `json:"LowPriorityTimeOutSeconds"`  // Timeout for priority "low" requests; 0 uses TimeOutSeconds
+	MaxTimeoutSeconds          int `json:"MaxTimeoutSeconds"`          // Largest timeout_seconds a request may set; 0 caps it at TimeOutSeconds
+
+	// Tokenizer configuration
+	TokenizeCliPath string `json:"TokenizeCliPath"` // Path to llama-tokenize; defaults to llama-tokenize next to llama-cli
+
+	// Embedding configuration
+	EmbeddingCliPath string `json:"EmbeddingCliPath"` // Path to llama-embedding; defaults to llama-embedding next to llama-cli
+
+	// Authentication configuration
+	AuthTokensFile string `json:"AuthTokensFile"` // JSON file of bearer tokens and their model allowlists; empty disables auth
+
+	// Observability configuration
+	MetricsLogIntervalSeconds   int  `json:"MetricsLogIntervalSeconds"`   // Interval between metrics summary log lines; 0 disables
+	SlowRequestThresholdSeconds int  `json:"SlowRequestThresholdSeconds"` // Requests slower than this log a WARN line with their parameters; 0 disables
+	DebugErrorDetails           bool `json:"DebugErrorDetails"`           // Include the failing llama-cli argv and stderr in error responses (exposes the prompt)
+	LogLlamaStderr              bool `json:"LogLlamaStderr"`              // Write the full stderr of failed llama.cpp runs to the app log as DEBUG lines
+
+	// Health endpoint configuration
+	HealthEndpoint           string  `json:"HealthEndpoint"`           // Path of the health endpoint on HttpPort; empty disables it
+	HealthWindowSeconds      int     `json:"HealthWindowSeconds"`      // Length of the rolling window for the error rate
+	HealthMinRequests        int     `json:"HealthMinRequests"`        // Requests needed in the window before the error rate affects health
+	HealthDegradedErrorRate  float64 `json:"HealthDegradedErrorRate"`  // Error rate at or above which health is "degraded"
+	HealthUnhealthyErrorRate float64 `json:"HealthUnhealthyErrorRate"` // Error rate at or above which health is "unhealthy" (HTTP 503)
+
+	// Readiness endpoint configuration
+	ReadinessEndpoint              string `json:"ReadinessEndpoint"`              // Path of the readiness endpoint on HttpPort; empty disables it
+	DeepHealthCheck                bool   `json:"DeepHealthCheck"`                // Also require a one-token completion with the default model to succeed
+	DeepHealthCheckIntervalSeconds int    `json:"DeepHealthCheckIntervalSeconds"` // How often the deep check reruns; 0 runs it only at startup
+
+	// Startup warm-up configuration
+	PreloadModel bool `json:"PreloadModel"` // Run a one-token completion before serving so the model is in the page cache
+
+	// Webhook callback configuration
+	CallbackAllowedHosts   []string `json:"CallbackAllowedHosts"`   // Hosts (or host:port pairs) allowed as callback targets; empty disables callbacks
+	CallbackMaxRetries     int      `json:"CallbackMaxRetries"`     // Number of delivery retries after the first failed attempt
+	CallbackRetryBackoffMs int      `json:"CallbackRetryBackoffMs"` // Initial delay between delivery retries, doubled per attempt
+
+	// Model registry configuration
+	ModelRegistryFile  string `json:"ModelRegistryFile"`  // JSON file mapping model names and deprecated aliases to model files
+	ModelAliasWarnings bool   `json:"ModelAliasWarnings"` // Include alias deprecation warnings in responses (they are always logged)
+
+	// Concurrency configuration
+	DefaultModelParallelism int `json:"DefaultModelParallelism"` // Concurrent requests per model without a registry parallelism; 0 is unlimited
+
+	// Asynchronous job configuration
+	JobTTLSeconds int `json:"JobTTLSeconds"` // How long finished jobs remain available to get_job
+
+	// Request history configuration
+	HistorySize     int    `json:"HistorySize"`     // Recent requests kept for dump_request/replay_request; 0 disables history and the tools
+	HistoryDumpPath string `json:"HistoryDumpPath"` // Directory for request dumps; defaults to AppLogPath/request-dumps
+
+	// Automatic context sizing
+	AutoContextSize    bool `json:"AutoContextSize"`    // Pick the smallest power-of-two ctx-size that fits prompt plus predict
+	AutoContextSizeMax int  `json:"AutoContextSizeMax"` // Upper bound for automatically chosen context sizes
+
+	// OpenTelemetry tracing configuration
+	OtelEnabled          bool              `json:"OtelEnabled"`          // Export a span per completion request
+	OtelExporterEndpoint string            `json:"OtelExporterEndpoint"` // OTLP/HTTP traces URL (JSON encoding)
+	OtelExporterHeaders  map[string]string `json:"OtelExporterHeaders"`  // Extra export headers, parsed from "name=value;name2=value2"
+	OtelServiceName      string            `json:"OtelServiceName"`      // service.name resource attribute
+
+	// Output truncation configuration
+	TruncationMarker string `json:"TruncationMarker"` // Appended to output cut by max_output_chars
+
+	// Empty output retry configuration
+	EmptyOutputRetries int `json:"EmptyOutputRetries"` // Retries with a nudged seed when output is empty; 0 disables
+
+	// Transient launch failure retry configuration
+	MaxRetries     int `json:"MaxRetries"`     // Relaunches after llama-cli fails before producing output; 0 disables
+	RetryBackoffMs int `json:"RetryBackoffMs"` // Delay before the first relaunch, doubled per retry
+
+	// Large prompt handling
+	PromptFileThresholdBytes int `json:"PromptFileThresholdBytes"` // Prompts longer than this go to llama-cli through a temp file; 0 disables
+
+	// GPU configuration
+	GPUCount int `json:"GPUCount"` // Number of GPUs llama-cli can use; tensor_split must have this many ratios; 0 is unknown
+
+	// Oversized prompt splitting
+	SplitWindowTokens  int `json:"SplitWindowTokens"`  // Prompt tokens per window for split_strategy
+	SplitOverlapTokens int `json:"SplitOverlapTokens"` // Tokens shared by consecutive windows
+
+	// Per-request debug log configuration
+	DebugLogPath     string `json:"DebugLogPath"`     // Directory debug_log files are confined to; defaults to AppLogPath/debug
+	DebugLogMaxBytes int64  `json:"DebugLogMaxBytes"` // Size at which a debug log is rotated to "<name>.1"
+
+	// Stop sequence shortcuts
+	StopOnDoubleNewline bool `json:"StopOnDoubleNewline"` // Stop generation at the first blank line unless a request opts out
+
+	// Parameter profiling
+	ProfileMaxRuns int `json:"ProfileMaxRuns"` // Upper bound on generations per profile_parameters call, including the baseline
+
+	// Prompt redaction in logs and history
+	RedactionPresets      []string `json:"RedactionPresets"`      // Built-in patterns: email, ssn, credit_card, api_key
+	RedactionPatternsFile string   `json:"RedactionPatternsFile"` // File with one regular expression per line
+	RedactionPlaceholder  string   `json:"RedactionPlaceholder"`  // Replacement for redacted matches
+
+	// Precomputed base KV cache
+	BaseKVCache string `json:"BaseKVCache"` // Saved KV cache of a fixed prompt prefix, opened read-only by matching requests
+
+	// Prometheus metrics endpoint
+	MetricsEndpoint string `json:"MetricsEndpoint"` // Path of the Prometheus endpoint; empty disables it unless MetricsPort is set
+	MetricsPort     string `json:"MetricsPort"`     // Separate listen address for the endpoint (e.g. :9090); empty serves it on HttpPort
+
+	// Response cache
+	ResponseCacheSize         int  `json:"ResponseCacheSize"`         // Maximum cached completions, least recently used evicted first; 0 disables
+	ResponseCacheTTLSeconds   int  `json:"ResponseCacheTTLSeconds"`   // Maximum age of a cached completion
+	ResponseCacheSweepSeconds int  `json:"ResponseCacheSweepSeconds"` // Interval of the background sweep that evicts expired entries
+	ForceCache                bool `json:"ForceCache"`                // Also cache requests with random sampling (no fixed seed, temperature above 0)
+
+	// Cost-based admission policy
+	AdmissionMaxCost      int    `json:"AdmissionMaxCost"`      // Largest estimated cost (prompt tokens × predict) admitted while busy; 0 disables the policy
+	AdmissionBusyLoad     int    `json:"AdmissionBusyLoad"`     // Running plus waiting requests on a model at which it counts as busy
+	AdmissionPolicy       string `json:"AdmissionPolicy"`       // "reject", "queue" or "downgrade" for requests over AdmissionMaxCost
+	AdmissionQueueSeconds int    `json:"AdmissionQueueSeconds"` // Longest a queued request waits for the model to stop being busy
+
+	// Server-wide concurrency limit
+	MaxConcurrentRequests int  `json:"MaxConcurrentRequests"` // Completions running at once across all models; 0 is unlimited
+	StreamQueuePosition   bool `json:"StreamQueuePosition"`   // Whether streaming requests receive their queue position while waiting for a slot
+
+	// Per-client rate limit
+	RateLimitPerMinute int `json:"RateLimitPerMinute"` // Tool calls per minute per auth token (or client IP without auth); 0 is unlimited
+
+	// Cancellation configuration
+	CancelAmbiguousPolicy string `json:"CancelAmbiguousPolicy"` // "all" cancels every request matching a prompt hash; "error" rejects ambiguous matches
+
+	// Empty output handling
+	EmptyOutputPolicy string `json:"EmptyOutputPolicy"` // "allow" returns empty output as-is; "error" fails the request
+
+	// Prompt variable configuration
+	VariablesEnabled        bool              `json:"VariablesEnabled"`        // Substitute {{name}} placeholders in prompts with server-side values
+	PromptVariables         map[string]string `json:"PromptVariables"`         // Configured variables; override the built-in date, datetime and hostname
+	UndefinedVariablePolicy string            `json:"UndefinedVariablePolicy"` // "error" rejects prompts using undefined variables; "keep" leaves them as-is
+
+	// Prompt template configuration
+	PromptTemplatePath string `json:"PromptTemplatePath"` // Directory of Go text/template *.tmpl files requests can name in template
+
+	// Sampling profile configuration
+	ProfilesPath string `json:"ProfilesPath"` // JSON file of named model and sampling presets requests can name in profile
+
+	// Shared prefix cache configuration
+	SharedPrefixFile string `json:"SharedPrefixFile"` // File holding a system prefix shared by many prompts, cached once under PromptCachePath
+
+	// Output formatting configuration
+	SectionMarkers []string `json:"SectionMarkers"` // Line prefixes that start a new section for output_sections
+
+	// Disk space monitoring configuration
+	DiskWarnFreeMB           int `json:"DiskWarnFreeMB"`           // Free space (MB) below which a low-disk warning is logged
+	DiskMinFreeMB            int `json:"DiskMinFreeMB"`            // Free space (MB) below which prompt cache writes are disabled
+	DiskCheckIntervalSeconds int `json:"DiskCheckIntervalSeconds"` // Interval between periodic disk checks; 0 checks only at startup
+
+	// Reasoning model configuration
+	ReasoningStartTag  string          `json:"ReasoningStartTag"`  // Default tag opening a reasoning block (e.g., "<think>")
+	ReasoningEndTag    string          `json:"ReasoningEndTag"`    // Default tag closing a reasoning block (e.g., "</think>")
+	ReasoningModelTags []ReasoningTags `json:"ReasoningModelTags"` // Per-model tag overrides, matched by model file name
+}
+
+// parsePromptVariables parses prompt variables in the form "name=value;name2=value2".
+// Entries without a name are skipped; values may contain "=".
+//
+// Parameters:
+//   - value: The raw PromptVariables environment value
+//
+// Returns:
+//   - map[string]string: The parsed variables
+func parsePromptVariables(value string) map[string]string {
+	out := make(map[string]string)
+	for _, entry := range strings.Split(value, ";") {
+		name, val, found := strings.Cut(entry, "=")
+		if name = strings.TrimSpace(name); !found || name == "" {
+			continue
+		}
+		out[name] = strings.TrimSpace(val)
+	}
+	return out
+}
+
+// ReasoningTags overrides the reasoning delimiter tags for models whose file name
+// contains the given fragment.
+type ReasoningTags struct {
+	Model string `json:"Model"` // Model file name fragment to match (case-insensitive)
+	Start string `json:"Start"` // Tag opening the reasoning block
+	End   string `json:"End"`   // Tag closing the reasoning block
+}
+
+// parseReasoningModelTags parses per-model reasoning tags in the form
+// "fragment=start|end;fragment2=start|end". Malformed entries are skipped.
+//
+// Parameters:
+//   - value: The raw ReasoningModelTags environment value
+//
+// Returns:
+//   - []ReasoningTags: The parsed overrides in configuration order
+func parseReasoningModelTags(value string) []ReasoningTags {
+	var out []ReasoningTags
+	for _, entry := range strings.Split(value, ";") {
+		model, tags, found := strings.Cut(strings.TrimSpace(entry), "=")
+		start, end, hasEnd := strings.Cut(tags, "|")
+		if !found || !hasEnd || model == "" || start == "" || end == "" {
+			continue
+		}
+		out = append(out, ReasoningTags{Model: model, Start: start, End: end})
+	}
+	return out
 }
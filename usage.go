@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// LlamaPerfStats holds the performance statistics llama-cli prints to stderr after generation
+type LlamaPerfStats struct {
+	PromptTokens     int     // Prompt tokens evaluated (excludes tokens reused from a prompt cache)
+	CompletionTokens int     // Tokens generated
+	PromptEvalMs     float64 // Time spent evaluating the prompt
+	EvalMs           float64 // Time spent generating
+}
+
+// Usage reports token usage in the shape of OpenAI's usage object
+type Usage struct {
+	PromptTokens     int  `json:"prompt_tokens"`       // Tokens in the prompt as sent to the model
+	CompletionTokens int  `json:"completion_tokens"`   // Tokens generated
+	TotalTokens      int  `json:"total_tokens"`        // Sum of prompt and completion tokens
+	Estimated        bool `json:"estimated,omitempty"` // Set when a count had to be approximated
+}
+
+// CompletionMetadata is the request metadata block returned with include_metadata
+type CompletionMetadata struct {
+	RequestID        string `json:"request_id"`        // Id of the request in server logs and for cancel_completion
+	DurationMs       int64  `json:"duration_ms"`       // Wall-clock time from receiving the request to responding
+	PromptTokens     int    `json:"prompt_tokens"`     // Approximate tokens in the prompt
+	CompletionTokens int    `json:"completion_tokens"` // Approximate tokens generated
+	Model            string `json:"model"`             // Model file the completion ran with
+	TimedOut         bool   `json:"timed_out"`         // Whether the request hit its timeout
+}
+
+// Patterns for llama.cpp's perf summary, e.g.
+//
+//	llama_perf_context_print: prompt eval time =     120.50 ms /    24 tokens (...)
+//	llama_perf_context_print:        eval time =    2310.20 ms /    63 runs   (...)
+var (
+	promptEvalStatsPattern = regexp.MustCompile(`prompt eval time\s*=\s*([\d.]+) ms /\s*(\d+) tokens`)
+	evalStatsPattern       = regexp.MustCompile(`(?m):\s+eval time\s*=\s*([\d.]+) ms /\s*(\d+) (?:runs|tokens)`)
+)
+
+// parsePerfStats extracts prompt and generation statistics from llama-cli stderr.
+//
+// Parameters:
+//   - stderr: The captured standard error of a completed run
+//
+// Returns:
+//   - LlamaPerfStats: The parsed statistics
+//   - bool: Whether the generation statistics were found
+func parsePerfStats(stderr string) (LlamaPerfStats, bool) {
+	var stats LlamaPerfStats
+	if m := promptEvalStatsPattern.FindStringSubmatch(stderr); m != nil {
+		stats.PromptEvalMs, _ = strconv.ParseFloat(m[1], 64)
+		stats.PromptTokens, _ = strconv.Atoi(m[2])
+	}
+
+	m := evalStatsPattern.FindStringSubmatch(stderr)
+	if m == nil {
+		return stats, false
+	}
+	stats.EvalMs, _ = strconv.ParseFloat(m[1], 64)
+	stats.CompletionTokens, _ = strconv.Atoi(m[2])
+	return stats, true
+}
+
+// completionTokens returns the number of generated tokens for metrics and usage,
+// preferring llama-cli's own count over the character-based estimate.
+//
+// Parameters:
+//   - result: The completion result
+//
+// Returns:
+//   - int: The generated token count
+//   - bool: Whether the count is an estimate
+func completionTokens(result CompletionResult) (int, bool) {
+	if result.Stats.CompletionTokens > 0 {
+		return result.Stats.CompletionTokens, false
+	}
+	return estimateTokens(string(result.Output)), true
+}
+
+// computeUsage builds the usage block for a completion. Prompt tokens come from a
+// llama-tokenize pass over the final prompt, since llama-cli's prompt statistics
+// exclude tokens served from a prompt cache; the statistics are only used as a
+// fallback (e.g., for prompt_file requests or when tokenization fails).
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - arguments: The transformed completion request
+//   - result: The completion result
+//
+// Returns:
+//   - Usage: The token usage
+func computeUsage(ctx context.Context, arguments CompletionArguments, result CompletionResult) Usage {
+	var usage Usage
+	usage.CompletionTokens, usage.Estimated = completionTokens(result)
+
+	usage.PromptTokens = result.Stats.PromptTokens
+	if arguments.PromptFile == "" {
+		tokens, err := tokenize(ctx, CountTokensArguments{Prompt: arguments.Prompt + arguments.AssistantPrefix, Model: arguments.Model})
+		if err == nil {
+			usage.PromptTokens = len(tokens)
+		} else {
+			logger.Printf("Warning: prompt tokenization for usage failed, using llama-cli statistics: %v", err)
+			usage.Estimated = true
+		}
+	}
+
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// completionMetadata builds the include_metadata block. Token counts are cheap
+// approximations: the usage block's counts when include_usage ran the tokenizer,
+// otherwise the character-based estimate for the prompt and llama-cli's count for
+// the output.
+//
+// Parameters:
+//   - arguments: The completion request
+//   - result: The completion result, empty when the request failed
+//   - duration: Time since the request was received
+//   - timedOut: Whether the request hit its timeout
+//
+// Returns:
+//   - CompletionMetadata: The metadata block
+func completionMetadata(arguments CompletionArguments, result CompletionResult, duration time.Duration, timedOut bool) CompletionMetadata {
+	metadata := CompletionMetadata{
+		RequestID:    arguments.RequestID,
+		DurationMs:   duration.Milliseconds(),
+		PromptTokens: estimateTokens(arguments.Prompt + arguments.AssistantPrefix),
+		Model:        filepath.Base(effectiveModel(arguments)),
+		TimedOut:     timedOut,
+	}
+	if len(result.Output) > 0 {
+		metadata.CompletionTokens, _ = completionTokens(result)
+	}
+	if result.Usage != nil {
+		metadata.PromptTokens, metadata.CompletionTokens = result.Usage.PromptTokens, result.Usage.CompletionTokens
+	}
+	return metadata
+}
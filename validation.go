@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// cpuMaskPattern matches a hexadecimal CPU affinity mask with an optional 0x prefix
+var cpuMaskPattern = regexp.MustCompile(`^(0[xX])?[0-9a-fA-F]+$`)
+
+// validateCpuMask checks that a CPU affinity mask is in the hexadecimal format
+// accepted by llama.cpp's --cpu-mask flag (e.g., "0xFF" or "ff00").
+//
+// Parameters:
+//   - mask: The CPU mask to validate
+//
+// Returns:
+//   - error: A descriptive error if the mask is malformed
+func validateCpuMask(mask string) error {
+	if !cpuMaskPattern.MatchString(mask) {
+		return fmt.Errorf("invalid cpu_mask %q: must be a hexadecimal mask such as 0xFF", mask)
+	}
+	return nil
+}
+
+// cpuRangePattern matches a CPU range of two non-negative integers in lo-hi form
+var cpuRangePattern = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// validateCpuRange checks that a CPU range is in the "lo-hi" format accepted by
+// llama.cpp's --cpu-range flag, with non-negative bounds, lo <= hi and no spaces,
+// since the value is passed to llama-cli as-is.
+//
+// Parameters:
+//   - cpuRange: The CPU range to validate
+//
+// Returns:
+//   - error: A descriptive error if the range is malformed
+func validateCpuRange(cpuRange string) error {
+	if !cpuRangePattern.MatchString(cpuRange) {
+		return fmt.Errorf("invalid cpu_range %q: must be in lo-hi format such as 0-7", cpuRange)
+	}
+
+	lo, hi, _ := strings.Cut(cpuRange, "-")
+	loVal, loErr := strconv.Atoi(lo)
+	hiVal, hiErr := strconv.Atoi(hi)
+	if loErr != nil || hiErr != nil {
+		return fmt.Errorf("invalid cpu_range %q: bounds must be non-negative integers", cpuRange)
+	}
+	if loVal > hiVal {
+		return fmt.Errorf("invalid cpu_range %q: lower bound exceeds upper bound", cpuRange)
+	}
+	return nil
+}
+
+// validateSplitMode checks that a multi-GPU split mode is one accepted by llama.cpp's
+// --split-mode flag.
+//
+// Parameters:
+//   - mode: The split mode to validate
+//
+// Returns:
+//   - error: A descriptive error if the mode is unknown
+func validateSplitMode(mode string) error {
+	switch mode {
+	case "none", "layer", "row":
+		return nil
+	}
+	return fmt.Errorf("invalid split_mode %q: must be none, layer or row", mode)
+}
+
+// validateRopeScaling checks that a RoPE scaling type is one accepted by llama.cpp's
+// --rope-scaling flag.
+//
+// Parameters:
+//   - scaling: The RoPE scaling type to validate
+//
+// Returns:
+//   - error: A descriptive error if the type is unknown
+func validateRopeScaling(scaling string) error {
+	switch scaling {
+	case "none", "linear", "yarn":
+		return nil
+	}
+	return fmt.Errorf("invalid rope_scaling %q: must be none, linear or yarn", scaling)
+}
+
+// validateDynatemp checks a dynamic temperature range and exponent; zero for either
+// means the configured default.
+//
+// Parameters:
+//   - rangeVal: The temperature range around the base temperature
+//   - exponent: The exponent applied to the normalized entropy
+//
+// Returns:
+//   - error: A descriptive error if the range or exponent is negative
+func validateDynatemp(rangeVal, exponent float64) error {
+	if rangeVal < 0 || math.IsInf(rangeVal, 0) {
+		return fmt.Errorf("invalid dynatemp_range %g: must be 0 (off) or a positive number", rangeVal)
+	}
+	if exponent < 0 || math.IsInf(exponent, 0) {
+		return fmt.Errorf("invalid dynatemp_exp %g: must be a positive number", exponent)
+	}
+	return nil
+}
+
+// validateMirostat checks a mirostat mode and, when it enables mirostat, its target
+// entropy and learning rate; a zero tau or eta means the configured default.
+//
+// Parameters:
+//   - mode: The mirostat mode: 0 off, 1 Mirostat, 2 Mirostat 2.0
+//   - tau: The target entropy
+//   - eta: The learning rate
+//
+// Returns:
+//   - error: A descriptive error if the mode is unknown or tau or eta is negative
+func validateMirostat(mode int, tau, eta float64) error {
+	if mode < 0 || mode > 2 {
+		return fmt.Errorf("invalid mirostat %d: must be 0 (off), 1 or 2", mode)
+	}
+	if tau < 0 || math.IsInf(tau, 0) {
+		return fmt.Errorf("invalid mirostat_tau %g: must be a positive number", tau)
+	}
+	if eta < 0 || math.IsInf(eta, 0) {
+		return fmt.Errorf("invalid mirostat_eta %g: must be a positive number", eta)
+	}
+	return nil
+}
+
+// Sampler names llama.cpp's --samplers accepts: the canonical names, then aliases and
+// tfs_z from builds that still ship tail-free sampling
+var (
+	samplerNames   = []string{"penalties", "dry", "top_n_sigma", "top_k", "typ_p", "top_p", "min_p", "xtc", "temperature", "infill"}
+	samplerAliases = []string{"top-k", "top-p", "nucleus", "typical_p", "typical-p", "typical", "typ-p", "typ", "min-p", "temp", "tfs_z"}
+)
+
+// validateSamplers checks that every name in a sampler chain is a sampler llama.cpp
+// knows.
+//
+// Parameters:
+//   - samplers: The sampler chain, first applied first
+//
+// Returns:
+//   - error: A descriptive error listing every unknown name
+func validateSamplers(samplers []string) error {
+	var invalid []string
+	for _, name := range samplers {
+		if !slices.Contains(samplerNames, name) && !slices.Contains(samplerAliases, name) {
+			invalid = append(invalid, fmt.Sprintf("%q", name))
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid samplers %s: must be among %s", strings.Join(invalid, ", "), strings.Join(samplerNames, ", "))
+	}
+	return nil
+}
+
+// parseSamplers splits a configured sampler chain such as "top_k;top_p;temperature",
+// accepting ";" or "," between names.
+//
+// Parameters:
+//   - value: The configured chain
+//
+// Returns:
+//   - []string: The sampler names, empty for an empty value
+func parseSamplers(value string) []string {
+	var samplers []string
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == ',' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			samplers = append(samplers, name)
+		}
+	}
+	return samplers
+}
+
+// validateTensorSplit checks per-GPU tensor split ratios: each must be a finite,
+// non-negative number, at least one must be positive, and with GPUCount set there
+// must be one ratio per GPU.
+//
+// Parameters:
+//   - ratios: The split ratios, one per GPU
+//
+// Returns:
+//   - error: A descriptive error if the ratios are unusable
+func validateTensorSplit(ratios []float64) error {
+	if appArgs.GPUCount > 0 && len(ratios) != appArgs.GPUCount {
+		return fmt.Errorf("invalid tensor_split: %d ratios given for %d GPUs", len(ratios), appArgs.GPUCount)
+	}
+	total := 0.0
+	for _, ratio := range ratios {
+		if math.IsNaN(ratio) || math.IsInf(ratio, 0) || ratio < 0 {
+			return fmt.Errorf("invalid tensor_split: ratio %g must be a non-negative number", ratio)
+		}
+		total += ratio
+	}
+	if total <= 0 {
+		return fmt.Errorf("invalid tensor_split: at least one ratio must be positive")
+	}
+	return nil
+}
+
+// parseTensorSplit parses a comma-separated tensor split such as "3,1".
+//
+// Parameters:
+//   - value: The configured split ratios
+//
+// Returns:
+//   - []float64: The ratios, one per GPU
+//   - error: An error if a ratio is not a number
+func parseTensorSplit(value string) ([]float64, error) {
+	var ratios []float64
+	for _, field := range strings.Split(value, ",") {
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tensor split %q: %q is not a number", value, field)
+		}
+		ratios = append(ratios, ratio)
+	}
+	return ratios, nil
+}
+
+// formatTensorSplit renders split ratios in the comma-separated form --tensor-split expects.
+//
+// Parameters:
+//   - ratios: The split ratios, one per GPU
+//
+// Returns:
+//   - string: The ratios joined with commas, e.g. "3,1"
+func formatTensorSplit(ratios []float64) string {
+	fields := make([]string, len(ratios))
+	for i, ratio := range ratios {
+		fields[i] = strconv.FormatFloat(ratio, 'g', -1, 64)
+	}
+	return strings.Join(fields, ",")
+}
+
+// validatePriority checks that a request priority is one of the supported levels.
+//
+// Parameters:
+//   - priority: The requested priority; empty means normal
+//
+// Returns:
+//   - error: A descriptive error if the priority is unknown
+func validatePriority(priority string) error {
+	switch priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return nil
+	}
+	return fmt.Errorf("invalid priority %q: must be high, normal or low", priority)
+}
+
+// validateTimeout checks a request's timeout_seconds override against the server cap:
+// MaxTimeoutSeconds, or TimeOutSeconds when no cap is configured.
+//
+// Parameters:
+//   - timeoutSeconds: The requested timeout; 0 means the server default
+//
+// Returns:
+//   - error: A descriptive error if the timeout is negative or exceeds the cap
+func validateTimeout(timeoutSeconds int) error {
+	if timeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds must not be negative, got %d", timeoutSeconds)
+	}
+	maxTimeout := appArgs.MaxTimeoutSeconds
+	if maxTimeout <= 0 {
+		maxTimeout = completionTimeoutSeconds(PriorityNormal)
+	}
+	if timeoutSeconds > maxTimeout {
+		return fmt.Errorf("timeout_seconds %d exceeds the server maximum of %d seconds", timeoutSeconds, maxTimeout)
+	}
+	return nil
+}
+
+// ValidateConfig checks the parsed configuration for problems that would otherwise only
+// surface as confusing failures once llama-cli is invoked. Every problem is collected so
+// the user can fix them all at once.
+//
+// Parameters:
+//   - appArgs: The parsed application configuration
+//   - llamaCliArgs: The parsed llama.cpp configuration
+//
+// Returns:
+//   - error: A multi-line error listing every problem, or nil when the configuration is usable
+func ValidateConfig(appArgs DefaultAppArgs, llamaCliArgs LlamaCliArgs) error {
+	var problems []string
+	if err := checkExecutable(appArgs.LLamaCliPath); err != nil {
+		problems = append(problems, fmt.Sprintf("LLamaCliPath: %v (set it to the llama-cli executable)", err))
+	}
+	if llamaCliArgs.ModelFullPathVal == "" {
+		problems = append(problems, "ModelFullPathVal: not configured (set it to the default GGUF model file)")
+	}
+	if appArgs.TimeOutSeconds <= 0 {
+		problems = append(problems, fmt.Sprintf("TimeOutSeconds: must be positive, got %d", appArgs.TimeOutSeconds))
+	}
+	if appArgs.MaxTimeoutSeconds < 0 {
+		problems = append(problems, fmt.Sprintf("MaxTimeoutSeconds: must not be negative, got %d", appArgs.MaxTimeoutSeconds))
+	}
+	if appArgs.MaxRetries < 0 {
+		problems = append(problems, fmt.Sprintf("MaxRetries: must not be negative, got %d", appArgs.MaxRetries))
+	}
+	if appArgs.RetryBackoffMs < 0 {
+		problems = append(problems, fmt.Sprintf("RetryBackoffMs: must not be negative, got %d", appArgs.RetryBackoffMs))
+	}
+	if appArgs.LogFormat != LogFormatText && appArgs.LogFormat != LogFormatJSON {
+		problems = append(problems, fmt.Sprintf("LogFormat: must be %q or %q, got %q", LogFormatText, LogFormatJSON, appArgs.LogFormat))
+	}
+	if appArgs.RateLimitPerMinute < 0 {
+		problems = append(problems, fmt.Sprintf("RateLimitPerMinute: must not be negative, got %d", appArgs.RateLimitPerMinute))
+	}
+	if err := validateSamplers(parseSamplers(llamaCliArgs.SamplersVal)); err != nil {
+		problems = append(problems, fmt.Sprintf("SamplersVal: %v", err))
+	}
+	if llamaCliArgs.TensorSplitVal != "" {
+		ratios, err := parseTensorSplit(llamaCliArgs.TensorSplitVal)
+		if err == nil {
+			err = validateTensorSplit(ratios)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("TensorSplitVal: %v", err))
+		}
+	}
+
+	switch appArgs.Transport {
+	case TransportHTTP:
+		if _, port, err := net.SplitHostPort(appArgs.HttpPort); err != nil {
+			problems = append(problems, fmt.Sprintf("HttpPort: %q is not a listen address such as :8080", appArgs.HttpPort))
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			problems = append(problems, fmt.Sprintf("HttpPort: %q does not have a port between 1 and 65535", appArgs.HttpPort))
+		}
+	case TransportStdio:
+	default:
+		problems = append(problems, fmt.Sprintf("Transport: must be %q or %q, got %q", TransportHTTP, TransportStdio, appArgs.Transport))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration in %s:\n  - %s", DefaultConfigFile, strings.Join(problems, "\n  - "))
+}
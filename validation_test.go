@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestValidateCpuMask(t *testing.T) {
+	tests := []struct {
+		name    string
+		mask    string
+		wantErr bool
+	}{
+		{name: "prefixed", mask: "0xFF"},
+		{name: "upper prefix", mask: "0X0f"},
+		{name: "bare hex", mask: "ff00"},
+		{name: "single digit", mask: "1"},
+		{name: "empty", mask: "", wantErr: true},
+		{name: "prefix only", mask: "0x", wantErr: true},
+		{name: "not hex", mask: "0xZZ", wantErr: true},
+		{name: "leading space", mask: " 0xff", wantErr: true},
+		{name: "trailing space", mask: "0xff ", wantErr: true},
+		{name: "negative", mask: "-1", wantErr: true},
+		{name: "extra argument", mask: "0xff --prompt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCpuMask(tt.mask); (err != nil) != tt.wantErr {
+				t.Errorf("validateCpuMask(%q) error = %v, wantErr %v", tt.mask, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCpuRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		cpuRange string
+		wantErr  bool
+	}{
+		{name: "range", cpuRange: "0-7"},
+		{name: "single cpu", cpuRange: "3-3"},
+		{name: "multi digit", cpuRange: "16-31"},
+		{name: "empty", cpuRange: "", wantErr: true},
+		{name: "no separator", cpuRange: "7", wantErr: true},
+		{name: "missing lower", cpuRange: "-7", wantErr: true},
+		{name: "missing upper", cpuRange: "0-", wantErr: true},
+		{name: "reversed", cpuRange: "7-0", wantErr: true},
+		{name: "negative", cpuRange: "-1-7", wantErr: true},
+		{name: "signed", cpuRange: "+0-7", wantErr: true},
+		{name: "surrounding spaces", cpuRange: " 0-7 ", wantErr: true},
+		{name: "inner spaces", cpuRange: "0 - 7", wantErr: true},
+		{name: "three parts", cpuRange: "0-3-7", wantErr: true},
+		{name: "not a number", cpuRange: "a-b", wantErr: true},
+		{name: "overflow", cpuRange: "0-99999999999999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCpuRange(tt.cpuRange); (err != nil) != tt.wantErr {
+				t.Errorf("validateCpuRange(%q) error = %v, wantErr %v", tt.cpuRange, err, tt.wantErr)
+			}
+		})
+	}
+}
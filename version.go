@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionProbeTimeout bounds how long the llama-cli version probe may run
+const VersionProbeTimeout = 10 * time.Second
+
+// LlamaVersion describes the llama.cpp build reported by `llama-cli --version`
+type LlamaVersion struct {
+	Build  string `json:"build"`           // Build number reported by llama.cpp (e.g., "5581")
+	Commit string `json:"commit"`          // Short commit hash the binary was built from
+	Raw    string `json:"raw"`             // First line of the unparsed version output
+	Error  string `json:"error,omitempty"` // Reason the version could not be determined, if any
+}
+
+// String formats the version for log lines and tool responses
+func (v LlamaVersion) String() string {
+	if v.Build == "" {
+		return "unknown"
+	}
+	if v.Commit == "" {
+		return v.Build
+	}
+	return fmt.Sprintf("%s (%s)", v.Build, v.Commit)
+}
+
+var (
+	llamaVersion     LlamaVersion // Cached llama.cpp version, populated once per process
+	llamaVersionOnce sync.Once    // Guards the one-time version probe
+)
+
+// llamaVersionPattern matches llama.cpp's "version: 5581 (71e74a3a)" banner line
+var llamaVersionPattern = regexp.MustCompile(`version:\s*(\S+)(?:\s*\(([0-9a-fA-F]+)\))?`)
+
+// GetLlamaVersion returns the llama.cpp version of the configured llama-cli binary.
+// The binary is only probed on the first call; subsequent calls return the cached result.
+//
+// Parameters:
+//   - appArgs: Application configuration containing the path to llama-cli
+//
+// Returns:
+//   - LlamaVersion: The parsed version, with Error set if it could not be determined
+func GetLlamaVersion(appArgs DefaultAppArgs) LlamaVersion {
+	llamaVersionOnce.Do(func() {
+		llamaVersion = probeLlamaVersion(appArgs.LLamaCliPath)
+	})
+	return llamaVersion
+}
+
+// probeLlamaVersion runs `llama-cli --version` and parses its output.
+// Older builds that don't support the flag are reported through the Error field
+// rather than failing startup.
+//
+// Parameters:
+//   - cliPath: Full path to the llama-cli executable
+//
+// Returns:
+//   - LlamaVersion: The parsed version information
+func probeLlamaVersion(cliPath string) LlamaVersion {
+	if cliPath == "" {
+		return LlamaVersion{Error: "LLamaCliPath is not configured"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), VersionProbeTimeout)
+	defer cancel()
+
+	// llama.cpp prints its version banner to stderr, so capture both streams
+	out, err := exec.CommandContext(ctx, cliPath, "--version").CombinedOutput()
+	version := parseLlamaVersion(string(out))
+	if version.Build == "" {
+		if err != nil {
+			version.Error = fmt.Sprintf("version probe failed: %v", err)
+		} else {
+			version.Error = "version output not recognized"
+		}
+	}
+	return version
+}
+
+// parseLlamaVersion extracts the build number and commit hash from llama.cpp's version output.
+//
+// Parameters:
+//   - output: Combined stdout/stderr of `llama-cli --version`
+//
+// Returns:
+//   - LlamaVersion: The parsed version; Build is empty if no version line was found
+func parseLlamaVersion(output string) LlamaVersion {
+	var version LlamaVersion
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if match := llamaVersionPattern.FindStringSubmatch(line); match != nil {
+			version.Build = match[1]
+			version.Commit = match[2]
+			version.Raw = line
+			break
+		}
+	}
+	return version
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// warmUpPrompt is the prompt of the startup warm-up completion
+const warmUpPrompt = "Hello"
+
+// preloadModel runs a one-token completion with the default model when PreloadModel is
+// set, so the model file is in the OS page cache (and the prompt cache, with
+// PromptCacheCmd, is written) before the first request. A failure is only logged; the
+// server starts either way.
+//
+// Parameters:
+//   - ctx: Context whose cancellation aborts the warm-up
+func preloadModel(ctx context.Context) {
+	if !appArgs.PreloadModel {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(completionTimeoutSeconds(PriorityNormal))*time.Second)
+	defer cancel()
+
+	logger.Printf("Warming up model %s...", llamaCliArgs.ModelFullPathVal)
+	start := time.Now()
+	err := func() error {
+		args, _, err := prepareLlamaArgs(CompletionArguments{Prompt: warmUpPrompt, Predict: 1})
+		if err != nil {
+			return err
+		}
+		releaseSlot, err := acquireModelSlot(ctx, llamaCliArgs.ModelFullPathVal, completionTimeoutSeconds(PriorityNormal))
+		if err != nil {
+			return err
+		}
+		defer releaseSlot()
+		_, _, err = runLlamaCommand(ctx, appArgs, args, nil)
+		return err
+	}()
+	if err != nil {
+		logger.Printf("Warning: model warm-up failed after %v, starting anyway: %v", time.Since(start).Round(time.Millisecond), err)
+		return
+	}
+	logger.Printf("Model warm-up finished in %v", time.Since(start).Round(time.Millisecond))
+}
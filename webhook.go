@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	mcpgolang "github.com/metoro-io/mcp-golang"
+)
+
+// CallbackRequestTimeout bounds a single webhook delivery attempt
+const CallbackRequestTimeout = 30 * time.Second
+
+// CallbackPayload is the JSON document POSTed to a client's callback URL
+type CallbackPayload struct {
+	JobID     string `json:"job_id"`           // Identifier returned to the client when the job was accepted
+	RequestID string `json:"request_id"`       // The request's id, as sent by the client or generated for it
+	Status    string `json:"status"`           // "completed", "failed" or "canceled"
+	Event     string `json:"event"`            // Terminal event: "done", "error" or "cancelled"
+	Output    string `json:"output,omitempty"` // Completion text on success, post-processed like a synchronous response
+	Error     string `json:"error,omitempty"`  // Failure description when Status is "failed"
+
+	Warnings []string `json:"warnings,omitempty"` // Non-fatal warnings raised for the request
+	Usage    *Usage   `json:"usage,omitempty"`    // Token usage, when requested with include_usage
+}
+
+// callbackMaxRedirects bounds the redirects followed by one webhook delivery
+const callbackMaxRedirects = 10
+
+// callbackClient is shared by all webhook deliveries. Redirects are followed only to
+// hosts CallbackAllowedHosts permits, so an allowed host cannot bounce a delivery elsewhere.
+var callbackClient = &http.Client{Timeout: CallbackRequestTimeout, CheckRedirect: checkCallbackRedirect}
+
+// checkCallbackRedirect vets each redirect of a webhook delivery like the original URL.
+//
+// Parameters:
+//   - req: The redirected request about to be sent
+//   - via: The requests made so far, oldest first
+//
+// Returns:
+//   - error: An error stopping the delivery if the target is not allowed or there were too many redirects
+func checkCallbackRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= callbackMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", callbackMaxRedirects)
+	}
+	if err := validateCallbackURL(req.URL.String()); err != nil {
+		return fmt.Errorf("refusing callback redirect: %w", err)
+	}
+	return nil
+}
+
+// startCallbackJob validates the callback URL, starts the completion as a background
+// job, and immediately returns the job id to the client. The result is delivered to
+// the callback URL once generation finishes; the job can also be polled with get_job.
+//
+// Parameters:
+//   - arguments: The completion request, including the callback URL
+//   - owner: The auth token name that may cancel the job (see requestOwner)
+//
+// Returns:
+//   - *mcpgolang.ToolResponse: The accepted job id, or an error if the URL is not allowed
+//   - bool: Whether the job was accepted and will record its own metrics
+func startCallbackJob(arguments CompletionArguments, owner string) (*mcpgolang.ToolResponse, bool) {
+	if err := validateCallbackURL(arguments.CallbackURL); err != nil {
+		logger.Printf("Rejected callback URL: %v", err)
+		return &mcpgolang.ToolResponse{
+			Content: []*mcpgolang.Content{
+				mcpgolang.NewTextContent(fmt.Sprintf("Error: %v", err)),
+			},
+		}, false
+	}
+
+	jobID := startJob(arguments, owner, func(status JobStatus) {
+		payload := CallbackPayload{JobID: status.JobID, RequestID: status.RequestID, Status: status.Status, Event: status.Event, Error: status.Error, Warnings: status.Warnings}
+		if status.Status == JobStatusCompleted {
+			payload.Output = status.Result
+			payload.Usage = status.Usage
+		}
+		if err := deliverCallback(arguments.CallbackURL, payload); err != nil {
+			logger.Printf("Callback delivery for job %s failed: %v", status.JobID, err)
+		}
+	})
+	logger.Printf("Accepted callback job %s", jobID)
+
+	return jobAcceptedResponse(jobID, arguments.RequestID), true
+}
+
+// validateCallbackURL checks that a callback URL is an absolute http(s) URL whose
+// host appears in the CallbackAllowedHosts allowlist. Callbacks are disabled when
+// the allowlist is empty.
+//
+// Parameters:
+//   - rawURL: The client-supplied callback URL
+//
+// Returns:
+//   - error: A descriptive error if the URL may not be used
+func validateCallbackURL(rawURL string) error {
+	if len(appArgs.CallbackAllowedHosts) == 0 {
+		return fmt.Errorf("callbacks are disabled: no CallbackAllowedHosts configured")
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return fmt.Errorf("invalid callback_url %q", rawURL)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid callback_url %q: scheme must be http or https", rawURL)
+	}
+
+	// Entries may name a bare host or a host:port pair
+	for _, allowed := range appArgs.CallbackAllowedHosts {
+		if strings.EqualFold(allowed, parsed.Hostname()) || strings.EqualFold(allowed, parsed.Host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("callback host %q is not in CallbackAllowedHosts", parsed.Host)
+}
+
+// deliverCallback POSTs the payload to the callback URL, retrying failed deliveries
+// with exponential backoff up to CallbackMaxRetries times.
+//
+// Parameters:
+//   - callbackURL: The validated callback URL
+//   - payload: The job result to deliver
+//
+// Returns:
+//   - error: The last delivery error if every attempt failed
+func deliverCallback(callbackURL string, payload CallbackPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode callback payload: %w", err)
+	}
+
+	backoff := time.Duration(appArgs.CallbackRetryBackoffMs) * time.Millisecond
+	attempts := appArgs.CallbackMaxRetries + 1
+	for attempt := 1; ; attempt++ {
+		err = postCallback(callbackURL, body)
+		if err == nil {
+			logger.Printf("Delivered callback for job %s (attempt %d)", payload.JobID, attempt)
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		logger.Printf("Callback attempt %d for job %s failed: %v (retrying in %v)", attempt, payload.JobID, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postCallback performs a single webhook delivery attempt.
+//
+// Parameters:
+//   - callbackURL: The URL to POST to
+//   - body: The encoded JSON payload
+//
+// Returns:
+//   - error: Any transport error or non-2xx response status
+func postCallback(callbackURL string, body []byte) error {
+	resp, err := callbackClient.Post(callbackURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// newJobID generates a random identifier for an asynchronous job.
+//
+// Returns:
+//   - string: A 32-character hexadecimal id
+func newJobID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand failing is unrecoverable for id generation; fall back to the clock
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}